@@ -70,7 +70,11 @@ checkpointed.`,
 		if err := setEmptyNsMask(context, options); err != nil {
 			return err
 		}
-		return container.Checkpoint(options)
+		if err := container.Checkpoint(options); err != nil {
+			return err
+		}
+		recordContainerEvent(context, container, lifecycleCheckpointed, &lifecycle{})
+		return nil
 	},
 }
 
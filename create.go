@@ -6,6 +6,7 @@ import (
 	"github.com/urfave/cli"
 
 	"github.com/opencontainers/runc/prehook"
+	"github.com/opencontainers/runc/prehook/external"
 	"github.com/opencontainers/runc/utils"
 )
 
@@ -71,6 +72,10 @@ command(s) that get executed on start, edit the args parameter of the spec. See
 		}
 
 		//pre hook
+		if err := external.Load(context.GlobalString("prehook-dir")); err != nil {
+			return err
+		}
+
 		opt, err := prehook.CreateHookOptions(context, spec)
 		if err != nil {
 			return err
@@ -87,6 +92,7 @@ command(s) that get executed on start, edit the args parameter of the spec. See
 		status, err := startContainer(context, spec, CT_ACT_CREATE, nil)
 		if err != nil {
 			log.Error(err.Error())
+			removeStagingDir(context, err)
 			return err
 		}
 		// exit with the container's exit status so any external supervisor is
@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/opencontainers/runc/libcontainer"
+	"github.com/opencontainers/runc/prehook"
 	"github.com/urfave/cli"
 
 	"golang.org/x/sys/unix"
@@ -27,6 +28,18 @@ func killContainer(container libcontainer.Container) error {
 	return fmt.Errorf("container init still running")
 }
 
+// removeStagingDir removes the files staged by the prehooks of the container,
+// unless err tells that the id is used by another container.
+func removeStagingDir(context *cli.Context, err error) {
+	if lerr, ok := err.(libcontainer.Error); ok && lerr.Code() == libcontainer.IdInUse {
+		return
+	}
+	id := context.Args().First()
+	if e := prehook.RemoveStagingDir(context.GlobalString("root"), id); e != nil {
+		fmt.Fprintf(os.Stderr, "remove staging dir of %s: %v\n", id, e)
+	}
+}
+
 var deleteCommand = cli.Command{
 	Name:  "delete",
 	Usage: "delete any resources held by the container often used with detached container",
@@ -62,6 +75,7 @@ status of "ubuntu01" as "stopped" the following will delete resources held for
 				if e := os.RemoveAll(path); e != nil {
 					fmt.Fprintf(os.Stderr, "remove %s: %v\n", path, e)
 				}
+				removeStagingDir(context, nil)
 				if force {
 					return nil
 				}
@@ -76,14 +90,19 @@ status of "ubuntu01" as "stopped" the following will delete resources held for
 		case libcontainer.Stopped:
 			destroy(container)
 		case libcontainer.Created:
-			return killContainer(container)
+			if err := killContainer(container); err != nil {
+				return err
+			}
 		default:
-			if force {
-				return killContainer(container)
+			if !force {
+				return fmt.Errorf("cannot delete container %s that is not stopped: %s\n", id, s)
+			}
+			if err := killContainer(container); err != nil {
+				return err
 			}
-			return fmt.Errorf("cannot delete container %s that is not stopped: %s\n", id, s)
 		}
 
+		removeStagingDir(context, nil)
 		return nil
 	},
 }
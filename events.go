@@ -6,12 +6,16 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"reflect"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/opencontainers/runc/libcontainer"
 	"github.com/opencontainers/runc/libcontainer/cgroups"
 	"github.com/opencontainers/runc/libcontainer/intelrdt"
+	"github.com/opencontainers/runc/libcontainer/utils"
+	"github.com/opencontainers/runc/prehook/richcontainer"
 
 	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli"
@@ -32,6 +36,26 @@ type stats struct {
 	Blkio    blkio              `json:"blkio"`
 	Hugetlb  map[string]hugetlb `json:"hugetlb"`
 	IntelRdt intelRdt           `json:"intel_rdt"`
+
+	NetworkInterfaces []*networkInterface `json:"network_interfaces,omitempty"`
+
+	// SubCgroups are the stats of the sub-cgroups of processes started with
+	// runc exec --cgroup, by their path.
+	SubCgroups map[string]*stats `json:"sub_cgroups,omitempty"`
+}
+
+type networkInterface struct {
+	// Name is the name of the network interface.
+	Name string `json:"name"`
+
+	RxBytes   uint64 `json:"rx_bytes"`
+	RxPackets uint64 `json:"rx_packets"`
+	RxErrors  uint64 `json:"rx_errors"`
+	RxDropped uint64 `json:"rx_dropped"`
+	TxBytes   uint64 `json:"tx_bytes"`
+	TxPackets uint64 `json:"tx_packets"`
+	TxErrors  uint64 `json:"tx_errors"`
+	TxDropped uint64 `json:"tx_dropped"`
 }
 
 type hugetlb struct {
@@ -56,6 +80,7 @@ type blkio struct {
 	IoMergedRecursive       []blkioEntry `json:"ioMergedRecursive,omitempty"`
 	IoTimeRecursive         []blkioEntry `json:"ioTimeRecursive,omitempty"`
 	SectorsRecursive        []blkioEntry `json:"sectorsRecursive,omitempty"`
+	PSI                     *psiStats    `json:"psi,omitempty"`
 }
 
 type pids struct {
@@ -80,6 +105,33 @@ type cpuUsage struct {
 type cpu struct {
 	Usage      cpuUsage   `json:"usage,omitempty"`
 	Throttling throttling `json:"throttling,omitempty"`
+	PSI        *psiStats  `json:"psi,omitempty"`
+}
+
+type psiData struct {
+	Avg10  float64 `json:"avg10"`
+	Avg60  float64 `json:"avg60"`
+	Avg300 float64 `json:"avg300"`
+	// Units: microseconds.
+	Total uint64 `json:"total"`
+}
+
+type psiStats struct {
+	Some psiData `json:"some,omitempty"`
+	Full psiData `json:"full,omitempty"`
+}
+
+// memoryEvent is the data of the oom, oom_kill, high and max events of
+// cgroup v2, the increase of the memory.events counter.
+type memoryEvent struct {
+	Count uint64 `json:"count"`
+}
+
+// psiTrigger is the data of the psi event sent when a pressure stall trigger
+// fires.
+type psiTrigger struct {
+	Resource string `json:"resource"`
+	Trigger  string `json:"trigger"`
 }
 
 type memoryEntry struct {
@@ -96,6 +148,7 @@ type memory struct {
 	Kernel    memoryEntry       `json:"kernel,omitempty"`
 	KernelTCP memoryEntry       `json:"kernelTCP,omitempty"`
 	Raw       map[string]uint64 `json:"raw,omitempty"`
+	PSI       *psiStats         `json:"psi,omitempty"`
 }
 
 type l3CacheInfo struct {
@@ -111,6 +164,13 @@ type memBwInfo struct {
 	NumClosids    uint64 `json:"num_closids,omitempty"`
 }
 
+type l3Monitoring struct {
+	Id            uint64 `json:"id"`
+	LLCOccupancy  uint64 `json:"llc_occupancy,omitempty"`
+	MBMTotalBytes uint64 `json:"mbm_total_bytes,omitempty"`
+	MBMLocalBytes uint64 `json:"mbm_local_bytes,omitempty"`
+}
+
 type intelRdt struct {
 	// The read-only L3 cache information
 	L3CacheInfo *l3CacheInfo `json:"l3_cache_info,omitempty"`
@@ -129,6 +189,9 @@ type intelRdt struct {
 
 	// The memory bandwidth schema in 'container_id' group
 	MemBwSchema string `json:"mem_bw_schema,omitempty"`
+
+	// The L3 cache occupancy and memory bandwidth per L3 cache domain
+	L3Monitoring []l3Monitoring `json:"l3_monitoring,omitempty"`
 }
 
 var eventsCommand = cli.Command{
@@ -138,10 +201,12 @@ var eventsCommand = cli.Command{
 
 Where "<container-id>" is the name for the instance of the container.`,
 	Description: `The events command displays information about the container. By default the
-information is displayed once every 5 seconds.`,
+information is displayed once every 5 seconds. The lifecycle transitions of the
+container are streamed as they happen, until it is deleted.`,
 	Flags: []cli.Flag{
 		cli.DurationFlag{Name: "interval", Value: 5 * time.Second, Usage: "set the stats collection interval"},
 		cli.BoolFlag{Name: "stats", Usage: "display the container's stats then exit"},
+		cli.StringSliceFlag{Name: "psi-trigger", Usage: "display a psi event when a pressure stall trigger fires, in the format <cpu|memory|io>:<some|full>:<stall>:<window>, e.g. memory:some:150ms:1s"},
 	},
 	Action: func(context *cli.Context) error {
 		if err := checkArgs(context, 1, exactArgs); err != nil {
@@ -163,9 +228,11 @@ information is displayed once every 5 seconds.`,
 			return fmt.Errorf("container with id %s is not running", container.ID())
 		}
 		var (
-			stats  = make(chan *libcontainer.Stats, 1)
-			events = make(chan *event, 1024)
-			group  = &sync.WaitGroup{}
+			stats    = make(chan *libcontainer.Stats, 1)
+			health   = make(chan *richcontainer.Health, 1)
+			pressure = make(chan *psiTrigger, 1)
+			events   = make(chan *event, 1024)
+			group    = &sync.WaitGroup{}
 		)
 		group.Add(1)
 		go func() {
@@ -197,12 +264,61 @@ information is displayed once every 5 seconds.`,
 				stats <- s
 			}
 		}()
-		n, err := container.NotifyOOM()
+		if h := containerHealth(container); h != nil {
+			// report the main service of a rich container when it changes
+			health <- h
+			go func() {
+				last := h
+				for range time.Tick(context.Duration("interval")) {
+					h := containerHealth(container)
+					if h == nil || reflect.DeepEqual(h, last) {
+						continue
+					}
+					last = h
+					health <- h
+				}
+			}()
+		}
+		for _, value := range context.StringSlice("psi-trigger") {
+			resource, trigger, err := parsePSITrigger(value)
+			if err != nil {
+				return err
+			}
+			p, err := container.NotifyPressureStall(resource, trigger)
+			if err != nil {
+				return err
+			}
+			go func(t *psiTrigger) {
+				for range p {
+					pressure <- t
+				}
+			}(&psiTrigger{Resource: resource, Trigger: trigger.String()})
+		}
+		var (
+			n <-chan struct{}
+			m <-chan libcontainer.MemoryEvents
+		)
+		if cgroups.IsCgroup2UnifiedMode() {
+			m, err = container.NotifyMemoryEvents()
+		} else {
+			n, err = container.NotifyOOM()
+		}
+		if err != nil {
+			return err
+		}
+		l, err := watchLifecycle(lifecycleLogPath(context, container.ID()), container)
 		if err != nil {
 			return err
 		}
 		for {
 			select {
+			case e, ok := <-l:
+				if ok {
+					events <- e
+				} else {
+					// the container was deleted
+					l = nil
+				}
 			case _, ok := <-n:
 				if ok {
 					// this means an oom event was received, if it is !ok then
@@ -212,10 +328,22 @@ information is displayed once every 5 seconds.`,
 				} else {
 					n = nil
 				}
+			case e, ok := <-m:
+				if ok {
+					for _, me := range convertMemoryEvents(container.ID(), e) {
+						events <- me
+					}
+				} else {
+					m = nil
+				}
 			case s := <-stats:
 				events <- &event{Type: "stats", ID: container.ID(), Data: convertLibcontainerStats(s)}
+			case h := <-health:
+				events <- &event{Type: "health", ID: container.ID(), Data: h}
+			case t := <-pressure:
+				events <- &event{Type: "psi", ID: container.ID(), Data: t}
 			}
-			if n == nil {
+			if n == nil && m == nil && l == nil {
 				close(events)
 				break
 			}
@@ -225,6 +353,78 @@ information is displayed once every 5 seconds.`,
 	},
 }
 
+// containerHealth returns the state of the main service of a rich container,
+// nil if the container is not a running rich container.
+func containerHealth(container libcontainer.Container) *richcontainer.Health {
+	status, err := container.Status()
+	if err != nil {
+		return nil
+	}
+	state, err := container.State()
+	if err != nil {
+		return nil
+	}
+	_, annotations := utils.Annotations(state.Config.Labels)
+	return richContainerHealth(container, status, state.InitProcessPid, annotations)
+}
+
+// convertMemoryEvents returns the events of the memory.events counters which
+// increased, the oom ones first.
+func convertMemoryEvents(id string, e libcontainer.MemoryEvents) []*event {
+	var out []*event
+	for _, c := range []struct {
+		typ   string
+		count uint64
+	}{
+		{"oom", e.Oom},
+		{"oom_kill", e.OomKill},
+		{"max", e.Max},
+		{"high", e.High},
+	} {
+		if c.count > 0 {
+			out = append(out, &event{Type: c.typ, ID: id, Data: &memoryEvent{Count: c.count}})
+		}
+	}
+	return out
+}
+
+// parsePSITrigger parses a pressure stall trigger in the format
+// <resource>:<some|full>:<stall>:<window>.
+func parsePSITrigger(value string) (string, libcontainer.PSITrigger, error) {
+	var trigger libcontainer.PSITrigger
+	parts := strings.Split(value, ":")
+	if len(parts) != 4 {
+		return "", trigger, fmt.Errorf("invalid psi trigger %q, the format is <resource>:<some|full>:<stall>:<window>", value)
+	}
+
+	resource := parts[0]
+	switch resource {
+	case cgroups.PSICpu, cgroups.PSIMemory, cgroups.PSIIo:
+	default:
+		return "", trigger, fmt.Errorf("invalid psi trigger resource %q", resource)
+	}
+
+	switch parts[1] {
+	case "some":
+	case "full":
+		trigger.Full = true
+	default:
+		return "", trigger, fmt.Errorf("invalid psi trigger kind %q", parts[1])
+	}
+
+	var err error
+	if trigger.Stall, err = time.ParseDuration(parts[2]); err != nil {
+		return "", trigger, fmt.Errorf("invalid psi trigger stall %q: %v", parts[2], err)
+	}
+	if trigger.Window, err = time.ParseDuration(parts[3]); err != nil {
+		return "", trigger, fmt.Errorf("invalid psi trigger window %q: %v", parts[3], err)
+	}
+	if trigger.Stall <= 0 || trigger.Stall > trigger.Window {
+		return "", trigger, fmt.Errorf("psi trigger stall must be positive and not greater than the window")
+	}
+	return resource, trigger, nil
+}
+
 func convertLibcontainerStats(ls *libcontainer.Stats) *stats {
 	cg := ls.CgroupStats
 	if cg == nil {
@@ -241,6 +441,7 @@ func convertLibcontainerStats(ls *libcontainer.Stats) *stats {
 	s.CPU.Throttling.Periods = cg.CpuStats.ThrottlingData.Periods
 	s.CPU.Throttling.ThrottledPeriods = cg.CpuStats.ThrottlingData.ThrottledPeriods
 	s.CPU.Throttling.ThrottledTime = cg.CpuStats.ThrottlingData.ThrottledTime
+	s.CPU.PSI = convertPSI(cg.CpuStats.PSI)
 
 	s.Memory.Cache = cg.MemoryStats.Cache
 	s.Memory.Kernel = convertMemoryEntry(cg.MemoryStats.KernelUsage)
@@ -248,6 +449,7 @@ func convertLibcontainerStats(ls *libcontainer.Stats) *stats {
 	s.Memory.Swap = convertMemoryEntry(cg.MemoryStats.SwapUsage)
 	s.Memory.Usage = convertMemoryEntry(cg.MemoryStats.Usage)
 	s.Memory.Raw = cg.MemoryStats.Stats
+	s.Memory.PSI = convertPSI(cg.MemoryStats.PSI)
 
 	s.Blkio.IoServiceBytesRecursive = convertBlkioEntry(cg.BlkioStats.IoServiceBytesRecursive)
 	s.Blkio.IoServicedRecursive = convertBlkioEntry(cg.BlkioStats.IoServicedRecursive)
@@ -257,6 +459,7 @@ func convertLibcontainerStats(ls *libcontainer.Stats) *stats {
 	s.Blkio.IoMergedRecursive = convertBlkioEntry(cg.BlkioStats.IoMergedRecursive)
 	s.Blkio.IoTimeRecursive = convertBlkioEntry(cg.BlkioStats.IoTimeRecursive)
 	s.Blkio.SectorsRecursive = convertBlkioEntry(cg.BlkioStats.SectorsRecursive)
+	s.Blkio.PSI = convertPSI(cg.BlkioStats.PSI)
 
 	s.Hugetlb = make(map[string]hugetlb)
 	for k, v := range cg.HugetlbStats {
@@ -274,6 +477,30 @@ func convertLibcontainerStats(ls *libcontainer.Stats) *stats {
 			s.IntelRdt.MemBwSchemaRoot = is.MemBwSchemaRoot
 			s.IntelRdt.MemBwSchema = is.MemBwSchema
 		}
+		if intelrdt.IsMonitoringEnabled() {
+			s.IntelRdt.L3Monitoring = convertL3Monitoring(is.L3Monitoring)
+		}
+	}
+
+	for _, i := range ls.Interfaces {
+		s.NetworkInterfaces = append(s.NetworkInterfaces, &networkInterface{
+			Name:      i.Name,
+			RxBytes:   i.RxBytes,
+			RxPackets: i.RxPackets,
+			RxErrors:  i.RxErrors,
+			RxDropped: i.RxDropped,
+			TxBytes:   i.TxBytes,
+			TxPackets: i.TxPackets,
+			TxErrors:  i.TxErrors,
+			TxDropped: i.TxDropped,
+		})
+	}
+
+	for name, sub := range ls.SubCgroupStats {
+		if s.SubCgroups == nil {
+			s.SubCgroups = make(map[string]*stats, len(ls.SubCgroupStats))
+		}
+		s.SubCgroups[name] = convertLibcontainerStats(&libcontainer.Stats{CgroupStats: sub})
 	}
 
 	return &s
@@ -296,6 +523,16 @@ func convertMemoryEntry(c cgroups.MemoryData) memoryEntry {
 	}
 }
 
+func convertPSI(c *cgroups.PSIStats) *psiStats {
+	if c == nil {
+		return nil
+	}
+	return &psiStats{
+		Some: psiData(c.Some),
+		Full: psiData(c.Full),
+	}
+}
+
 func convertBlkioEntry(c []cgroups.BlkioStatEntry) []blkioEntry {
 	var out []blkioEntry
 	for _, e := range c {
@@ -317,6 +554,19 @@ func convertL3CacheInfo(i *intelrdt.L3CacheInfo) *l3CacheInfo {
 	}
 }
 
+func convertL3Monitoring(in []intelrdt.L3MonitoringStats) []l3Monitoring {
+	var out []l3Monitoring
+	for _, m := range in {
+		out = append(out, l3Monitoring{
+			Id:            m.Id,
+			LLCOccupancy:  m.LLCOccupancy,
+			MBMTotalBytes: m.MBMTotalBytes,
+			MBMLocalBytes: m.MBMLocalBytes,
+		})
+	}
+	return out
+}
+
 func convertMemBwInfo(i *intelrdt.MemBwInfo) *memBwInfo {
 	return &memBwInfo{
 		BandwidthGran: i.BandwidthGran,
@@ -9,7 +9,9 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/docker/go-units"
 	"github.com/opencontainers/runc/libcontainer"
+	"github.com/opencontainers/runc/libcontainer/configs"
 	"github.com/opencontainers/runc/libcontainer/utils"
 	"github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/urfave/cli"
@@ -93,6 +95,34 @@ following will output a list of processes running in the container:
 			Name:  "preserve-fds",
 			Usage: "Pass N additional file descriptors to the container (stdio + $LISTEN_FDS + N in total)",
 		},
+		cli.StringFlag{
+			Name:  "cgroup",
+			Usage: "run the process in a sub-cgroup of the container, given by its path relative to the cgroup of the container",
+		},
+		cli.StringFlag{
+			Name:  "cgroup-memory",
+			Usage: "Memory limit (in bytes) of the sub-cgroup",
+		},
+		cli.StringFlag{
+			Name:  "cgroup-cpu-shares",
+			Usage: "CPU shares of the sub-cgroup (relative weight vs. the other processes of the container)",
+		},
+		cli.StringFlag{
+			Name:  "cgroup-cpu-period",
+			Usage: "CPU CFS period of the sub-cgroup (in usecs)",
+		},
+		cli.StringFlag{
+			Name:  "cgroup-cpu-quota",
+			Usage: "CPU CFS hardcap limit of the sub-cgroup (in usecs). Allowed cpu time in a given period",
+		},
+		cli.StringFlag{
+			Name:  "cgroup-cpuset-cpus",
+			Usage: "CPU(s) the sub-cgroup can use",
+		},
+		cli.IntFlag{
+			Name:  "cgroup-pids-limit",
+			Usage: "Maximum number of pids allowed in the sub-cgroup",
+		},
 	},
 	Action: func(context *cli.Context) error {
 		if err := checkArgs(context, 1, minArgs); err != nil {
@@ -136,6 +166,10 @@ func execProcess(context *cli.Context) (int, error) {
 	if err != nil {
 		return -1, err
 	}
+	subCgroupResources, err := getSubCgroupResources(context)
+	if err != nil {
+		return -1, err
+	}
 	r := &runner{
 		enableSubreaper: false,
 		shouldDestroy:   false,
@@ -146,10 +180,65 @@ func execProcess(context *cli.Context) (int, error) {
 		action:          CT_ACT_RUN,
 		init:            false,
 		preserveFDs:     context.Int("preserve-fds"),
+		lifecycleLog:    lifecycleLogPath(context, container.ID()),
+
+		subCgroup:          context.String("cgroup"),
+		subCgroupResources: subCgroupResources,
 	}
 	return r.run(p)
 }
 
+// getSubCgroupResources returns the resources of the sub-cgroup of the
+// process given by the cgroup-* flags.
+func getSubCgroupResources(context *cli.Context) (*configs.Resources, error) {
+	r := &configs.Resources{}
+	set := false
+	for _, flag := range []string{"cgroup-memory", "cgroup-cpu-shares", "cgroup-cpu-period", "cgroup-cpu-quota", "cgroup-cpuset-cpus", "cgroup-pids-limit"} {
+		if context.IsSet(flag) {
+			set = true
+		}
+	}
+	if !set {
+		return nil, nil
+	}
+	if context.String("cgroup") == "" {
+		return nil, fmt.Errorf("the resources of a sub-cgroup require the cgroup option")
+	}
+
+	if val := context.String("cgroup-memory"); val != "" {
+		v, err := units.RAMInBytes(val)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for cgroup-memory: %s", err)
+		}
+		r.Memory = v
+	}
+	for _, pair := range []struct {
+		opt  string
+		dest *uint64
+	}{
+		{"cgroup-cpu-shares", &r.CpuShares},
+		{"cgroup-cpu-period", &r.CpuPeriod},
+	} {
+		if val := context.String(pair.opt); val != "" {
+			var err error
+			*pair.dest, err = strconv.ParseUint(val, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid value for %s: %s", pair.opt, err)
+			}
+		}
+	}
+	if val := context.String("cgroup-cpu-quota"); val != "" {
+		v, err := strconv.ParseInt(val, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for cgroup-cpu-quota: %s", err)
+		}
+		r.CpuQuota = v
+	}
+	r.CpusetCpus = context.String("cgroup-cpuset-cpus")
+	r.PidsLimit = int64(context.Int("cgroup-pids-limit"))
+	return r, nil
+}
+
 func getProcess(context *cli.Context, bundle string) (*specs.Process, error) {
 	if path := context.String("process"); path != "" {
 		f, err := os.Open(path)
@@ -173,6 +262,9 @@ func getProcess(context *cli.Context, bundle string) (*specs.Process, error) {
 	}
 	p := spec.Process
 	p.Args = context.Args()[1:]
+	// the rlimits of the container may have been changed by runc update since
+	// the bundle was created, leave them to the saved config of the container
+	p.Rlimits = nil
 	// override the cwd, if passed
 	if context.String("cwd") != "" {
 		p.Cwd = context.String("cwd")
@@ -0,0 +1,60 @@
+// +build linux
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/urfave/cli"
+)
+
+func TestGetProcessLeavesRlimitsToContainer(t *testing.T) {
+	bundle, err := ioutil.TempDir("", "bundle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(bundle)
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	spec := &specs.Spec{
+		Process: &specs.Process{
+			Args:    []string{"sh"},
+			Cwd:     "/",
+			Rlimits: []specs.POSIXRlimit{{Type: "RLIMIT_NOFILE", Hard: 1024, Soft: 1024}},
+		},
+	}
+	data, err := json.Marshal(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(bundle, specConfig), data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	set := flag.NewFlagSet("exec", flag.ContinueOnError)
+	set.String("process", "", "")
+	if err := set.Parse([]string{"ctr", "true"}); err != nil {
+		t.Fatal(err)
+	}
+	p, err := getProcess(cli.NewContext(nil, set, nil), bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.Args) != 1 || p.Args[0] != "true" {
+		t.Fatalf("unexpected args %v", p.Args)
+	}
+	// the rlimits of the bundle would override the ones of the container
+	if len(p.Rlimits) != 0 {
+		t.Fatalf("expected no rlimits, got %v", p.Rlimits)
+	}
+}
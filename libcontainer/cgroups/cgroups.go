@@ -39,6 +39,10 @@ type Manager interface {
 
 	// Sets the cgroup as configured.
 	Set(container *configs.Config) error
+
+	// Saves the values of the cgroup set that Set may change, to restore
+	// them when an update fails.
+	Snapshot() (*Snapshot, error)
 }
 
 type NotFoundError struct {
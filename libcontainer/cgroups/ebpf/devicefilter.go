@@ -0,0 +1,267 @@
+// +build linux
+
+package ebpf
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+
+	"github.com/opencontainers/runc/libcontainer/configs"
+	"github.com/vishvananda/netlink/nl"
+)
+
+// Instruction is a raw eBPF instruction, see struct bpf_insn in
+// include/uapi/linux/bpf.h.
+type Instruction struct {
+	Code   uint8
+	DstReg uint8
+	SrcReg uint8
+	Off    int16
+	Imm    int32
+}
+
+// instruction classes, operations and sources of include/uapi/linux/bpf.h,
+// the vendored golang.org/x/sys does not have the eBPF ones yet.
+const (
+	bpfLdx   = 0x01
+	bpfJmp   = 0x05
+	bpfAlu64 = 0x07
+
+	bpfW   = 0x00
+	bpfMem = 0x60
+
+	bpfK = 0x00
+	bpfX = 0x08
+
+	bpfAnd  = 0x50
+	bpfRsh  = 0x70
+	bpfMov  = 0xb0
+	bpfJeq  = 0x10
+	bpfJne  = 0x50
+	bpfExit = 0x90
+)
+
+// access and device types of struct bpf_cgroup_dev_ctx.
+const (
+	bpfDevcgAccMknod = 1
+	bpfDevcgAccRead  = 2
+	bpfDevcgAccWrite = 4
+
+	bpfDevcgDevBlock = 1
+	bpfDevcgDevChar  = 2
+)
+
+// registers used by the device filter.
+const (
+	regRet    = 0 // return value
+	regCtx    = 1 // struct bpf_cgroup_dev_ctx *
+	regType   = 2 // device type
+	regAccess = 3 // requested access
+	regMajor  = 4
+	regMinor  = 5
+	regTmp    = 6
+)
+
+// jumpNext marks the offset of a jump to the next rule, it is resolved once
+// the length of the rule is known.
+const jumpNext = math.MaxInt16
+
+func ldxW(dst, src uint8, off int16) Instruction {
+	return Instruction{Code: bpfLdx | bpfMem | bpfW, DstReg: dst, SrcReg: src, Off: off}
+}
+
+func alu64K(op, dst uint8, imm int32) Instruction {
+	return Instruction{Code: bpfAlu64 | op | bpfK, DstReg: dst, Imm: imm}
+}
+
+func mov64X(dst, src uint8) Instruction {
+	return Instruction{Code: bpfAlu64 | bpfMov | bpfX, DstReg: dst, SrcReg: src}
+}
+
+func jmpK(op, dst uint8, imm int32, off int16) Instruction {
+	return Instruction{Code: bpfJmp | op | bpfK, DstReg: dst, Imm: imm, Off: off}
+}
+
+func exit() Instruction {
+	return Instruction{Code: bpfJmp | bpfExit}
+}
+
+// DeviceRules returns the device rules of r in the order the devices cgroup
+// v1 controller applies them.
+func DeviceRules(r *configs.Resources) []*configs.Device {
+	if len(r.Devices) > 0 {
+		return r.Devices
+	}
+
+	var rules []*configs.Device
+	if r.AllowAllDevices != nil {
+		if !*r.AllowAllDevices {
+			rules = append(rules, &configs.Device{Type: 'a', Major: configs.Wildcard, Minor: configs.Wildcard, Permissions: "rwm", Allow: false})
+			return append(rules, r.AllowedDevices...)
+		}
+		rules = append(rules, &configs.Device{Type: 'a', Major: configs.Wildcard, Minor: configs.Wildcard, Permissions: "rwm", Allow: true})
+	}
+	return append(rules, r.DeniedDevices...)
+}
+
+// DeviceFilter compiles the device rules into a BPF_PROG_TYPE_CGROUP_DEVICE
+// program.
+//
+// The rules keep the semantics of the devices cgroup v1 controller: a rule of
+// type 'a' resets the policy to allow or deny everything, the other rules are
+// exceptions to it and the last matching one wins. An allow rule matches an
+// access it grants entirely, a deny rule an access it denies partly.
+// Everything is allowed when there are no rules, like in a new v1 cgroup.
+func DeviceFilter(devices []*configs.Device) ([]Instruction, error) {
+	defaultAllow := true
+	var rules []*configs.Device
+	for _, dev := range devices {
+		if dev.Type == 'a' {
+			defaultAllow = dev.Allow
+			rules = nil
+			continue
+		}
+		rules = append(rules, dev)
+	}
+
+	insts := []Instruction{
+		// type = ctx->access_type & 0xffff
+		ldxW(regType, regCtx, 0),
+		alu64K(bpfAnd, regType, 0xffff),
+		// access = ctx->access_type >> 16
+		ldxW(regAccess, regCtx, 0),
+		alu64K(bpfRsh, regAccess, 16),
+		ldxW(regMajor, regCtx, 4),
+		ldxW(regMinor, regCtx, 8),
+	}
+
+	for i := len(rules) - 1; i >= 0; i-- {
+		block, err := deviceRule(rules[i])
+		if err != nil {
+			return nil, err
+		}
+		insts = append(insts, block...)
+	}
+
+	return append(insts,
+		alu64K(bpfMov, regRet, boolToImm(defaultAllow)),
+		exit(),
+	), nil
+}
+
+// deviceRule returns the instructions returning the verdict of dev when it
+// matches the device access, and jumping past them otherwise.
+func deviceRule(dev *configs.Device) ([]Instruction, error) {
+	var devType int32
+	switch dev.Type {
+	case 'b':
+		devType = bpfDevcgDevBlock
+	case 'c':
+		devType = bpfDevcgDevChar
+	default:
+		return nil, fmt.Errorf("invalid device type %q", string(dev.Type))
+	}
+
+	var access int32
+	for _, p := range dev.Permissions {
+		switch p {
+		case 'r':
+			access |= bpfDevcgAccRead
+		case 'w':
+			access |= bpfDevcgAccWrite
+		case 'm':
+			access |= bpfDevcgAccMknod
+		default:
+			return nil, fmt.Errorf("invalid device permissions %q", dev.Permissions)
+		}
+	}
+
+	block := []Instruction{
+		jmpK(bpfJne, regType, devType, jumpNext),
+		mov64X(regTmp, regAccess),
+	}
+	if dev.Allow {
+		// the access must not request anything the rule does not grant
+		block = append(block,
+			alu64K(bpfAnd, regTmp, ^access&(bpfDevcgAccMknod|bpfDevcgAccRead|bpfDevcgAccWrite)),
+			jmpK(bpfJne, regTmp, 0, jumpNext),
+		)
+	} else {
+		// the access must request something the rule denies
+		block = append(block,
+			alu64K(bpfAnd, regTmp, access),
+			jmpK(bpfJeq, regTmp, 0, jumpNext),
+		)
+	}
+	if dev.Major != configs.Wildcard {
+		block = append(block, jmpK(bpfJne, regMajor, int32(dev.Major), jumpNext))
+	}
+	if dev.Minor != configs.Wildcard {
+		block = append(block, jmpK(bpfJne, regMinor, int32(dev.Minor), jumpNext))
+	}
+	block = append(block,
+		alu64K(bpfMov, regRet, boolToImm(dev.Allow)),
+		exit(),
+	)
+
+	for i := range block {
+		if block[i].Off == jumpNext {
+			block[i].Off = int16(len(block) - i - 1)
+		}
+	}
+	return block, nil
+}
+
+func boolToImm(b bool) int32 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// encode returns the instructions in the layout of struct bpf_insn.
+func encode(insts []Instruction) []byte {
+	native := nl.NativeEndian()
+	buf := make([]byte, 0, len(insts)*8)
+	for _, inst := range insts {
+		// dst_reg and src_reg are 4-bit fields of a single byte.
+		regs := inst.DstReg&0xf | inst.SrcReg<<4
+		if native == binary.BigEndian {
+			regs = inst.DstReg<<4 | inst.SrcReg&0xf
+		}
+		b := make([]byte, 8)
+		b[0] = inst.Code
+		b[1] = regs
+		native.PutUint16(b[2:4], uint16(inst.Off))
+		native.PutUint32(b[4:8], uint32(inst.Imm))
+		buf = append(buf, b...)
+	}
+	return buf
+}
+
+// String disassembles the instruction, for debugging.
+func (i Instruction) String() string {
+	var op string
+	switch i.Code {
+	case bpfLdx | bpfMem | bpfW:
+		return fmt.Sprintf("r%d = *(u32 *)(r%d + %d)", i.DstReg, i.SrcReg, i.Off)
+	case bpfAlu64 | bpfMov | bpfX:
+		return fmt.Sprintf("r%d = r%d", i.DstReg, i.SrcReg)
+	case bpfAlu64 | bpfMov | bpfK:
+		return fmt.Sprintf("r%d = %d", i.DstReg, i.Imm)
+	case bpfAlu64 | bpfAnd | bpfK:
+		op = "&="
+	case bpfAlu64 | bpfRsh | bpfK:
+		op = ">>="
+	case bpfJmp | bpfJeq | bpfK:
+		return fmt.Sprintf("if r%d == %d goto +%d", i.DstReg, i.Imm, i.Off)
+	case bpfJmp | bpfJne | bpfK:
+		return fmt.Sprintf("if r%d != %d goto +%d", i.DstReg, i.Imm, i.Off)
+	case bpfJmp | bpfExit:
+		return "exit"
+	default:
+		return fmt.Sprintf("unknown opcode %#x", i.Code)
+	}
+	return fmt.Sprintf("r%d %s %d", i.DstReg, op, i.Imm)
+}
@@ -0,0 +1,131 @@
+// +build linux
+
+package ebpf
+
+import (
+	"testing"
+
+	"github.com/opencontainers/runc/libcontainer/configs"
+)
+
+// run interprets the device filter for an access to a device.
+func run(t *testing.T, insts []Instruction, devType, access, major, minor uint32) bool {
+	var regs [11]uint64
+	ctx := [3]uint32{devType | access<<16, major, minor}
+	for pc := 0; pc < len(insts); pc++ {
+		inst := insts[pc]
+		switch inst.Code {
+		case bpfLdx | bpfMem | bpfW:
+			regs[inst.DstReg] = uint64(ctx[inst.Off/4])
+		case bpfAlu64 | bpfMov | bpfX:
+			regs[inst.DstReg] = regs[inst.SrcReg]
+		case bpfAlu64 | bpfMov | bpfK:
+			regs[inst.DstReg] = uint64(int64(inst.Imm))
+		case bpfAlu64 | bpfAnd | bpfK:
+			regs[inst.DstReg] &= uint64(int64(inst.Imm))
+		case bpfAlu64 | bpfRsh | bpfK:
+			regs[inst.DstReg] >>= uint64(inst.Imm)
+		case bpfJmp | bpfJeq | bpfK:
+			if regs[inst.DstReg] == uint64(int64(inst.Imm)) {
+				pc += int(inst.Off)
+			}
+		case bpfJmp | bpfJne | bpfK:
+			if regs[inst.DstReg] != uint64(int64(inst.Imm)) {
+				pc += int(inst.Off)
+			}
+		case bpfJmp | bpfExit:
+			return regs[regRet] == 1
+		default:
+			t.Fatalf("unexpected instruction %s", inst)
+		}
+	}
+	t.Fatal("device filter did not exit")
+	return false
+}
+
+func TestDeviceFilter(t *testing.T) {
+	devices := []*configs.Device{
+		{Type: 'a', Major: configs.Wildcard, Minor: configs.Wildcard, Permissions: "rwm", Allow: false},
+		// /dev/null
+		{Type: 'c', Major: 1, Minor: 3, Permissions: "rwm", Allow: true},
+		// all pts, read and write only
+		{Type: 'c', Major: 136, Minor: configs.Wildcard, Permissions: "rw", Allow: true},
+		// all block devices but sda
+		{Type: 'b', Major: configs.Wildcard, Minor: configs.Wildcard, Permissions: "rwm", Allow: true},
+		{Type: 'b', Major: 8, Minor: 0, Permissions: "w", Allow: false},
+	}
+	insts, err := DeviceFilter(devices)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name            string
+		devType, access uint32
+		major, minor    uint32
+		expected        bool
+	}{
+		{"read null", bpfDevcgDevChar, bpfDevcgAccRead, 1, 3, true},
+		{"mknod null", bpfDevcgDevChar, bpfDevcgAccMknod, 1, 3, true},
+		{"read zero", bpfDevcgDevChar, bpfDevcgAccRead, 1, 5, false},
+		{"read write pts", bpfDevcgDevChar, bpfDevcgAccRead | bpfDevcgAccWrite, 136, 2, true},
+		{"mknod pts", bpfDevcgDevChar, bpfDevcgAccMknod, 136, 2, false},
+		{"block 1:3", bpfDevcgDevBlock, bpfDevcgAccRead, 1, 3, true},
+		{"read sda", bpfDevcgDevBlock, bpfDevcgAccRead, 8, 0, true},
+		{"write sda", bpfDevcgDevBlock, bpfDevcgAccWrite, 8, 0, false},
+		{"read write sda", bpfDevcgDevBlock, bpfDevcgAccRead | bpfDevcgAccWrite, 8, 0, false},
+		{"write sdb", bpfDevcgDevBlock, bpfDevcgAccWrite, 8, 16, true},
+	}
+	for _, c := range cases {
+		if got := run(t, insts, c.devType, c.access, c.major, c.minor); got != c.expected {
+			t.Errorf("%s: got %v, want %v\n%s", c.name, got, c.expected, disassemble(insts))
+		}
+	}
+}
+
+func TestDeviceFilterReset(t *testing.T) {
+	for _, allow := range []bool{true, false} {
+		devices := []*configs.Device{
+			{Type: 'c', Major: 1, Minor: 3, Permissions: "rwm", Allow: !allow},
+			{Type: 'a', Major: configs.Wildcard, Minor: configs.Wildcard, Permissions: "rwm", Allow: allow},
+		}
+		insts, err := DeviceFilter(devices)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := run(t, insts, bpfDevcgDevChar, bpfDevcgAccRead, 1, 3); got != allow {
+			t.Errorf("got %v, want %v after resetting the rules\n%s", got, allow, disassemble(insts))
+		}
+	}
+}
+
+func TestDeviceFilterInvalid(t *testing.T) {
+	devices := []*configs.Device{
+		{Type: 'c', Major: 1, Minor: 3, Permissions: "rwx", Allow: true},
+	}
+	if _, err := DeviceFilter(devices); err == nil {
+		t.Fatal("expected an error for invalid permissions")
+	}
+}
+
+func TestDeviceRules(t *testing.T) {
+	allow := false
+	r := &configs.Resources{
+		AllowAllDevices: &allow,
+		AllowedDevices: []*configs.Device{
+			{Type: 'c', Major: 1, Minor: 3, Permissions: "rwm", Allow: true},
+		},
+	}
+	rules := DeviceRules(r)
+	if len(rules) != 2 || rules[0].Type != 'a' || rules[0].Allow || rules[1] != r.AllowedDevices[0] {
+		t.Fatalf("unexpected rules %+v", rules)
+	}
+}
+
+func disassemble(insts []Instruction) string {
+	s := ""
+	for _, inst := range insts {
+		s += inst.String() + "\n"
+	}
+	return s
+}
@@ -0,0 +1,232 @@
+// +build linux
+
+// Package ebpf loads and attaches the eBPF programs enforcing cgroup v2
+// policies, such as the device access policy of a container.
+package ebpf
+
+import (
+	"os"
+	"runtime"
+	"unsafe"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// bpf(2) commands, program and attach types and flags of
+// include/uapi/linux/bpf.h.
+const (
+	bpfProgLoad      = 5
+	bpfProgAttach    = 8
+	bpfProgDetach    = 9
+	bpfProgGetFdByID = 13
+	bpfProgQuery     = 16
+
+	bpfProgTypeCgroupDevice = 15
+	bpfCgroupDevice         = 6
+
+	bpfFAllowMulti = 1 << 1
+	bpfFReplace    = 1 << 2
+)
+
+// progLoadAttr is the BPF_PROG_LOAD part of union bpf_attr.
+type progLoadAttr struct {
+	progType           uint32
+	insnCnt            uint32
+	insns              uint64
+	license            uint64
+	logLevel           uint32
+	logSize            uint32
+	logBuf             uint64
+	kernVersion        uint32
+	progFlags          uint32
+	progName           [16]byte
+	progIfindex        uint32
+	expectedAttachType uint32
+}
+
+// progAttachAttr is the BPF_PROG_ATTACH and BPF_PROG_DETACH part of union
+// bpf_attr.
+type progAttachAttr struct {
+	targetFd     uint32
+	attachBpfFd  uint32
+	attachType   uint32
+	attachFlags  uint32
+	replaceBpfFd uint32
+}
+
+// progQueryAttr is the BPF_PROG_QUERY part of union bpf_attr.
+type progQueryAttr struct {
+	targetFd    uint32
+	attachType  uint32
+	queryFlags  uint32
+	attachFlags uint32
+	progIds     uint64
+	progCnt     uint32
+}
+
+// getFdByIDAttr is the BPF_PROG_GET_FD_BY_ID part of union bpf_attr.
+type getFdByIDAttr struct {
+	id        uint32
+	nextID    uint32
+	openFlags uint32
+}
+
+func bpf(cmd uintptr, attr unsafe.Pointer, size uintptr) (uintptr, error) {
+	r, _, errno := unix.Syscall(unix.SYS_BPF, cmd, uintptr(attr), size)
+	if errno != 0 {
+		return 0, errno
+	}
+	return r, nil
+}
+
+// loadProgram loads a BPF_PROG_TYPE_CGROUP_DEVICE program. The load is
+// retried with the verifier log when the program is rejected, to report it.
+func loadProgram(insts []Instruction, license string) (int, error) {
+	code := encode(insts)
+	lic := append([]byte(license), 0)
+	attr := progLoadAttr{
+		progType:           bpfProgTypeCgroupDevice,
+		insnCnt:            uint32(len(insts)),
+		insns:              uint64(uintptr(unsafe.Pointer(&code[0]))),
+		license:            uint64(uintptr(unsafe.Pointer(&lic[0]))),
+		expectedAttachType: bpfCgroupDevice,
+	}
+	defer runtime.KeepAlive(code)
+	defer runtime.KeepAlive(lic)
+
+	fd, err := bpf(bpfProgLoad, unsafe.Pointer(&attr), unsafe.Sizeof(attr))
+	if err == nil {
+		return int(fd), nil
+	}
+
+	log := make([]byte, 64*1024)
+	attr.logLevel = 1
+	attr.logSize = uint32(len(log))
+	attr.logBuf = uint64(uintptr(unsafe.Pointer(&log[0])))
+	if fd, err := bpf(bpfProgLoad, unsafe.Pointer(&attr), unsafe.Sizeof(attr)); err == nil {
+		return int(fd), nil
+	}
+	if n := clen(log); n > 0 {
+		return -1, errors.Wrapf(err, "loading device filter: %s", log[:n])
+	}
+	return -1, errors.Wrap(err, "loading device filter")
+}
+
+func clen(b []byte) int {
+	for i, c := range b {
+		if c == 0 {
+			return i
+		}
+	}
+	return len(b)
+}
+
+// attachedPrograms returns the fds of the device programs attached to the
+// cgroup of dirFd.
+func attachedPrograms(dirFd int) ([]int, error) {
+	ids := make([]uint32, 64)
+	attr := progQueryAttr{
+		targetFd:   uint32(dirFd),
+		attachType: bpfCgroupDevice,
+		progIds:    uint64(uintptr(unsafe.Pointer(&ids[0]))),
+		progCnt:    uint32(len(ids)),
+	}
+	_, err := bpf(bpfProgQuery, unsafe.Pointer(&attr), unsafe.Sizeof(attr))
+	runtime.KeepAlive(ids)
+	if err != nil {
+		return nil, errors.Wrap(err, "querying attached device filters")
+	}
+
+	var fds []int
+	for _, id := range ids[:attr.progCnt] {
+		idAttr := getFdByIDAttr{id: id}
+		fd, err := bpf(bpfProgGetFdByID, unsafe.Pointer(&idAttr), unsafe.Sizeof(idAttr))
+		if err != nil {
+			closeAll(fds)
+			return nil, errors.Wrapf(err, "getting device filter %d", id)
+		}
+		fds = append(fds, int(fd))
+	}
+	return fds, nil
+}
+
+func closeAll(fds []int) {
+	for _, fd := range fds {
+		unix.Close(fd)
+	}
+}
+
+func attach(dirFd, progFd, replaceFd int) error {
+	attr := progAttachAttr{
+		targetFd:    uint32(dirFd),
+		attachBpfFd: uint32(progFd),
+		attachType:  bpfCgroupDevice,
+		attachFlags: bpfFAllowMulti,
+	}
+	if replaceFd >= 0 {
+		attr.attachFlags |= bpfFReplace
+		attr.replaceBpfFd = uint32(replaceFd)
+	}
+	_, err := bpf(bpfProgAttach, unsafe.Pointer(&attr), unsafe.Sizeof(attr))
+	return err
+}
+
+func detach(dirFd, progFd int) error {
+	attr := progAttachAttr{
+		targetFd:    uint32(dirFd),
+		attachBpfFd: uint32(progFd),
+		attachType:  bpfCgroupDevice,
+	}
+	_, err := bpf(bpfProgDetach, unsafe.Pointer(&attr), unsafe.Sizeof(attr))
+	return err
+}
+
+// LoadAttachCgroupDeviceFilter loads the device filter and attaches it to the
+// cgroup directory dir in place of the device filters already attached.
+//
+// The previous filter is replaced atomically when the kernel supports it
+// (Linux 5.6). Otherwise the new filter is attached before the previous ones
+// are detached: all the filters attached to a cgroup must allow an access,
+// so the container never gets a device it is not allowed in the meantime.
+func LoadAttachCgroupDeviceFilter(insts []Instruction, license string, dir string) error {
+	dirFd, err := unix.Open(dir, unix.O_DIRECTORY|unix.O_RDONLY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return &os.PathError{Op: "open", Path: dir, Err: err}
+	}
+	defer unix.Close(dirFd)
+
+	progFd, err := loadProgram(insts, license)
+	if err != nil {
+		return err
+	}
+	// the attached program is referenced by the cgroup
+	defer unix.Close(progFd)
+
+	old, err := attachedPrograms(dirFd)
+	if err != nil {
+		return err
+	}
+	defer closeAll(old)
+
+	if len(old) == 1 {
+		err := attach(dirFd, progFd, old[0])
+		if err == nil {
+			return nil
+		}
+		if err != unix.EINVAL {
+			return errors.Wrap(err, "replacing device filter")
+		}
+		// BPF_F_REPLACE is not supported.
+	}
+
+	if err := attach(dirFd, progFd, -1); err != nil {
+		return errors.Wrap(err, "attaching device filter")
+	}
+	for _, fd := range old {
+		if err := detach(dirFd, fd); err != nil {
+			return errors.Wrap(err, "detaching previous device filter")
+		}
+	}
+	return nil
+}
@@ -65,7 +65,10 @@ func (s *CpuacctGroup) GetStats(path string, stats *cgroups.Stats) error {
 	stats.CpuStats.CpuUsage.PercpuUsage = percpuUsage
 	stats.CpuStats.CpuUsage.UsageInUsermode = userModeUsage
 	stats.CpuStats.CpuUsage.UsageInKernelmode = kernelModeUsage
-	return nil
+
+	// Kernels tracking the pressure of cgroup v1 hierarchies (psi_v1) have the
+	// pressure files in the cpuacct cgroup.
+	return cgroups.GetPSIStats(path, stats)
 }
 
 // Returns user and kernel usage breakdown in nanoseconds.
@@ -140,6 +140,17 @@ func (s *MemoryGroup) Set(path string, cgroup *configs.Cgroup) error {
 		if err := writeFile(path, "memory.oom_control", "1"); err != nil {
 			return err
 		}
+	} else {
+		// the OOM killer may have been disabled by a previous update
+		disabled, err := oomKillDisabled(path)
+		if err != nil {
+			return err
+		}
+		if disabled {
+			if err := writeFile(path, "memory.oom_control", "0"); err != nil {
+				return err
+			}
+		}
 	}
 	if cgroup.Resources.MemorySwappiness == nil || int64(*cgroup.Resources.MemorySwappiness) == -1 {
 		return nil
@@ -154,6 +165,28 @@ func (s *MemoryGroup) Set(path string, cgroup *configs.Cgroup) error {
 	return nil
 }
 
+// oomKillDisabled returns whether the OOM killer is disabled in the memory
+// cgroup at path.
+func oomKillDisabled(path string) (bool, error) {
+	f, err := os.Open(filepath.Join(path, "memory.oom_control"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		t, v, err := getCgroupParamKeyValue(sc.Text())
+		if err == nil && t == "oom_kill_disable" {
+			return v == 1, nil
+		}
+	}
+	return false, sc.Err()
+}
+
 func (s *MemoryGroup) Remove(d *cgroupData) error {
 	return removePath(d.path("memory"))
 }
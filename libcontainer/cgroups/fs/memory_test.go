@@ -453,3 +453,27 @@ func TestMemorySetOomControl(t *testing.T) {
 		t.Fatalf("Got the wrong value, set memory.oom_control failed.")
 	}
 }
+
+func TestMemorySetOomControlEnable(t *testing.T) {
+	helper := NewCgroupTestUtil("memory", t)
+	defer helper.cleanup()
+
+	// the OOM killer was disabled by a previous update
+	helper.writeFileContents(map[string]string{
+		"memory.oom_control": "oom_kill_disable 1\nunder_oom 0\noom_kill 0\n",
+	})
+
+	helper.CgroupData.config.Resources.OomKillDisable = false
+	memory := &MemoryGroup{}
+	if err := memory.Set(helper.CgroupPath, helper.CgroupData.config); err != nil {
+		t.Fatal(err)
+	}
+
+	value, err := getCgroupParamUint(helper.CgroupPath, "memory.oom_control")
+	if err != nil {
+		t.Fatalf("Failed to parse memory.oom_control - %s", err)
+	}
+	if value != 0 {
+		t.Fatalf("Got the wrong value, enabling the OOM killer failed.")
+	}
+}
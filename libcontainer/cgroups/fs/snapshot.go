@@ -0,0 +1,86 @@
+// +build linux
+
+package fs
+
+import (
+	"strings"
+
+	"github.com/opencontainers/runc/libcontainer/cgroups"
+)
+
+// snapshotFiles are the files of each subsystem that Set may change.
+var snapshotFiles = map[string][]cgroups.SnapshotFile{
+	"cpuset": {
+		{Name: "cpuset.cpus"},
+		{Name: "cpuset.mems"},
+	},
+	"memory": {
+		{Name: cgroupMemoryLimit},
+		{Name: cgroupMemorySwapLimit},
+		{Name: "memory.soft_limit_in_bytes"},
+		{Name: "memory.kmem.tcp.limit_in_bytes"},
+		{Name: "memory.swappiness"},
+		{Name: "memory.oom_control", Value: oomKillDisableValue},
+	},
+	"cpu": {
+		{Name: "cpu.rt_period_us"},
+		{Name: "cpu.rt_runtime_us"},
+		{Name: "cpu.shares"},
+		{Name: "cpu.cfs_period_us"},
+		{Name: "cpu.cfs_quota_us"},
+	},
+	"pids": {
+		{Name: "pids.max"},
+	},
+	"blkio": {
+		{Name: "blkio.weight"},
+		{Name: "blkio.leaf_weight"},
+		{Name: "blkio.weight_device", Keyed: true, Reset: "0"},
+		{Name: "blkio.leaf_weight_device", Keyed: true, Reset: "0"},
+		{Name: "blkio.throttle.read_bps_device", Keyed: true, Reset: "0"},
+		{Name: "blkio.throttle.write_bps_device", Keyed: true, Reset: "0"},
+		{Name: "blkio.throttle.read_iops_device", Keyed: true, Reset: "0"},
+		{Name: "blkio.throttle.write_iops_device", Keyed: true, Reset: "0"},
+	},
+	"hugetlb": {
+		{Name: "hugetlb.*.limit_in_bytes"},
+	},
+	"net_prio": {
+		{Name: "net_prio.ifpriomap", Keyed: true, Reset: "0"},
+	},
+	"net_cls": {
+		{Name: "net_cls.classid"},
+	},
+}
+
+// oomKillDisableValue returns the value of memory.oom_control to write back
+// from its content.
+func oomKillDisableValue(content string) string {
+	for _, line := range strings.Split(content, "\n") {
+		if t, v, err := getCgroupParamKeyValue(line); err == nil && t == "oom_kill_disable" {
+			if v == 1 {
+				return "1"
+			}
+			return "0"
+		}
+	}
+	return strings.TrimSpace(content)
+}
+
+// Snapshot saves the values of the cgroup files that Set may change. The
+// device rules are not saved, they are set again from the config.
+func (m *Manager) Snapshot() (*cgroups.Snapshot, error) {
+	return SnapshotPaths(m.GetPaths())
+}
+
+// SnapshotPaths saves the values of the files of the subsystems at paths that
+// Set may change.
+func SnapshotPaths(paths map[string]string) (*cgroups.Snapshot, error) {
+	s := &cgroups.Snapshot{}
+	for _, sys := range subsystems {
+		if err := s.Add(paths[sys.Name()], snapshotFiles[sys.Name()]); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
@@ -0,0 +1,62 @@
+// +build linux
+
+package fs2
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/opencontainers/runc/libcontainer/cgroups"
+	"github.com/opencontainers/runc/libcontainer/configs"
+)
+
+// cpu.max period used when only the quota is set
+const defaultCpuPeriod uint64 = 100000
+
+func setCpu(dir string, r *configs.Resources) error {
+	if r.CpuShares != 0 {
+		weight := cgroups.ConvertCPUSharesToCgroupV2Value(r.CpuShares)
+		if err := writeFile(dir, "cpu.weight", strconv.FormatUint(weight, 10)); err != nil {
+			return err
+		}
+	}
+
+	if r.CpuQuota != 0 || r.CpuPeriod != 0 {
+		// "max" is the fallback value.
+		quota := "max"
+		if r.CpuQuota > 0 {
+			quota = strconv.FormatInt(r.CpuQuota, 10)
+		}
+
+		period := r.CpuPeriod
+		if period == 0 {
+			period = defaultCpuPeriod
+		}
+
+		if err := writeFile(dir, "cpu.max", fmt.Sprintf("%s %d", quota, period)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func statCpu(dir string, stats *cgroups.Stats) error {
+	values, err := getCgroupParamKeyValues(dir, "cpu.stat")
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	// cgroup v2 reports microseconds, stats are in nanoseconds.
+	stats.CpuStats.CpuUsage.TotalUsage = values["usage_usec"] * 1000
+	stats.CpuStats.CpuUsage.UsageInUsermode = values["user_usec"] * 1000
+	stats.CpuStats.CpuUsage.UsageInKernelmode = values["system_usec"] * 1000
+	stats.CpuStats.ThrottlingData.Periods = values["nr_periods"]
+	stats.CpuStats.ThrottlingData.ThrottledPeriods = values["nr_throttled"]
+	stats.CpuStats.ThrottlingData.ThrottledTime = values["throttled_usec"] * 1000
+	return nil
+}
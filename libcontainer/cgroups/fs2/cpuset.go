@@ -0,0 +1,21 @@
+// +build linux
+
+package fs2
+
+import (
+	"github.com/opencontainers/runc/libcontainer/configs"
+)
+
+func setCpuset(dir string, r *configs.Resources) error {
+	if r.CpusetCpus != "" {
+		if err := writeFile(dir, "cpuset.cpus", r.CpusetCpus); err != nil {
+			return err
+		}
+	}
+	if r.CpusetMems != "" {
+		if err := writeFile(dir, "cpuset.mems", r.CpusetMems); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,28 @@
+// +build linux
+
+package fs2
+
+import (
+	"github.com/opencontainers/runc/libcontainer/cgroups/ebpf"
+	"github.com/opencontainers/runc/libcontainer/configs"
+	"github.com/opencontainers/runc/libcontainer/system"
+)
+
+// setDevices enforces the device rules with an eBPF program, cgroup v2 has no
+// devices.allow and devices.deny files.
+func setDevices(dir string, r *configs.Resources) error {
+	if system.RunningInUserNS() {
+		return nil
+	}
+
+	rules := ebpf.DeviceRules(r)
+	if len(rules) == 0 {
+		return nil
+	}
+
+	insts, err := ebpf.DeviceFilter(rules)
+	if err != nil {
+		return err
+	}
+	return ebpf.LoadAttachCgroupDeviceFilter(insts, "Apache", dir)
+}
@@ -0,0 +1,52 @@
+// +build linux
+
+package fs2
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/opencontainers/runc/libcontainer/configs"
+)
+
+func setFreezer(dir string, r *configs.Resources) error {
+	var value string
+	switch r.Freezer {
+	case configs.Frozen:
+		value = "1"
+	case configs.Thawed:
+		value = "0"
+	case configs.Undefined:
+		return nil
+	default:
+		return fmt.Errorf("Invalid argument '%s' to cgroup.freeze", string(r.Freezer))
+	}
+
+	if err := writeFile(dir, "cgroup.freeze", value); err != nil {
+		return err
+	}
+
+	// freezing is asynchronous, wait for cgroup.events to report it
+	for i := 0; i < 1000; i++ {
+		frozen, err := isFrozen(dir)
+		if err != nil {
+			return err
+		}
+		if frozen == (r.Freezer == configs.Frozen) {
+			return nil
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	return fmt.Errorf("timeout waiting for cgroup to be %s", strings.ToLower(string(r.Freezer)))
+}
+
+// isFrozen reads the frozen state from cgroup.events.
+func isFrozen(dir string) (bool, error) {
+	events, err := getCgroupParamKeyValues(dir, "cgroup.events")
+	if err != nil {
+		return false, err
+	}
+	return events["frozen"] == 1, nil
+}
@@ -0,0 +1,308 @@
+// +build linux
+
+// Package fs2 manages the cgroups of a container on the cgroup v2 unified
+// hierarchy, see https://www.kernel.org/doc/Documentation/cgroup-v2.txt
+package fs2
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/opencontainers/runc/libcontainer/cgroups"
+	"github.com/opencontainers/runc/libcontainer/configs"
+	libcontainerUtils "github.com/opencontainers/runc/libcontainer/utils"
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// unifiedKey is the key of the cgroup path in the paths of the manager, it
+// matches the empty controller list of the unified hierarchy in
+// /proc/<pid>/cgroup.
+const unifiedKey = ""
+
+type Manager struct {
+	mu       sync.Mutex
+	Cgroups  *configs.Cgroup
+	Rootless bool // ignore permission-related errors
+	Paths    map[string]string
+}
+
+// isIgnorableError returns whether err is a permission error (in the loose
+// sense of the word), which are ignored for rootless containers.
+func isIgnorableError(rootless bool, err error) bool {
+	if !rootless {
+		return false
+	}
+	if os.IsPermission(errors.Cause(err)) {
+		return true
+	}
+
+	var errno error
+	switch err := errors.Cause(err).(type) {
+	case *os.PathError:
+		errno = err.Err
+	case *os.SyscallError:
+		errno = err.Err
+	}
+	return errno == unix.EROFS || errno == unix.EPERM || errno == unix.EACCES
+}
+
+// path returns the absolute path of the cgroup of the container.
+func path(c *configs.Cgroup) (string, error) {
+	if c.Paths != nil {
+		p, ok := c.Paths[unifiedKey]
+		if !ok {
+			return "", fmt.Errorf("cgroup: no cgroup v2 path to join")
+		}
+		return p, nil
+	}
+
+	if (c.Name != "" || c.Parent != "") && c.Path != "" {
+		return "", fmt.Errorf("cgroup: either Path or Name and Parent should be used")
+	}
+
+	// XXX: Do not remove this code. Path safety is important! -- cyphar
+	innerPath := libcontainerUtils.CleanPath(c.Path)
+	if innerPath == "" {
+		cgParent := libcontainerUtils.CleanPath(c.Parent)
+		cgName := libcontainerUtils.CleanPath(c.Name)
+		innerPath = filepath.Join(cgParent, cgName)
+	}
+
+	// If the cgroup path is absolute do not look relative to the cgroup of
+	// the current process.
+	if filepath.IsAbs(innerPath) {
+		return filepath.Join(cgroups.UnifiedMountpoint, innerPath), nil
+	}
+
+	ownCgroups, err := cgroups.ParseCgroupFile("/proc/self/cgroup")
+	if err != nil {
+		return "", err
+	}
+	own, ok := ownCgroups[unifiedKey]
+	if !ok {
+		return "", fmt.Errorf("cgroup: no cgroup v2 entry in /proc/self/cgroup")
+	}
+
+	return filepath.Join(cgroups.UnifiedMountpoint, own, innerPath), nil
+}
+
+// enableControllers enables in the children of dir all the controllers
+// available in dir. Errors are ignored: a controller cannot be enabled in a
+// cgroup having processes, setting a limit of that controller then fails.
+func enableControllers(dir string) {
+	controllers, err := readFile(dir, "cgroup.controllers")
+	if err != nil {
+		return
+	}
+	for _, c := range strings.Fields(controllers) {
+		_ = writeFile(dir, "cgroup.subtree_control", "+"+c)
+	}
+}
+
+// createCgroup creates dir, enabling the controllers down from the root of
+// the hierarchy.
+func createCgroup(dir string) error {
+	rel, err := filepath.Rel(cgroups.UnifiedMountpoint, dir)
+	if err != nil {
+		return err
+	}
+	if rel == "." {
+		return nil
+	}
+	if strings.HasPrefix(rel, "..") {
+		return fmt.Errorf("cgroup path %s is not below %s", dir, cgroups.UnifiedMountpoint)
+	}
+
+	current := cgroups.UnifiedMountpoint
+	for _, name := range strings.Split(rel, "/") {
+		enableControllers(current)
+		current = filepath.Join(current, name)
+		if err := os.Mkdir(current, 0755); err != nil && !os.IsExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *Manager) Apply(pid int) error {
+	if m.Cgroups == nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	dir, err := path(m.Cgroups)
+	if err != nil {
+		return err
+	}
+
+	m.Paths = make(map[string]string)
+	if m.Cgroups.Paths == nil {
+		if err := createCgroup(dir); err != nil {
+			// In the case of rootless, where an explicit cgroup path hasn't
+			// been set, we don't bail on error in case of permission problems.
+			if isIgnorableError(m.Rootless, err) && m.Cgroups.Path == "" {
+				return nil
+			}
+			return err
+		}
+	}
+	m.Paths[unifiedKey] = dir
+
+	return cgroups.WriteCgroupProc(dir, pid)
+}
+
+func (m *Manager) Destroy() error {
+	if m.Cgroups == nil || m.Cgroups.Paths != nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := cgroups.RemovePaths(m.Paths); err != nil {
+		return err
+	}
+	m.Paths = make(map[string]string)
+	return nil
+}
+
+func (m *Manager) GetPaths() map[string]string {
+	m.mu.Lock()
+	paths := m.Paths
+	m.mu.Unlock()
+	return paths
+}
+
+func (m *Manager) GetPids() ([]int, error) {
+	return cgroups.GetPids(m.GetPaths()[unifiedKey])
+}
+
+func (m *Manager) GetAllPids() ([]int, error) {
+	return cgroups.GetAllPids(m.GetPaths()[unifiedKey])
+}
+
+func (m *Manager) GetStats() (*cgroups.Stats, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stats := cgroups.NewStats()
+	dir := m.Paths[unifiedKey]
+	if dir == "" || !cgroups.PathExists(dir) {
+		return stats, nil
+	}
+	for _, get := range []func(string, *cgroups.Stats) error{
+		statCpu,
+		statMemory,
+		statPids,
+		statIo,
+		statHugetlb,
+		cgroups.GetPSIStats,
+	} {
+		if err := get(dir, stats); err != nil {
+			return nil, err
+		}
+	}
+	return stats, nil
+}
+
+func (m *Manager) Set(container *configs.Config) error {
+	// If Paths are set, then we are just joining cgroups paths
+	// and there is no need to set any values.
+	if m.Cgroups.Paths != nil {
+		return nil
+	}
+
+	r := container.Cgroups.Resources
+	if err := checkUnsupported(r); err != nil {
+		return err
+	}
+
+	var setters []func(string, *configs.Resources) error
+	// Loading the eBPF device filter needs CAP_SYS_ADMIN in the initial user
+	// namespace, rootless containers can only use the devices of the user.
+	if !m.Rootless {
+		setters = append(setters, setDevices)
+	}
+	setters = append(setters,
+		setCpu,
+		setCpuset,
+		setMemory,
+		setIo,
+		setPids,
+		setHugetlb,
+		setFreezer,
+	)
+
+	dir := m.GetPaths()[unifiedKey]
+	for _, set := range setters {
+		if err := set(dir, r); err != nil {
+			if dir == "" {
+				// We never created a path for the cgroup, so we cannot set
+				// limits for it.
+				return fmt.Errorf("cannot set limits: container could not join or create cgroup")
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// Freeze freezes or thaws the container's cgroup depending on the state
+// provided
+func (m *Manager) Freeze(state configs.FreezerState) error {
+	dir := m.GetPaths()[unifiedKey]
+	prevState := m.Cgroups.Resources.Freezer
+	m.Cgroups.Resources.Freezer = state
+	if err := setFreezer(dir, m.Cgroups.Resources); err != nil {
+		m.Cgroups.Resources.Freezer = prevState
+		return err
+	}
+	return nil
+}
+
+// checkUnsupported rejects the settings of cgroup v1 controllers that have no
+// cgroup v2 equivalent.
+func checkUnsupported(r *configs.Resources) error {
+	var setting string
+	switch {
+	case r.KernelMemory != 0:
+		setting = "kernel memory limit"
+	case r.KernelMemoryTCP != 0:
+		setting = "kernel TCP memory limit"
+	case r.MemorySwappiness != nil && int64(*r.MemorySwappiness) != -1:
+		setting = "memory swappiness"
+	case r.OomKillDisable:
+		setting = "disabling OOM killer"
+	case r.CpuRtRuntime != 0 || r.CpuRtPeriod != 0:
+		setting = "realtime CPU scheduling"
+	case r.BlkioLeafWeight != 0:
+		setting = "blkio leaf weight"
+	case r.NetClsClassid != 0:
+		setting = "net_cls classid"
+	case len(r.NetPrioIfpriomap) > 0:
+		setting = "net_prio ifpriomap"
+	default:
+		return nil
+	}
+	return fmt.Errorf("%s is not supported by cgroup v2", setting)
+}
+
+func writeFile(dir, file, data string) error {
+	// Normally dir should not be empty, one case is that the cgroup could not
+	// be created, we will get empty dir, and we want it fail here.
+	if dir == "" {
+		return fmt.Errorf("no such directory for %s", file)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, file), []byte(data), 0700); err != nil {
+		return fmt.Errorf("failed to write %v to %v: %v", data, file, err)
+	}
+	return nil
+}
+
+func readFile(dir, file string) (string, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, file))
+	return string(data), err
+}
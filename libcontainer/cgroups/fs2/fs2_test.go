@@ -0,0 +1,162 @@
+// +build linux
+
+package fs2
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/runc/libcontainer/cgroups"
+	"github.com/opencontainers/runc/libcontainer/configs"
+)
+
+// newTestManager returns a manager of a mock cgroup directory.
+func newTestManager(t *testing.T, resources *configs.Resources) (*Manager, string) {
+	dir, err := ioutil.TempDir("", "cgroup2_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &Manager{
+		Cgroups: &configs.Cgroup{Resources: resources},
+		Paths:   map[string]string{unifiedKey: dir},
+	}
+	return m, dir
+}
+
+func writeFileContents(t *testing.T, dir string, fileContents map[string]string) {
+	for file, contents := range fileContents {
+		if err := ioutil.WriteFile(filepath.Join(dir, file), []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func checkFileContents(t *testing.T, dir string, fileContents map[string]string) {
+	for file, want := range fileContents {
+		got, err := readFile(dir, file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.TrimSpace(got) != want {
+			t.Errorf("%s: got %q, want %q", file, got, want)
+		}
+	}
+}
+
+func TestSet(t *testing.T) {
+	r := &configs.Resources{
+		CpuShares:         1024,
+		CpuQuota:          50000,
+		Memory:            100 * 1024 * 1024,
+		MemorySwap:        300 * 1024 * 1024,
+		MemoryReservation: -1,
+		PidsLimit:         100,
+		BlkioWeight:       500,
+		BlkioThrottleReadBpsDevice: []*configs.ThrottleDevice{
+			configs.NewThrottleDevice(8, 0, 1024),
+		},
+	}
+	m, dir := newTestManager(t, r)
+	defer os.RemoveAll(dir)
+
+	if err := m.Set(&configs.Config{Cgroups: m.Cgroups}); err != nil {
+		t.Fatal(err)
+	}
+
+	checkFileContents(t, dir, map[string]string{
+		"cpu.weight":      "39",
+		"cpu.max":         "50000 100000",
+		"memory.max":      "104857600",
+		"memory.swap.max": "209715200",
+		"memory.low":      "max",
+		"pids.max":        "100",
+		"io.weight":       "default 4950",
+		"io.max":          "8:0 rbps=1024",
+	})
+}
+
+func TestSetUnsupported(t *testing.T) {
+	m, dir := newTestManager(t, &configs.Resources{KernelMemory: 1024})
+	defer os.RemoveAll(dir)
+
+	if err := m.Set(&configs.Config{Cgroups: m.Cgroups}); err == nil {
+		t.Fatal("expected an error setting a kernel memory limit")
+	}
+}
+
+func TestSetRootlessSkipsDevices(t *testing.T) {
+	r := &configs.Resources{
+		Devices: []*configs.Device{
+			{Type: 'a', Major: configs.Wildcard, Minor: configs.Wildcard, Permissions: "rwm", Allow: false},
+		},
+		PidsLimit: 10,
+	}
+	m, dir := newTestManager(t, r)
+	defer os.RemoveAll(dir)
+
+	// the device filter cannot be attached to the mock cgroup directory
+	if err := m.Set(&configs.Config{Cgroups: m.Cgroups}); err == nil {
+		t.Fatal("expected the device filter to fail")
+	}
+	m.Rootless = true
+	if err := m.Set(&configs.Config{Cgroups: m.Cgroups}); err != nil {
+		t.Fatal(err)
+	}
+	checkFileContents(t, dir, map[string]string{"pids.max": "10"})
+}
+
+func TestStatCpu(t *testing.T) {
+	m, dir := newTestManager(t, &configs.Resources{})
+	defer os.RemoveAll(dir)
+
+	writeFileContents(t, dir, map[string]string{
+		"cpu.stat": "usage_usec 100\nuser_usec 60\nsystem_usec 40\nnr_periods 10\nnr_throttled 2\nthrottled_usec 5\n",
+	})
+
+	stats, err := m.GetStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cpu := stats.CpuStats
+	if cpu.CpuUsage.TotalUsage != 100000 || cpu.CpuUsage.UsageInUsermode != 60000 || cpu.CpuUsage.UsageInKernelmode != 40000 {
+		t.Errorf("unexpected cpu usage %+v", cpu.CpuUsage)
+	}
+	expected := cgroups.ThrottlingData{Periods: 10, ThrottledPeriods: 2, ThrottledTime: 5000}
+	if cpu.ThrottlingData != expected {
+		t.Errorf("got throttling data %+v, want %+v", cpu.ThrottlingData, expected)
+	}
+}
+
+func TestStatIo(t *testing.T) {
+	m, dir := newTestManager(t, &configs.Resources{})
+	defer os.RemoveAll(dir)
+
+	writeFileContents(t, dir, map[string]string{
+		"io.stat": "8:0 rbytes=1024 wbytes=2048 rios=1 wios=2 dbytes=0 dios=0\n",
+	})
+
+	stats, err := m.GetStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedBytes := []cgroups.BlkioStatEntry{
+		{Major: 8, Minor: 0, Op: "Read", Value: 1024},
+		{Major: 8, Minor: 0, Op: "Write", Value: 2048},
+	}
+	if !reflect.DeepEqual(stats.BlkioStats.IoServiceBytesRecursive, expectedBytes) {
+		t.Errorf("got io bytes %+v, want %+v", stats.BlkioStats.IoServiceBytesRecursive, expectedBytes)
+	}
+	expectedIos := []cgroups.BlkioStatEntry{
+		{Major: 8, Minor: 0, Op: "Read", Value: 1},
+		{Major: 8, Minor: 0, Op: "Write", Value: 2},
+	}
+	if !reflect.DeepEqual(stats.BlkioStats.IoServicedRecursive, expectedIos) {
+		t.Errorf("got io ops %+v, want %+v", stats.BlkioStats.IoServicedRecursive, expectedIos)
+	}
+}
@@ -0,0 +1,42 @@
+// +build linux
+
+package fs2
+
+import (
+	"os"
+	"strconv"
+
+	"github.com/opencontainers/runc/libcontainer/cgroups"
+	"github.com/opencontainers/runc/libcontainer/configs"
+)
+
+var hugePageSizes, _ = cgroups.GetHugePageSize()
+
+func setHugetlb(dir string, r *configs.Resources) error {
+	for _, hugetlb := range r.HugetlbLimit {
+		if err := writeFile(dir, "hugetlb."+hugetlb.Pagesize+".max", strconv.FormatUint(hugetlb.Limit, 10)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func statHugetlb(dir string, stats *cgroups.Stats) error {
+	for _, pageSize := range hugePageSizes {
+		prefix := "hugetlb." + pageSize
+		usage, err := getCgroupParamUint(dir, prefix+".current")
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return err
+		}
+
+		hugetlbStats := cgroups.HugetlbStats{Usage: usage}
+		if events, err := getCgroupParamKeyValues(dir, prefix+".events"); err == nil {
+			hugetlbStats.Failcnt = events["max"]
+		}
+		stats.HugetlbStats[pageSize] = hugetlbStats
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+// +build linux
+
+package fs2
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/opencontainers/runc/libcontainer/cgroups"
+	"github.com/opencontainers/runc/libcontainer/configs"
+)
+
+func setIo(dir string, r *configs.Resources) error {
+	if r.BlkioWeight != 0 {
+		weight := cgroups.ConvertBlkIOToCgroupV2Value(r.BlkioWeight)
+		if err := writeFile(dir, "io.weight", fmt.Sprintf("default %d", weight)); err != nil {
+			return err
+		}
+	}
+
+	for _, wd := range r.BlkioWeightDevice {
+		weight := cgroups.ConvertBlkIOToCgroupV2Value(wd.Weight)
+		if weight == 0 {
+			continue
+		}
+		if err := writeFile(dir, "io.weight", fmt.Sprintf("%d:%d %d", wd.Major, wd.Minor, weight)); err != nil {
+			return err
+		}
+	}
+
+	throttles := []struct {
+		key     string
+		devices []*configs.ThrottleDevice
+	}{
+		{"rbps", r.BlkioThrottleReadBpsDevice},
+		{"wbps", r.BlkioThrottleWriteBpsDevice},
+		{"riops", r.BlkioThrottleReadIOPSDevice},
+		{"wiops", r.BlkioThrottleWriteIOPSDevice},
+	}
+	for _, t := range throttles {
+		for _, td := range t.devices {
+			// a zero rate removes the limit
+			rate := "max"
+			if td.Rate != 0 {
+				rate = strconv.FormatUint(td.Rate, 10)
+			}
+			if err := writeFile(dir, "io.max", fmt.Sprintf("%d:%d %s=%s", td.Major, td.Minor, t.key, rate)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// statIo parses io.stat, made of lines like
+//  8:0 rbytes=1459200 wbytes=314773504 rios=192 wios=353 dbytes=0 dios=0
+func statIo(dir string, stats *cgroups.Stats) error {
+	f, err := os.Open(filepath.Join(dir, "io.stat"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		var major, minor uint64
+		if _, err := fmt.Sscanf(fields[0], "%d:%d", &major, &minor); err != nil {
+			return fmt.Errorf("invalid device %q in io.stat", fields[0])
+		}
+
+		for _, kv := range fields[1:] {
+			parts := strings.SplitN(kv, "=", 2)
+			if len(parts) != 2 {
+				return fmt.Errorf("invalid entry %q in io.stat", kv)
+			}
+			value, err := parseUint(parts[1], 10, 64)
+			if err != nil {
+				return fmt.Errorf("unable to convert io.stat value (%q) to uint64: %v", parts[1], err)
+			}
+
+			entry := cgroups.BlkioStatEntry{Major: major, Minor: minor, Value: value}
+			switch parts[0] {
+			case "rbytes":
+				entry.Op = "Read"
+				stats.BlkioStats.IoServiceBytesRecursive = append(stats.BlkioStats.IoServiceBytesRecursive, entry)
+			case "wbytes":
+				entry.Op = "Write"
+				stats.BlkioStats.IoServiceBytesRecursive = append(stats.BlkioStats.IoServiceBytesRecursive, entry)
+			case "rios":
+				entry.Op = "Read"
+				stats.BlkioStats.IoServicedRecursive = append(stats.BlkioStats.IoServicedRecursive, entry)
+			case "wios":
+				entry.Op = "Write"
+				stats.BlkioStats.IoServicedRecursive = append(stats.BlkioStats.IoServicedRecursive, entry)
+			}
+		}
+	}
+	return sc.Err()
+}
@@ -0,0 +1,117 @@
+// +build linux
+
+package fs2
+
+import (
+	"math"
+	"os"
+	"strconv"
+
+	"github.com/opencontainers/runc/libcontainer/cgroups"
+	"github.com/opencontainers/runc/libcontainer/configs"
+)
+
+// limitString formats a memory limit, -1 being no limit.
+func limitString(limit int64) string {
+	if limit == -1 {
+		return "max"
+	}
+	return strconv.FormatInt(limit, 10)
+}
+
+func setMemory(dir string, r *configs.Resources) error {
+	if r.MemorySwap != 0 {
+		swap, err := cgroups.ConvertMemorySwapToCgroupV2Value(r.MemorySwap, r.Memory)
+		if err != nil {
+			return err
+		}
+		if err := writeFile(dir, "memory.swap.max", limitString(swap)); err != nil {
+			return err
+		}
+	}
+
+	if r.Memory != 0 {
+		if err := writeFile(dir, "memory.max", limitString(r.Memory)); err != nil {
+			return err
+		}
+	}
+
+	// the soft limit is the best-effort protection of cgroup v2
+	if r.MemoryReservation != 0 {
+		if err := writeFile(dir, "memory.low", limitString(r.MemoryReservation)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func statMemory(dir string, stats *cgroups.Stats) error {
+	values, err := getCgroupParamKeyValues(dir, "memory.stat")
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	for k, v := range values {
+		stats.MemoryStats.Stats[k] = v
+	}
+	stats.MemoryStats.Cache = values["file"]
+	// cgroup v2 is always hierarchical
+	stats.MemoryStats.UseHierarchy = true
+
+	usage, err := getMemoryData(dir, "memory")
+	if err != nil {
+		return err
+	}
+	stats.MemoryStats.Usage = usage
+
+	swap, err := getMemoryData(dir, "memory.swap")
+	if err != nil {
+		return err
+	}
+	// cgroup v1 reports memory+swap, keep that for compatibility
+	swap.Usage += usage.Usage
+	if swap.Limit != math.MaxUint64 && usage.Limit != math.MaxUint64 {
+		swap.Limit += usage.Limit
+	} else {
+		swap.Limit = math.MaxUint64
+	}
+	stats.MemoryStats.SwapUsage = swap
+
+	return nil
+}
+
+// getMemoryData reads the usage, limit and limit hits of the memory or
+// memory.swap files.
+func getMemoryData(dir, name string) (cgroups.MemoryData, error) {
+	data := cgroups.MemoryData{}
+
+	usage, err := getCgroupParamUint(dir, name+".current")
+	if err != nil {
+		// no swap accounting
+		if os.IsNotExist(err) && name != "memory" {
+			return data, nil
+		}
+		return data, err
+	}
+	data.Usage = usage
+
+	limit, err := getCgroupParamUint(dir, name+".max")
+	if err != nil {
+		return data, err
+	}
+	data.Limit = limit
+
+	// memory.peak is only available since Linux 5.19
+	if peak, err := getCgroupParamUint(dir, name+".peak"); err == nil {
+		data.MaxUsage = peak
+	}
+
+	if events, err := getCgroupParamKeyValues(dir, name+".events"); err == nil {
+		data.Failcnt = events["max"]
+	}
+
+	return data, nil
+}
@@ -0,0 +1,52 @@
+// +build linux
+
+package fs2
+
+import (
+	"math"
+	"os"
+	"strconv"
+
+	"github.com/opencontainers/runc/libcontainer/cgroups"
+	"github.com/opencontainers/runc/libcontainer/configs"
+)
+
+func setPids(dir string, r *configs.Resources) error {
+	if r.PidsLimit != 0 {
+		// "max" is the fallback value.
+		limit := "max"
+
+		if r.PidsLimit > 0 {
+			limit = strconv.FormatInt(r.PidsLimit, 10)
+		}
+
+		if err := writeFile(dir, "pids.max", limit); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func statPids(dir string, stats *cgroups.Stats) error {
+	current, err := getCgroupParamUint(dir, "pids.current")
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	max, err := getCgroupParamUint(dir, "pids.max")
+	if err != nil {
+		return err
+	}
+	// Default if pids.max == "max" is 0 -- which represents "no limit".
+	if max == math.MaxUint64 {
+		max = 0
+	}
+
+	stats.PidsStats.Current = current
+	stats.PidsStats.Limit = max
+	return nil
+}
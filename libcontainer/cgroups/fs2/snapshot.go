@@ -0,0 +1,32 @@
+// +build linux
+
+package fs2
+
+import (
+	"github.com/opencontainers/runc/libcontainer/cgroups"
+)
+
+// snapshotFiles are the files of the cgroup that Set may change.
+var snapshotFiles = []cgroups.SnapshotFile{
+	{Name: "cpu.weight"},
+	{Name: "cpu.max"},
+	{Name: "cpuset.cpus"},
+	{Name: "cpuset.mems"},
+	{Name: "memory.swap.max"},
+	{Name: "memory.max"},
+	{Name: "memory.low"},
+	{Name: "io.weight", Keyed: true, Reset: "default"},
+	{Name: "io.max", Keyed: true, Reset: "rbps=max wbps=max riops=max wiops=max"},
+	{Name: "pids.max"},
+	{Name: "hugetlb.*.max"},
+}
+
+// Snapshot saves the values of the cgroup files that Set may change. The
+// device filter is not saved, it is set again from the config.
+func (m *Manager) Snapshot() (*cgroups.Snapshot, error) {
+	s := &cgroups.Snapshot{}
+	if err := s.Add(m.GetPaths()[unifiedKey], snapshotFiles); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
@@ -0,0 +1,81 @@
+// +build linux
+
+package fs2
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Saturates negative values at zero and returns a uint64.
+func parseUint(s string, base, bitSize int) (uint64, error) {
+	value, err := strconv.ParseUint(s, base, bitSize)
+	if err != nil {
+		intValue, intErr := strconv.ParseInt(s, base, bitSize)
+		// 1. Handle negative values greater than MinInt64 (and)
+		// 2. Handle negative values lesser than MinInt64
+		if intErr == nil && intValue < 0 {
+			return 0, nil
+		} else if intErr != nil && intErr.(*strconv.NumError).Err == strconv.ErrRange && intValue < 0 {
+			return 0, nil
+		}
+
+		return value, err
+	}
+
+	return value, nil
+}
+
+// parseLimit parses the value of a cgroup v2 limit file, "max" being no
+// limit.
+func parseLimit(s string) (uint64, error) {
+	if s == "max" {
+		return math.MaxUint64, nil
+	}
+	return parseUint(s, 10, 64)
+}
+
+// Gets a single uint64 value from the specified cgroup file, "max" is
+// returned as math.MaxUint64.
+func getCgroupParamUint(cgroupPath, cgroupFile string) (uint64, error) {
+	contents, err := readFile(cgroupPath, cgroupFile)
+	if err != nil {
+		return 0, err
+	}
+
+	res, err := parseLimit(strings.TrimSpace(contents))
+	if err != nil {
+		return res, fmt.Errorf("unable to parse %q as a uint from Cgroup file %q", contents, filepath.Join(cgroupPath, cgroupFile))
+	}
+	return res, nil
+}
+
+// getCgroupParamKeyValues reads a flat keyed cgroup file such as cpu.stat,
+// made of "key value" lines.
+func getCgroupParamKeyValues(cgroupPath, cgroupFile string) (map[string]uint64, error) {
+	f, err := os.Open(filepath.Join(cgroupPath, cgroupFile))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	values := make(map[string]uint64)
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		parts := strings.Fields(sc.Text())
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid line %q in Cgroup file %q", sc.Text(), cgroupFile)
+		}
+		value, err := parseUint(parts[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("unable to convert param value (%q) to uint64: %v", parts[1], err)
+		}
+		values[parts[0]] = value
+	}
+	return values, sc.Err()
+}
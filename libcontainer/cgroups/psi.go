@@ -0,0 +1,120 @@
+// +build linux
+
+package cgroups
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// Resources having pressure stall information, the files are named
+// <resource>.pressure.
+const (
+	PSICpu    = "cpu"
+	PSIMemory = "memory"
+	PSIIo     = "io"
+)
+
+// PSIFile returns the name of the pressure stall information file of resource.
+func PSIFile(resource string) string {
+	return resource + ".pressure"
+}
+
+// ReadPSI reads the pressure stall information of resource in the cgroup dir.
+// nil is returned when the kernel does not track the pressure of the cgroup:
+// the file is missing, or PSI is disabled and reading it fails.
+func ReadPSI(dir, resource string) (*PSIStats, error) {
+	f, err := os.Open(filepath.Join(dir, PSIFile(resource)))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	psi, err := ParsePSI(f)
+	if err != nil {
+		if pathErr, ok := err.(*os.PathError); ok && pathErr.Err == unix.EOPNOTSUPP {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to parse %s: %v", f.Name(), err)
+	}
+	return psi, nil
+}
+
+// ParsePSI parses pressure stall information made of lines like
+//  some avg10=0.00 avg60=0.00 avg300=0.00 total=0
+//  full avg10=0.00 avg60=0.00 avg300=0.00 total=0
+func ParsePSI(r io.Reader) (*PSIStats, error) {
+	psi := &PSIStats{}
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		var data *PSIData
+		switch fields[0] {
+		case "some":
+			data = &psi.Some
+		case "full":
+			data = &psi.Full
+		default:
+			continue
+		}
+
+		for _, kv := range fields[1:] {
+			parts := strings.SplitN(kv, "=", 2)
+			if len(parts) != 2 {
+				return nil, fmt.Errorf("invalid entry %q", kv)
+			}
+			var err error
+			switch parts[0] {
+			case "avg10":
+				data.Avg10, err = strconv.ParseFloat(parts[1], 64)
+			case "avg60":
+				data.Avg60, err = strconv.ParseFloat(parts[1], 64)
+			case "avg300":
+				data.Avg300, err = strconv.ParseFloat(parts[1], 64)
+			case "total":
+				data.Total, err = strconv.ParseUint(parts[1], 10, 64)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("invalid entry %q: %v", kv, err)
+			}
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return psi, nil
+}
+
+// GetPSIStats fills the cpu, memory and io pressure stall information of the
+// cgroup dir in stats.
+func GetPSIStats(dir string, stats *Stats) error {
+	for _, p := range []struct {
+		resource string
+		psi      **PSIStats
+	}{
+		{PSICpu, &stats.CpuStats.PSI},
+		{PSIMemory, &stats.MemoryStats.PSI},
+		{PSIIo, &stats.BlkioStats.PSI},
+	} {
+		psi, err := ReadPSI(dir, p.resource)
+		if err != nil {
+			return err
+		}
+		*p.psi = psi
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+// +build linux
+
+package cgroups
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParsePSI(t *testing.T) {
+	data := `some avg10=1.50 avg60=0.25 avg300=0.00 total=1234
+full avg10=0.10 avg60=0.00 avg300=0.00 total=56
+`
+	psi, err := ParsePSI(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := PSIStats{
+		Some: PSIData{Avg10: 1.5, Avg60: 0.25, Avg300: 0, Total: 1234},
+		Full: PSIData{Avg10: 0.1, Avg60: 0, Avg300: 0, Total: 56},
+	}
+	if *psi != expected {
+		t.Fatalf("got %+v, want %+v", *psi, expected)
+	}
+}
+
+func TestParsePSIInvalid(t *testing.T) {
+	if _, err := ParsePSI(strings.NewReader("some avg10=abc total=1\n")); err == nil {
+		t.Fatal("expected an error for an invalid average")
+	}
+}
+
+func TestGetPSIStats(t *testing.T) {
+	dir, err := ioutil.TempDir("", "psi_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// only the memory pressure is tracked
+	if err := ioutil.WriteFile(filepath.Join(dir, "memory.pressure"), []byte("some avg10=0.00 avg60=0.00 avg300=0.00 total=10\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	stats := NewStats()
+	if err := GetPSIStats(dir, stats); err != nil {
+		t.Fatal(err)
+	}
+	if stats.CpuStats.PSI != nil || stats.BlkioStats.PSI != nil {
+		t.Fatal("expected no cpu and io pressure")
+	}
+	if stats.MemoryStats.PSI == nil || stats.MemoryStats.PSI.Some.Total != 10 {
+		t.Fatalf("unexpected memory pressure %+v", stats.MemoryStats.PSI)
+	}
+}
@@ -0,0 +1,148 @@
+// +build linux
+
+package cgroups
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SnapshotFile describes a file saved by a Snapshot.
+type SnapshotFile struct {
+	// Name of the file, or a glob pattern matching the names of files.
+	Name string
+
+	// Keyed is set for the files having a line per key, such as a device or
+	// a network interface, where a write only changes the line of its key.
+	// The lines of the keys missing from the snapshot are set to Reset.
+	Keyed bool
+	Reset string
+
+	// Value returns the value to write back from the content of the file,
+	// the content is written back when it is nil.
+	Value func(content string) string
+}
+
+func (f *SnapshotFile) value(content string) string {
+	if f.Value != nil {
+		return f.Value(content)
+	}
+	return strings.TrimSpace(content)
+}
+
+type savedFile struct {
+	*SnapshotFile
+	path    string
+	content string
+}
+
+// Snapshot is the saved content of cgroup files, written back when an update
+// of the cgroup fails.
+type Snapshot struct {
+	files []savedFile
+}
+
+// Add saves the content of the files in dir. The files missing, because the
+// kernel does not have them, are skipped.
+func (s *Snapshot) Add(dir string, files []SnapshotFile) error {
+	if dir == "" {
+		return nil
+	}
+	for i := range files {
+		f := &files[i]
+		paths, err := filepath.Glob(filepath.Join(dir, f.Name))
+		if err != nil {
+			return err
+		}
+		for _, path := range paths {
+			content, err := ioutil.ReadFile(path)
+			if err != nil {
+				if os.IsNotExist(err) {
+					continue
+				}
+				return err
+			}
+			s.files = append(s.files, savedFile{SnapshotFile: f, path: path, content: string(content)})
+		}
+	}
+	return nil
+}
+
+// Restore writes back the content of the files that changed since they were
+// saved. The writes failing are retried once the others are done, as some
+// values are only valid together, such as the memory and memory+swap limits.
+func (s *Snapshot) Restore() error {
+	var pending []savedFile
+	for _, f := range s.files {
+		if err := f.restore(); err != nil {
+			pending = append(pending, f)
+		}
+	}
+	var errs []string
+	for _, f := range pending {
+		if err := f.restore(); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to restore cgroup files: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func (f *savedFile) restore() error {
+	content, err := ioutil.ReadFile(f.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			// the cgroup is gone
+			return nil
+		}
+		return err
+	}
+	if !f.Keyed {
+		if value := f.value(f.content); value != f.value(string(content)) {
+			return f.write(value)
+		}
+		return nil
+	}
+
+	saved, current := keyedLines(f.content), keyedLines(string(content))
+	for key, line := range current {
+		if _, ok := saved[key]; !ok {
+			if err := f.write(key + " " + f.Reset); err != nil {
+				return err
+			}
+		} else if saved[key] == line {
+			delete(saved, key)
+		}
+	}
+	for _, line := range saved {
+		if err := f.write(line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *savedFile) write(data string) error {
+	if err := ioutil.WriteFile(f.path, []byte(data), 0700); err != nil {
+		return fmt.Errorf("failed to write %v to %v: %v", data, filepath.Base(f.path), err)
+	}
+	return nil
+}
+
+// keyedLines returns the lines of content by their first field.
+func keyedLines(content string) map[string]string {
+	lines := make(map[string]string)
+	for _, line := range strings.Split(content, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		lines[fields[0]] = strings.Join(fields, " ")
+	}
+	return lines
+}
@@ -0,0 +1,75 @@
+// +build linux
+
+package cgroups
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSnapshotRestore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "testsnapshot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	write := func(file, data string) {
+		if err := ioutil.WriteFile(filepath.Join(dir, file), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	read := func(file string) string {
+		data, err := ioutil.ReadFile(filepath.Join(dir, file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	write("cpu.max", "max 100000\n")
+	write("hugetlb.2MB.max", "max\n")
+	write("oom_control", "oom_kill_disable 0\nunder_oom 0\n")
+	write("io.max", "8:0 rbps=1024 wbps=max riops=max wiops=max\n")
+	write("ifpriomap", "")
+	s := &Snapshot{}
+	if err := s.Add(dir, []SnapshotFile{
+		{Name: "cpu.max"},
+		{Name: "hugetlb.*.max"},
+		{Name: "memory.max"}, // missing
+		{Name: "oom_control", Value: func(content string) string {
+			return strings.Fields(content)[1]
+		}},
+		{Name: "io.max", Keyed: true, Reset: "rbps=max wbps=max riops=max wiops=max"},
+		{Name: "ifpriomap", Keyed: true, Reset: "0"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	write("cpu.max", "50000 100000\n")
+	write("hugetlb.2MB.max", "1073741824\n")
+	write("oom_control", "oom_kill_disable 1\nunder_oom 0\n")
+	write("io.max", "8:0 rbps=2048 wbps=max riops=max wiops=max\n")
+	write("ifpriomap", "eth0 5\n")
+	if err := s.Restore(); err != nil {
+		t.Fatal(err)
+	}
+
+	for file, expected := range map[string]string{
+		"cpu.max":         "max 100000",
+		"hugetlb.2MB.max": "max",
+		"oom_control":     "0",
+		"io.max":          "8:0 rbps=1024 wbps=max riops=max wiops=max",
+		"ifpriomap":       "eth0 0",
+	} {
+		if got := read(file); got != expected {
+			t.Errorf("expected %s to be restored to %q, got %q", file, expected, got)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "memory.max")); !os.IsNotExist(err) {
+		t.Errorf("expected memory.max not to be created: %v", err)
+	}
+}
@@ -28,9 +28,30 @@ type CpuUsage struct {
 	UsageInUsermode uint64 `json:"usage_in_usermode"`
 }
 
+// PSIData is a line of a pressure stall information file.
+type PSIData struct {
+	// Share of the time some (or all) tasks were stalled over the last 10,
+	// 60 and 300 seconds, in percents.
+	Avg10  float64 `json:"avg10"`
+	Avg60  float64 `json:"avg60"`
+	Avg300 float64 `json:"avg300"`
+	// Total stall time.
+	// Units: microseconds.
+	Total uint64 `json:"total"`
+}
+
+// PSIStats is the pressure stall information of a resource.
+type PSIStats struct {
+	// Time some tasks were stalled on the resource.
+	Some PSIData `json:"some,omitempty"`
+	// Time all non-idle tasks were stalled on the resource at once.
+	Full PSIData `json:"full,omitempty"`
+}
+
 type CpuStats struct {
 	CpuUsage       CpuUsage       `json:"cpu_usage,omitempty"`
 	ThrottlingData ThrottlingData `json:"throttling_data,omitempty"`
+	PSI            *PSIStats      `json:"psi,omitempty"`
 }
 
 type MemoryData struct {
@@ -55,6 +76,7 @@ type MemoryStats struct {
 	UseHierarchy bool `json:"use_hierarchy"`
 
 	Stats map[string]uint64 `json:"stats,omitempty"`
+	PSI   *PSIStats         `json:"psi,omitempty"`
 }
 
 type PidsStats struct {
@@ -81,6 +103,7 @@ type BlkioStats struct {
 	IoMergedRecursive       []BlkioStatEntry `json:"io_merged_recursive,omitempty"`
 	IoTimeRecursive         []BlkioStatEntry `json:"io_time_recursive,omitempty"`
 	SectorsRecursive        []BlkioStatEntry `json:"sectors_recursive,omitempty"`
+	PSI                     *PSIStats        `json:"psi,omitempty"`
 }
 
 type HugetlbStats struct {
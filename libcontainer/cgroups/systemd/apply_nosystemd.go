@@ -46,6 +46,10 @@ func (m *Manager) Set(container *configs.Config) error {
 	return fmt.Errorf("Systemd not supported")
 }
 
+func (m *Manager) Snapshot() (*cgroups.Snapshot, error) {
+	return nil, fmt.Errorf("Systemd not supported")
+}
+
 func (m *Manager) Freeze(state configs.FreezerState) error {
 	return fmt.Errorf("Systemd not supported")
 }
@@ -53,3 +57,49 @@ func (m *Manager) Freeze(state configs.FreezerState) error {
 func Freeze(c *configs.Cgroup, state configs.FreezerState) error {
 	return fmt.Errorf("Systemd not supported")
 }
+
+type UnifiedManager struct {
+	Cgroups  *configs.Cgroup
+	Rootless bool
+	Paths    map[string]string
+}
+
+func UseSystemdUser() bool {
+	return false
+}
+
+func (m *UnifiedManager) Apply(pid int) error {
+	return fmt.Errorf("Systemd not supported")
+}
+
+func (m *UnifiedManager) GetPids() ([]int, error) {
+	return nil, fmt.Errorf("Systemd not supported")
+}
+
+func (m *UnifiedManager) GetAllPids() ([]int, error) {
+	return nil, fmt.Errorf("Systemd not supported")
+}
+
+func (m *UnifiedManager) Destroy() error {
+	return fmt.Errorf("Systemd not supported")
+}
+
+func (m *UnifiedManager) GetPaths() map[string]string {
+	return nil
+}
+
+func (m *UnifiedManager) GetStats() (*cgroups.Stats, error) {
+	return nil, fmt.Errorf("Systemd not supported")
+}
+
+func (m *UnifiedManager) Set(container *configs.Config) error {
+	return fmt.Errorf("Systemd not supported")
+}
+
+func (m *UnifiedManager) Snapshot() (*cgroups.Snapshot, error) {
+	return nil, fmt.Errorf("Systemd not supported")
+}
+
+func (m *UnifiedManager) Freeze(state configs.FreezerState) error {
+	return fmt.Errorf("Systemd not supported")
+}
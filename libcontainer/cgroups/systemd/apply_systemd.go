@@ -6,7 +6,6 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
-	"math"
 	"os"
 	"path/filepath"
 	"strings"
@@ -19,7 +18,6 @@ import (
 	"github.com/opencontainers/runc/libcontainer/cgroups"
 	"github.com/opencontainers/runc/libcontainer/cgroups/fs"
 	"github.com/opencontainers/runc/libcontainer/configs"
-	"github.com/sirupsen/logrus"
 )
 
 type Manager struct {
@@ -74,6 +72,7 @@ const (
 var (
 	connLock                   sync.Mutex
 	theConn                    *systemdDbus.Conn
+	featuresOnce               sync.Once
 	hasStartTransientUnit      bool
 	hasStartTransientSliceUnit bool
 	hasDelegateSlice           bool
@@ -100,75 +99,78 @@ func UseSystemd() bool {
 		if err != nil {
 			return false
 		}
+		featuresOnce.Do(func() { detectFeatures(theConn) })
+	}
+	return hasStartTransientUnit
+}
 
-		// Assume we have StartTransientUnit
-		hasStartTransientUnit = true
+// detectFeatures finds the features of systemd the managers depend on, with
+// any connection to it.
+func detectFeatures(conn *systemdDbus.Conn) {
+	// Assume we have StartTransientUnit
+	hasStartTransientUnit = true
 
-		// But if we get UnknownMethod error we don't
-		if _, err := theConn.StartTransientUnit("test.scope", "invalid", nil, nil); err != nil {
-			if dbusError, ok := err.(dbus.Error); ok {
-				if dbusError.Name == "org.freedesktop.DBus.Error.UnknownMethod" {
-					hasStartTransientUnit = false
-					return hasStartTransientUnit
-				}
+	// But if we get UnknownMethod error we don't
+	if _, err := conn.StartTransientUnit("test.scope", "invalid", nil, nil); err != nil {
+		if dbusError, ok := err.(dbus.Error); ok {
+			if dbusError.Name == "org.freedesktop.DBus.Error.UnknownMethod" {
+				hasStartTransientUnit = false
+				return
 			}
 		}
+	}
 
-		// Assume we have the ability to start a transient unit as a slice
-		// This was broken until systemd v229, but has been back-ported on RHEL environments >= 219
-		// For details, see: https://bugzilla.redhat.com/show_bug.cgi?id=1370299
-		hasStartTransientSliceUnit = true
+	// Assume we have the ability to start a transient unit as a slice
+	// This was broken until systemd v229, but has been back-ported on RHEL environments >= 219
+	// For details, see: https://bugzilla.redhat.com/show_bug.cgi?id=1370299
+	hasStartTransientSliceUnit = true
 
-		// To ensure simple clean-up, we create a slice off the root with no hierarchy
-		slice := fmt.Sprintf("libcontainer_%d_systemd_test_default.slice", os.Getpid())
-		if _, err := theConn.StartTransientUnit(slice, "replace", nil, nil); err != nil {
-			if _, ok := err.(dbus.Error); ok {
-				hasStartTransientSliceUnit = false
-			}
+	// To ensure simple clean-up, we create a slice off the root with no hierarchy
+	slice := fmt.Sprintf("libcontainer_%d_systemd_test_default.slice", os.Getpid())
+	if _, err := conn.StartTransientUnit(slice, "replace", nil, nil); err != nil {
+		if _, ok := err.(dbus.Error); ok {
+			hasStartTransientSliceUnit = false
 		}
+	}
 
-		for i := 0; i <= testSliceWait; i++ {
-			if _, err := theConn.StopUnit(slice, "replace", nil); err != nil {
-				if dbusError, ok := err.(dbus.Error); ok {
-					if strings.Contains(dbusError.Name, "org.freedesktop.systemd1.NoSuchUnit") {
-						hasStartTransientSliceUnit = false
-						break
-					}
+	for i := 0; i <= testSliceWait; i++ {
+		if _, err := conn.StopUnit(slice, "replace", nil); err != nil {
+			if dbusError, ok := err.(dbus.Error); ok {
+				if strings.Contains(dbusError.Name, "org.freedesktop.systemd1.NoSuchUnit") {
+					hasStartTransientSliceUnit = false
+					break
 				}
-			} else {
-				break
 			}
-			time.Sleep(time.Millisecond)
+		} else {
+			break
 		}
+		time.Sleep(time.Millisecond)
+	}
 
-		// Not critical because of the stop unit logic above.
-		theConn.StopUnit(slice, "replace", nil)
+	// Not critical because of the stop unit logic above.
+	conn.StopUnit(slice, "replace", nil)
 
-		// Assume StartTransientUnit on a slice allows Delegate
-		hasDelegateSlice = true
-		dlSlice := newProp("Delegate", true)
-		if _, err := theConn.StartTransientUnit(slice, "replace", []systemdDbus.Property{dlSlice}, nil); err != nil {
-			if dbusError, ok := err.(dbus.Error); ok {
-				// Starting with systemd v237, Delegate is not even a property of slices anymore,
-				// so the D-Bus call fails with "InvalidArgs" error.
-				if strings.Contains(dbusError.Name, "org.freedesktop.DBus.Error.PropertyReadOnly") || strings.Contains(dbusError.Name, "org.freedesktop.DBus.Error.InvalidArgs") {
-					hasDelegateSlice = false
-				}
+	// Assume StartTransientUnit on a slice allows Delegate
+	hasDelegateSlice = true
+	dlSlice := newProp("Delegate", true)
+	if _, err := conn.StartTransientUnit(slice, "replace", []systemdDbus.Property{dlSlice}, nil); err != nil {
+		if dbusError, ok := err.(dbus.Error); ok {
+			// Starting with systemd v237, Delegate is not even a property of slices anymore,
+			// so the D-Bus call fails with "InvalidArgs" error.
+			if strings.Contains(dbusError.Name, "org.freedesktop.DBus.Error.PropertyReadOnly") || strings.Contains(dbusError.Name, "org.freedesktop.DBus.Error.InvalidArgs") {
+				hasDelegateSlice = false
 			}
 		}
-
-		// Not critical because of the stop unit logic above.
-		theConn.StopUnit(slice, "replace", nil)
 	}
-	return hasStartTransientUnit
+
+	// Not critical because of the stop unit logic above.
+	conn.StopUnit(slice, "replace", nil)
 }
 
 func (m *Manager) Apply(pid int) error {
 	var (
-		c          = m.Cgroups
-		unitName   = getUnitName(c)
-		slice      = "system.slice"
-		properties []systemdDbus.Property
+		c        = m.Cgroups
+		unitName = getUnitName(c)
 	)
 
 	if c.Paths != nil {
@@ -188,38 +190,9 @@ func (m *Manager) Apply(pid int) error {
 		return cgroups.EnterPid(m.Paths, pid)
 	}
 
-	if c.Parent != "" {
-		slice = c.Parent
-	}
-
-	properties = append(properties, systemdDbus.PropDescription("libcontainer container "+c.Name))
-
-	// if we create a slice, the parent is defined via a Wants=
-	if strings.HasSuffix(unitName, ".slice") {
-		// This was broken until systemd v229, but has been back-ported on RHEL environments >= 219
-		if !hasStartTransientSliceUnit {
-			return fmt.Errorf("systemd version does not support ability to start a slice as transient unit")
-		}
-		properties = append(properties, systemdDbus.PropWants(slice))
-	} else {
-		// otherwise, we use Slice=
-		properties = append(properties, systemdDbus.PropSlice(slice))
-	}
-
-	// only add pid if its valid, -1 is used w/ general slice creation.
-	if pid != -1 {
-		properties = append(properties, newProp("PIDs", []uint32{uint32(pid)}))
-	}
-
-	// Check if we can delegate. This is only supported on systemd versions 218 and above.
-	if strings.HasSuffix(unitName, ".slice") {
-		if hasDelegateSlice {
-			// systemd 237 and above no longer allows delegation on a slice
-			properties = append(properties, newProp("Delegate", true))
-		}
-	} else {
-		// Assume scopes always support delegation.
-		properties = append(properties, newProp("Delegate", true))
+	properties, err := unitProperties(c, unitName, pid, false)
+	if err != nil {
+		return err
 	}
 
 	// Always enable accounting, this gets us the same behaviour as the fs implementation,
@@ -229,50 +202,13 @@ func (m *Manager) Apply(pid int) error {
 		newProp("CPUAccounting", true),
 		newProp("BlockIOAccounting", true))
 
-	// Assume DefaultDependencies= will always work (the check for it was previously broken.)
-	properties = append(properties,
-		newProp("DefaultDependencies", false))
-
-	if c.Resources.Memory != 0 {
-		properties = append(properties,
-			newProp("MemoryLimit", uint64(c.Resources.Memory)))
-	}
-
-	if c.Resources.CpuShares != 0 {
-		properties = append(properties,
-			newProp("CPUShares", c.Resources.CpuShares))
-	}
-
-	// cpu.cfs_quota_us and cpu.cfs_period_us are controlled by systemd.
-	if c.Resources.CpuQuota != 0 && c.Resources.CpuPeriod != 0 {
-		// corresponds to USEC_INFINITY in systemd
-		// if USEC_INFINITY is provided, CPUQuota is left unbound by systemd
-		// always setting a property value ensures we can apply a quota and remove it later
-		cpuQuotaPerSecUSec := uint64(math.MaxUint64)
-		if c.Resources.CpuQuota > 0 {
-			// systemd converts CPUQuotaPerSecUSec (microseconds per CPU second) to CPUQuota
-			// (integer percentage of CPU) internally.  This means that if a fractional percent of
-			// CPU is indicated by Resources.CpuQuota, we need to round up to the nearest
-			// 10ms (1% of a second) such that child cgroups can set the cpu.cfs_quota_us they expect.
-			cpuQuotaPerSecUSec = uint64(c.Resources.CpuQuota*1000000) / c.Resources.CpuPeriod
-			if cpuQuotaPerSecUSec%10000 != 0 {
-				cpuQuotaPerSecUSec = ((cpuQuotaPerSecUSec / 10000) + 1) * 10000
-			}
-		}
-		properties = append(properties,
-			newProp("CPUQuotaPerSecUSec", cpuQuotaPerSecUSec))
-	}
-
-	if c.Resources.BlkioWeight != 0 {
-		properties = append(properties,
-			newProp("BlockIOWeight", uint64(c.Resources.BlkioWeight)))
-	}
-
-	if c.Resources.PidsLimit > 0 {
-		properties = append(properties,
-			newProp("TasksAccounting", true),
-			newProp("TasksMax", uint64(c.Resources.PidsLimit)))
+	resourcesProperties, err := genV1ResourcesProperties(c.Resources, theConn)
+	if err != nil {
+		return err
 	}
+	properties = append(properties, resourcesProperties...)
+	// the properties from the annotations come last, to override ours
+	properties = append(properties, c.SystemdProps...)
 
 	// We have to set kernel memory here, as we can't change it once
 	// processes have been attached to the cgroup.
@@ -282,14 +218,7 @@ func (m *Manager) Apply(pid int) error {
 		}
 	}
 
-	statusChan := make(chan string, 1)
-	if _, err := theConn.StartTransientUnit(unitName, "replace", properties, statusChan); err == nil {
-		select {
-		case <-statusChan:
-		case <-time.After(time.Second):
-			logrus.Warnf("Timed out while waiting for StartTransientUnit(%s) completion signal from dbus. Continuing...", unitName)
-		}
-	} else if !isUnitExists(err) {
+	if err := startUnit(theConn, unitName, properties); err != nil {
 		return err
 	}
 
@@ -431,12 +360,7 @@ func getSubsystemPath(c *configs.Cgroup, subsystem string) (string, error) {
 	// if pid 1 is systemd 226 or later, it will be in init.scope, not the root
 	initPath = strings.TrimSuffix(filepath.Clean(initPath), "init.scope")
 
-	slice := "system.slice"
-	if c.Parent != "" {
-		slice = c.Parent
-	}
-
-	slice, err = ExpandSlice(slice)
+	slice, err := ExpandSlice(parentSlice(c, false))
 	if err != nil {
 		return "", err
 	}
@@ -502,6 +426,14 @@ func (m *Manager) Set(container *configs.Config) error {
 	if m.Cgroups.Paths != nil {
 		return nil
 	}
+	properties, err := genV1ResourcesProperties(container.Cgroups.Resources, theConn)
+	if err != nil {
+		return err
+	}
+	if err := m.setUnitProperties(getUnitName(container.Cgroups), properties); err != nil {
+		return err
+	}
+
 	for _, sys := range subsystems {
 		// Get the subsystem path, but don't error out for not found cgroups.
 		path, err := getSubsystemPath(container.Cgroups, sys.Name())
@@ -522,6 +454,48 @@ func (m *Manager) Set(container *configs.Config) error {
 	return nil
 }
 
+// Snapshot saves the values of the cgroup files that Set may change.
+func (m *Manager) Snapshot() (*cgroups.Snapshot, error) {
+	return fs.SnapshotPaths(m.GetPaths())
+}
+
+// setUnitProperties changes the properties of the unit. systemd applies the
+// device properties by denying all the devices in the devices cgroup before
+// allowing the ones of the unit again, so the processes are frozen around the
+// change, they would get EPERM from the devices they use in the meantime.
+func (m *Manager) setUnitProperties(unitName string, properties []systemdDbus.Property) error {
+	path := m.GetPaths()["freezer"]
+	if path == "" || !hasDeviceProperties(properties) {
+		return setUnitProperties(theConn, unitName, properties)
+	}
+	state, err := ioutil.ReadFile(filepath.Join(path, "freezer.state"))
+	if err != nil {
+		return err
+	}
+	// a paused container is left frozen
+	if strings.TrimSpace(string(state)) != string(configs.Thawed) {
+		return setUnitProperties(theConn, unitName, properties)
+	}
+	freezer := &fs.FreezerGroup{}
+	if err := freezer.Set(path, &configs.Cgroup{Resources: &configs.Resources{Freezer: configs.Frozen}}); err != nil {
+		return err
+	}
+	err = setUnitProperties(theConn, unitName, properties)
+	if terr := freezer.Set(path, &configs.Cgroup{Resources: &configs.Resources{Freezer: configs.Thawed}}); err == nil {
+		err = terr
+	}
+	return err
+}
+
+func hasDeviceProperties(properties []systemdDbus.Property) bool {
+	for _, p := range properties {
+		if p.Name == "DevicePolicy" || p.Name == "DeviceAllow" {
+			return true
+		}
+	}
+	return false
+}
+
 func getUnitName(c *configs.Cgroup) string {
 	// by default, we create a scope unless the user explicitly asks for a slice.
 	if !strings.HasSuffix(c.Name, ".slice") {
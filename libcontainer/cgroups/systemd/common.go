@@ -0,0 +1,560 @@
+// +build linux,!static_build
+
+package systemd
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	systemdDbus "github.com/coreos/go-systemd/dbus"
+	"github.com/opencontainers/runc/libcontainer/cgroups"
+	"github.com/opencontainers/runc/libcontainer/cgroups/ebpf"
+	"github.com/opencontainers/runc/libcontainer/configs"
+	"github.com/sirupsen/logrus"
+)
+
+// defaultCpuPeriod is the period of the kernel when cpu.cfs_period_us is not
+// set, in microseconds.
+const defaultCpuPeriod uint64 = 100000
+
+var (
+	versionOnce sync.Once
+	version     int
+)
+
+// systemdVersion returns the major version of systemd, or -1 if it cannot be
+// found, in which case no optional property is used.
+func systemdVersion(conn *systemdDbus.Conn) int {
+	versionOnce.Do(func() {
+		version = -1
+		verStr, err := conn.GetManagerProperty("Version")
+		if err == nil {
+			version, err = parseSystemdVersion(verStr)
+		}
+		if err != nil {
+			logrus.Warnf("unable to get the systemd version: %v", err)
+		}
+	})
+	return version
+}
+
+// parseSystemdVersion parses the Version property of the systemd manager,
+// such as "245.4-4ubuntu3" or "v239", quoted as the string of a D-Bus variant.
+func parseSystemdVersion(verStr string) (int, error) {
+	s := strings.TrimPrefix(strings.Trim(verStr, `"`), "v")
+	if i := strings.IndexFunc(s, func(r rune) bool { return r < '0' || r > '9' }); i != -1 {
+		s = s[:i]
+	}
+	ver, err := strconv.Atoi(s)
+	if err != nil {
+		return -1, fmt.Errorf("invalid systemd version %s", verStr)
+	}
+	return ver, nil
+}
+
+// parentSlice returns the slice the unit of c is in, by default system.slice,
+// or user.slice for the systemd user instance.
+func parentSlice(c *configs.Cgroup, rootless bool) string {
+	if c.Parent != "" {
+		return c.Parent
+	}
+	if rootless {
+		return "user.slice"
+	}
+	return "system.slice"
+}
+
+// unitProperties returns the properties of the unit of the container but its
+// resources: the unit is in the parent slice and has the delegation of its
+// cgroup subtree, so that systemd does not reset the values written to
+// cgroupfs and the container can have nested cgroups.
+func unitProperties(c *configs.Cgroup, unitName string, pid int, rootless bool) ([]systemdDbus.Property, error) {
+	var properties []systemdDbus.Property
+	slice := parentSlice(c, rootless)
+
+	properties = append(properties, systemdDbus.PropDescription("libcontainer container "+c.Name))
+
+	// if we create a slice, the parent is defined via a Wants=
+	if strings.HasSuffix(unitName, ".slice") {
+		// This was broken until systemd v229, but has been back-ported on RHEL environments >= 219
+		if !hasStartTransientSliceUnit {
+			return nil, fmt.Errorf("systemd version does not support ability to start a slice as transient unit")
+		}
+		properties = append(properties, systemdDbus.PropWants(slice))
+	} else {
+		// otherwise, we use Slice=
+		properties = append(properties, systemdDbus.PropSlice(slice))
+	}
+
+	// only add pid if its valid, -1 is used w/ general slice creation.
+	if pid != -1 {
+		properties = append(properties, newProp("PIDs", []uint32{uint32(pid)}))
+	}
+
+	// Check if we can delegate. This is only supported on systemd versions 218 and above.
+	if strings.HasSuffix(unitName, ".slice") {
+		if hasDelegateSlice {
+			// systemd 237 and above no longer allows delegation on a slice
+			properties = append(properties, newProp("Delegate", true))
+		}
+	} else {
+		// Assume scopes always support delegation.
+		properties = append(properties, newProp("Delegate", true))
+	}
+
+	// Assume DefaultDependencies= will always work (the check for it was previously broken.)
+	properties = append(properties,
+		newProp("DefaultDependencies", false))
+
+	return properties, nil
+}
+
+// startUnit starts the transient unit, an existing unit is left as is.
+func startUnit(conn *systemdDbus.Conn, unitName string, properties []systemdDbus.Property) error {
+	statusChan := make(chan string, 1)
+	if _, err := conn.StartTransientUnit(unitName, "replace", properties, statusChan); err == nil {
+		select {
+		case <-statusChan:
+		case <-time.After(time.Second):
+			logrus.Warnf("Timed out while waiting for StartTransientUnit(%s) completion signal from dbus. Continuing...", unitName)
+		}
+	} else if !isUnitExists(err) {
+		return err
+	}
+	return nil
+}
+
+// setUnitProperties changes the properties of the running unit, they are not
+// saved to disk so they are gone with the unit.
+func setUnitProperties(conn *systemdDbus.Conn, unitName string, properties []systemdDbus.Property) error {
+	if len(properties) == 0 {
+		return nil
+	}
+	return conn.SetUnitProperties(unitName, true, properties...)
+}
+
+// genV1ResourcesProperties returns the properties of the resources that
+// systemd manages on the cgroup v1 hierarchies. The resources without such a
+// property are written to cgroupfs by the fs subsystems.
+func genV1ResourcesProperties(r *configs.Resources, conn *systemdDbus.Conn) ([]systemdDbus.Property, error) {
+	var properties []systemdDbus.Property
+
+	deviceProperties, err := generateDeviceProperties(ebpf.DeviceRules(r))
+	if err != nil {
+		return nil, err
+	}
+	properties = append(properties, deviceProperties...)
+
+	if r.Memory != 0 {
+		properties = append(properties,
+			newProp("MemoryLimit", uint64(r.Memory)))
+	}
+
+	if r.CpuShares != 0 {
+		properties = append(properties,
+			newProp("CPUShares", r.CpuShares))
+	}
+
+	properties = addCpuQuota(conn, properties, r.CpuQuota, r.CpuPeriod)
+
+	if r.BlkioWeight != 0 {
+		properties = append(properties,
+			newProp("BlockIOWeight", uint64(r.BlkioWeight)))
+	}
+	if weights := deviceWeights(r.BlkioWeightDevice, nil); len(weights) > 0 {
+		properties = append(properties, newProp("BlockIODeviceWeight", weights))
+	}
+	if limits := deviceLimits(r.BlkioThrottleReadBpsDevice); len(limits) > 0 {
+		properties = append(properties, newProp("BlockIOReadBandwidth", limits))
+	}
+	if limits := deviceLimits(r.BlkioThrottleWriteBpsDevice); len(limits) > 0 {
+		properties = append(properties, newProp("BlockIOWriteBandwidth", limits))
+	}
+
+	properties = addPidsLimit(properties, r.PidsLimit)
+
+	return properties, nil
+}
+
+// genV2ResourcesProperties returns the properties of the resources that
+// systemd manages on the cgroup v2 unified hierarchy. The resources without
+// such a property are written to cgroupfs by the fs2 manager.
+func genV2ResourcesProperties(r *configs.Resources, conn *systemdDbus.Conn) ([]systemdDbus.Property, error) {
+	var properties []systemdDbus.Property
+
+	deviceProperties, err := generateDeviceProperties(ebpf.DeviceRules(r))
+	if err != nil {
+		return nil, err
+	}
+	properties = append(properties, deviceProperties...)
+
+	if r.Memory != 0 {
+		properties = append(properties,
+			newProp("MemoryMax", uint64(r.Memory)))
+	}
+
+	// the soft limit is the best-effort protection of cgroup v2
+	if r.MemoryReservation != 0 {
+		properties = append(properties,
+			newProp("MemoryLow", uint64(r.MemoryReservation)))
+	}
+
+	if r.MemorySwap != 0 {
+		swap, err := cgroups.ConvertMemorySwapToCgroupV2Value(r.MemorySwap, r.Memory)
+		if err != nil {
+			return nil, err
+		}
+		// systemd only supports MemorySwapMax since v232
+		if systemdVersion(conn) >= 232 {
+			properties = append(properties,
+				newProp("MemorySwapMax", uint64(swap)))
+		}
+	}
+
+	if r.CpuShares != 0 {
+		properties = append(properties,
+			newProp("CPUWeight", cgroups.ConvertCPUSharesToCgroupV2Value(r.CpuShares)))
+	}
+
+	properties = addCpuQuota(conn, properties, r.CpuQuota, r.CpuPeriod)
+
+	if r.CpusetCpus != "" || r.CpusetMems != "" {
+		// systemd only supports AllowedCPUs and AllowedMemoryNodes since v244
+		if systemdVersion(conn) >= 244 {
+			if r.CpusetCpus != "" {
+				bits, err := rangeToBits(r.CpusetCpus)
+				if err != nil {
+					return nil, fmt.Errorf("invalid cpuset cpus %q: %v", r.CpusetCpus, err)
+				}
+				properties = append(properties, newProp("AllowedCPUs", bits))
+			}
+			if r.CpusetMems != "" {
+				bits, err := rangeToBits(r.CpusetMems)
+				if err != nil {
+					return nil, fmt.Errorf("invalid cpuset mems %q: %v", r.CpusetMems, err)
+				}
+				properties = append(properties, newProp("AllowedMemoryNodes", bits))
+			}
+		}
+	}
+
+	if r.BlkioWeight != 0 {
+		properties = append(properties,
+			newProp("IOWeight", cgroups.ConvertBlkIOToCgroupV2Value(r.BlkioWeight)))
+	}
+	if weights := deviceWeights(r.BlkioWeightDevice, cgroups.ConvertBlkIOToCgroupV2Value); len(weights) > 0 {
+		properties = append(properties, newProp("IODeviceWeight", weights))
+	}
+	for _, t := range []struct {
+		name    string
+		devices []*configs.ThrottleDevice
+	}{
+		{"IOReadBandwidthMax", r.BlkioThrottleReadBpsDevice},
+		{"IOWriteBandwidthMax", r.BlkioThrottleWriteBpsDevice},
+		{"IOReadIOPSMax", r.BlkioThrottleReadIOPSDevice},
+		{"IOWriteIOPSMax", r.BlkioThrottleWriteIOPSDevice},
+	} {
+		if limits := deviceLimits(t.devices); len(limits) > 0 {
+			properties = append(properties, newProp(t.name, limits))
+		}
+	}
+
+	properties = addPidsLimit(properties, r.PidsLimit)
+
+	return properties, nil
+}
+
+// addCpuQuota appends the properties of the CFS quota and period.
+func addCpuQuota(conn *systemdDbus.Conn, properties []systemdDbus.Property, quota int64, period uint64) []systemdDbus.Property {
+	if period != 0 {
+		// systemd only supports CPUQuotaPeriodUSec since v242
+		if systemdVersion(conn) >= 242 {
+			properties = append(properties,
+				newProp("CPUQuotaPeriodUSec", period))
+		}
+	}
+
+	if quota != 0 || period != 0 {
+		// corresponds to USEC_INFINITY in systemd
+		// if USEC_INFINITY is provided, CPUQuota is left unbound by systemd
+		// always setting a property value ensures we can apply a quota and remove it later
+		cpuQuotaPerSecUSec := uint64(math.MaxUint64)
+		if quota > 0 {
+			if period == 0 {
+				period = defaultCpuPeriod
+			}
+			// systemd converts CPUQuotaPerSecUSec (microseconds per CPU second) to CPUQuota
+			// (integer percentage of CPU) internally.  This means that if a fractional percent of
+			// CPU is indicated by Resources.CpuQuota, we need to round up to the nearest
+			// 10ms (1% of a second) such that child cgroups can set the cpu.cfs_quota_us they expect.
+			cpuQuotaPerSecUSec = uint64(quota*1000000) / period
+			if cpuQuotaPerSecUSec%10000 != 0 {
+				cpuQuotaPerSecUSec = ((cpuQuotaPerSecUSec / 10000) + 1) * 10000
+			}
+		}
+		properties = append(properties,
+			newProp("CPUQuotaPerSecUSec", cpuQuotaPerSecUSec))
+	}
+	return properties
+}
+
+// addPidsLimit appends the properties of the pids limit, a negative limit
+// removes it.
+func addPidsLimit(properties []systemdDbus.Property, limit int64) []systemdDbus.Property {
+	if limit == 0 {
+		return properties
+	}
+	tasksMax := uint64(math.MaxUint64)
+	if limit > 0 {
+		tasksMax = uint64(limit)
+	}
+	return append(properties,
+		newProp("TasksAccounting", true),
+		newProp("TasksMax", tasksMax))
+}
+
+// deviceValue is an entry of the per device properties, of D-Bus type (st).
+type deviceValue struct {
+	Path  string
+	Value uint64
+}
+
+// blockDevicePath returns the path of a block device node by its numbers,
+// which systemd resolves to the device.
+func blockDevicePath(major, minor int64) string {
+	return fmt.Sprintf("/dev/block/%d:%d", major, minor)
+}
+
+// deviceWeights returns the entries of the per device weights, converted by
+// convert when it is not nil.
+func deviceWeights(devices []*configs.WeightDevice, convert func(uint16) uint64) []deviceValue {
+	var weights []deviceValue
+	for _, wd := range devices {
+		weight := uint64(wd.Weight)
+		if convert != nil {
+			weight = convert(wd.Weight)
+		}
+		if weight == 0 {
+			continue
+		}
+		weights = append(weights, deviceValue{blockDevicePath(wd.Major, wd.Minor), weight})
+	}
+	return weights
+}
+
+// deviceLimits returns the entries of the per device IO limits, a zero rate
+// removes the limit.
+func deviceLimits(devices []*configs.ThrottleDevice) []deviceValue {
+	var limits []deviceValue
+	for _, td := range devices {
+		rate := td.Rate
+		if rate == 0 {
+			rate = math.MaxUint64
+		}
+		limits = append(limits, deviceValue{blockDevicePath(td.Major, td.Minor), rate})
+	}
+	return limits
+}
+
+// deviceAllowEntry is an entry of the DeviceAllow property, of D-Bus type
+// (ss).
+type deviceAllowEntry struct {
+	Path  string
+	Perms string
+}
+
+// generateDeviceProperties returns the DevicePolicy and DeviceAllow properties
+// of the device rules, applied in the order of the devices cgroup v1
+// controller. systemd can only express an allow list, so the exceptions to an
+// allow-all policy are left to the devices cgroup or eBPF filter runc sets up
+// as well, and so is an allow list that systemd cannot express entirely. The
+// empty DeviceAllow resets the allow list of the unit, which systemd appends
+// to otherwise.
+func generateDeviceProperties(rules []*configs.Device) ([]systemdDbus.Property, error) {
+	if len(rules) == 0 {
+		return nil, nil
+	}
+
+	defaultAllow := true
+	var allowed []*configs.Device
+	for _, rule := range rules {
+		if rule.Type == 'a' {
+			defaultAllow = rule.Allow
+			allowed = nil
+			continue
+		}
+		if defaultAllow {
+			continue
+		}
+		if rule.Allow {
+			allowed = append(allowed, rule)
+			continue
+		}
+		// a deny rule takes the permissions off the matching exceptions
+		var kept []*configs.Device
+		for _, dev := range allowed {
+			if dev.Type == rule.Type && dev.Major == rule.Major && dev.Minor == rule.Minor {
+				perms := strings.Map(func(r rune) rune {
+					if strings.ContainsRune(rule.Permissions, r) {
+						return -1
+					}
+					return r
+				}, dev.Permissions)
+				if perms == "" {
+					continue
+				}
+				d := *dev
+				d.Permissions = perms
+				dev = &d
+			}
+			kept = append(kept, dev)
+		}
+		allowed = kept
+	}
+
+	autoPolicy := []systemdDbus.Property{
+		newProp("DevicePolicy", "auto"),
+		newProp("DeviceAllow", []deviceAllowEntry{}),
+	}
+	if defaultAllow {
+		return autoPolicy, nil
+	}
+
+	var entries []deviceAllowEntry
+	for _, dev := range allowed {
+		path, err := deviceAllowPath(dev)
+		if err != nil {
+			return nil, err
+		}
+		if path == "" {
+			// a strict policy would deny the devices of the rule
+			logrus.Warnf("systemd cannot express the device rule %s, leaving the device policy of the unit to auto", dev.CgroupString())
+			return autoPolicy, nil
+		}
+		if strings.HasPrefix(path, "/dev/") {
+			// systemd ignores the device nodes missing on the host
+			if _, err := os.Stat(path); err != nil {
+				logrus.Debugf("skipping the device %s for systemd: %v", path, err)
+				continue
+			}
+		}
+		entries = append(entries, deviceAllowEntry{Path: path, Perms: dev.Permissions})
+	}
+	return []systemdDbus.Property{
+		newProp("DevicePolicy", "strict"),
+		newProp("DeviceAllow", []deviceAllowEntry{}),
+		newProp("DeviceAllow", entries),
+	}, nil
+}
+
+// deviceAllowPath returns the DeviceAllow path of an allow rule, the empty
+// string when systemd cannot express it.
+func deviceAllowPath(dev *configs.Device) (string, error) {
+	var class, group string
+	switch dev.Type {
+	case 'c':
+		class, group = "char", "Character devices:"
+	case 'b':
+		class, group = "block", "Block devices:"
+	default:
+		return "", fmt.Errorf("invalid device type %q", dev.Type)
+	}
+
+	switch {
+	case dev.Major == configs.Wildcard && dev.Minor == configs.Wildcard:
+		return class + "-*", nil
+	case dev.Major == configs.Wildcard:
+		logrus.Debugf("systemd does not support device rules of any major number and minor number %d", dev.Minor)
+		return "", nil
+	case dev.Minor == configs.Wildcard:
+		name, err := findDeviceGroup("/proc/devices", group, dev.Major)
+		if err != nil {
+			return "", err
+		}
+		if name == "" {
+			logrus.Debugf("no device group of major number %d in /proc/devices", dev.Major)
+			return "", nil
+		}
+		return class + "-" + name, nil
+	}
+
+	return fmt.Sprintf("/dev/%s/%d:%d", class, dev.Major, dev.Minor), nil
+}
+
+// findDeviceGroup returns the name of the driver of a major number in the
+// group of the devices file, such as "Character devices:".
+func findDeviceGroup(file, group string, major int64) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	inGroup := false
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" {
+			continue
+		}
+		if strings.HasSuffix(line, ":") {
+			inGroup = line == group
+			continue
+		}
+		if !inGroup {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		if num, err := strconv.ParseInt(fields[0], 10, 64); err == nil && num == major {
+			return fields[1], nil
+		}
+	}
+	return "", s.Err()
+}
+
+// rangeToBits converts a list of CPUs or memory nodes, such as "0-3,7", to
+// the bitmask of the AllowedCPUs and AllowedMemoryNodes properties: the byte
+// n holds the bits of the numbers 8n to 8n+7.
+func rangeToBits(str string) ([]byte, error) {
+	var bits []byte
+	for _, r := range strings.Split(str, ",") {
+		r = strings.TrimSpace(r)
+		if r == "" {
+			continue
+		}
+		first, last := r, r
+		if i := strings.Index(r, "-"); i != -1 {
+			first, last = r[:i], r[i+1:]
+		}
+		start, err := strconv.ParseUint(first, 10, 16)
+		if err != nil {
+			return nil, err
+		}
+		end, err := strconv.ParseUint(last, 10, 16)
+		if err != nil {
+			return nil, err
+		}
+		if start > end {
+			return nil, fmt.Errorf("invalid range %s", r)
+		}
+		for n := start; n <= end; n++ {
+			for uint64(len(bits)) <= n/8 {
+				bits = append(bits, 0)
+			}
+			bits[n/8] |= 1 << (n % 8)
+		}
+	}
+	if len(bits) == 0 {
+		return nil, fmt.Errorf("empty range")
+	}
+	return bits, nil
+}
@@ -0,0 +1,228 @@
+// +build linux,!static_build
+
+package systemd
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/opencontainers/runc/libcontainer/configs"
+)
+
+func TestRangeToBits(t *testing.T) {
+	testCases := []struct {
+		in    string
+		out   []byte
+		isErr bool
+	}{
+		{in: "0", out: []byte{0x01}},
+		{in: "0-3,7", out: []byte{0x8f}},
+		{in: "1,9", out: []byte{0x02, 0x02}},
+		{in: "8-15", out: []byte{0x00, 0xff}},
+		{in: " 2 , 4-5 ", out: []byte{0x34}},
+		{in: "", isErr: true},
+		{in: "3-1", isErr: true},
+		{in: "a", isErr: true},
+		{in: "1-", isErr: true},
+	}
+	for _, tc := range testCases {
+		out, err := rangeToBits(tc.in)
+		if tc.isErr {
+			if err == nil {
+				t.Errorf("%q: expected an error, got %v", tc.in, out)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", tc.in, err)
+			continue
+		}
+		if !bytes.Equal(out, tc.out) {
+			t.Errorf("%q: expected %v, got %v", tc.in, tc.out, out)
+		}
+	}
+}
+
+func TestParseSystemdVersion(t *testing.T) {
+	testCases := map[string]int{
+		`"245.4-4ubuntu3"`: 245,
+		`"v239"`:           239,
+		`"219"`:            219,
+	}
+	for in, expected := range testCases {
+		ver, err := parseSystemdVersion(in)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", in, err)
+		} else if ver != expected {
+			t.Errorf("%s: expected %d, got %d", in, expected, ver)
+		}
+	}
+	if _, err := parseSystemdVersion(`"unknown"`); err == nil {
+		t.Error("expected an error for an invalid version")
+	}
+}
+
+func TestFindDeviceGroup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "systemd-devices")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "devices")
+	content := "Character devices:\n  1 mem\n  4 /dev/vc/0\n136 pts\n\nBlock devices:\n  8 sd\n"
+	if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		group string
+		major int64
+		name  string
+	}{
+		{"Character devices:", 136, "pts"},
+		{"Character devices:", 4, "/dev/vc/0"},
+		{"Character devices:", 8, ""},
+		{"Block devices:", 8, "sd"},
+	} {
+		name, err := findDeviceGroup(file, tc.group, tc.major)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if name != tc.name {
+			t.Errorf("%s %d: expected %q, got %q", tc.group, tc.major, tc.name, name)
+		}
+	}
+}
+
+func TestGenerateDeviceProperties(t *testing.T) {
+	denyAll := &configs.Device{Type: 'a', Major: configs.Wildcard, Minor: configs.Wildcard, Permissions: "rwm", Allow: false}
+	allowAll := &configs.Device{Type: 'a', Major: configs.Wildcard, Minor: configs.Wildcard, Permissions: "rwm", Allow: true}
+
+	properties, err := generateDeviceProperties(nil)
+	if err != nil || len(properties) != 0 {
+		t.Fatalf("expected no properties without rules, got %v, %v", properties, err)
+	}
+
+	properties, err = generateDeviceProperties([]*configs.Device{
+		denyAll,
+		{Type: 'c', Major: configs.Wildcard, Minor: configs.Wildcard, Permissions: "m", Allow: true},
+		{Type: 'b', Major: configs.Wildcard, Minor: configs.Wildcard, Permissions: "rwm", Allow: true},
+		{Type: 'b', Major: configs.Wildcard, Minor: configs.Wildcard, Permissions: "w", Allow: false},
+		{Type: 'c', Major: 1, Minor: 3, Permissions: "rwm", Allow: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(properties) != 3 {
+		t.Fatalf("expected 3 properties, got %v", properties)
+	}
+	if properties[0].Name != "DevicePolicy" || properties[0].Value.Value() != "strict" {
+		t.Errorf("expected a strict device policy, got %v", properties[0])
+	}
+	if properties[1].Name != "DeviceAllow" || properties[1].Value.Signature().String() != "a(ss)" {
+		t.Errorf("expected the reset of DeviceAllow of type a(ss), got %v", properties[1])
+	}
+	expected := []deviceAllowEntry{{"char-*", "m"}, {"block-*", "rm"}}
+	// the node of /dev/null is not there in every test environment
+	if _, err := os.Stat("/dev/char/1:3"); err == nil {
+		expected = append(expected, deviceAllowEntry{"/dev/char/1:3", "rwm"})
+	}
+	if entries := properties[2].Value.Value(); !reflect.DeepEqual(entries, expected) {
+		t.Errorf("expected DeviceAllow %v, got %v", expected, entries)
+	}
+
+	for _, rules := range [][]*configs.Device{
+		{
+			denyAll,
+			{Type: 'c', Major: 1, Minor: 3, Permissions: "rwm", Allow: true},
+			allowAll,
+			{Type: 'c', Major: 1, Minor: 5, Permissions: "rwm", Allow: false},
+		},
+		// systemd cannot express the rule of any major number, a strict
+		// policy would deny its devices
+		{
+			denyAll,
+			{Type: 'c', Major: 1, Minor: 3, Permissions: "rwm", Allow: true},
+			{Type: 'c', Major: configs.Wildcard, Minor: 3, Permissions: "rwm", Allow: true},
+		},
+	} {
+		properties, err = generateDeviceProperties(rules)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(properties) != 2 || properties[0].Value.Value() != "auto" || properties[1].Value.Value() == nil {
+			t.Errorf("expected an auto device policy with no allow list, got %v", properties)
+			continue
+		}
+		if entries := properties[1].Value.Value().([]deviceAllowEntry); len(entries) != 0 {
+			t.Errorf("expected an empty DeviceAllow, got %v", entries)
+		}
+	}
+}
+
+func TestDeviceValues(t *testing.T) {
+	weights := deviceWeights([]*configs.WeightDevice{
+		configs.NewWeightDevice(8, 0, 500, 0),
+		configs.NewWeightDevice(8, 16, 0, 300),
+	}, nil)
+	if expected := []deviceValue{{"/dev/block/8:0", 500}}; !reflect.DeepEqual(weights, expected) {
+		t.Errorf("expected weights %v, got %v", expected, weights)
+	}
+	if sig := newProp("BlockIODeviceWeight", weights).Value.Signature().String(); sig != "a(st)" {
+		t.Errorf("expected the D-Bus type a(st), got %s", sig)
+	}
+
+	limits := deviceLimits([]*configs.ThrottleDevice{
+		configs.NewThrottleDevice(8, 0, 1048576),
+		configs.NewThrottleDevice(8, 16, 0),
+	})
+	if expected := []deviceValue{{"/dev/block/8:0", 1048576}, {"/dev/block/8:16", 1<<64 - 1}}; !reflect.DeepEqual(limits, expected) {
+		t.Errorf("expected limits %v, got %v", expected, limits)
+	}
+}
+
+func TestGenV2MemoryProperties(t *testing.T) {
+	properties, err := genV2ResourcesProperties(&configs.Resources{
+		Memory:            200 * 1024 * 1024,
+		MemoryReservation: 100 * 1024 * 1024,
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	values := map[string]interface{}{}
+	for _, p := range properties {
+		values[p.Name] = p.Value.Value()
+	}
+	if v := values["MemoryMax"]; v != uint64(200*1024*1024) {
+		t.Errorf("expected MemoryMax of the limit, got %v", v)
+	}
+	// the reservation protects the memory, it does not throttle it
+	if v := values["MemoryLow"]; v != uint64(100*1024*1024) {
+		t.Errorf("expected MemoryLow of the reservation, got %v", v)
+	}
+	if v, ok := values["MemoryHigh"]; ok {
+		t.Errorf("expected no MemoryHigh, got %v", v)
+	}
+}
+
+func TestParentSlice(t *testing.T) {
+	for _, tc := range []struct {
+		parent   string
+		rootless bool
+		expected string
+	}{
+		{"", false, "system.slice"},
+		{"", true, "user.slice"},
+		{"machine.slice", false, "machine.slice"},
+		{"app.slice", true, "app.slice"},
+	} {
+		if slice := parentSlice(&configs.Cgroup{Parent: tc.parent}, tc.rootless); slice != tc.expected {
+			t.Errorf("parent %q, rootless %v: expected %s, got %s", tc.parent, tc.rootless, tc.expected, slice)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+// +build linux,!static_build
+
+package systemd
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	systemdDbus "github.com/coreos/go-systemd/dbus"
+	"github.com/opencontainers/runc/libcontainer/cgroups"
+	"github.com/opencontainers/runc/libcontainer/cgroups/fs2"
+	"github.com/opencontainers/runc/libcontainer/configs"
+)
+
+// UnifiedManager manages the cgroup of a container with systemd on the cgroup
+// v2 unified hierarchy. The resources are set as properties of the unit, and
+// written to the delegated cgroup of the unit when systemd has no property
+// for them.
+type UnifiedManager struct {
+	mu      sync.Mutex
+	Cgroups *configs.Cgroup
+	// Rootless uses the systemd user instance of the current user, which
+	// delegates a cgroup subtree to it.
+	Rootless bool
+	Paths    map[string]string
+}
+
+// conn returns the connection to the systemd instance managing the unit.
+func (m *UnifiedManager) conn() *systemdDbus.Conn {
+	if m.Rootless {
+		return theUserConn
+	}
+	return theConn
+}
+
+// resourcesProperties returns the unit properties of the resources. The
+// device policy is left out of rootless units, systemd needs privileges to
+// enforce it and rootless containers can only use the devices of the user.
+func (m *UnifiedManager) resourcesProperties(r *configs.Resources) ([]systemdDbus.Property, error) {
+	properties, err := genV2ResourcesProperties(r, m.conn())
+	if err != nil || !m.Rootless {
+		return properties, err
+	}
+	var kept []systemdDbus.Property
+	for _, p := range properties {
+		if p.Name != "DevicePolicy" && p.Name != "DeviceAllow" {
+			kept = append(kept, p)
+		}
+	}
+	return kept, nil
+}
+
+func (m *UnifiedManager) Apply(pid int) error {
+	var (
+		c        = m.Cgroups
+		unitName = getUnitName(c)
+	)
+
+	if c.Paths != nil {
+		m.mu.Lock()
+		m.Paths = c.Paths
+		m.mu.Unlock()
+		return cgroups.EnterPid(c.Paths, pid)
+	}
+
+	properties, err := unitProperties(c, unitName, pid, m.Rootless)
+	if err != nil {
+		return err
+	}
+
+	// Always enable accounting, this gets us the same behaviour as the fs2 implementation.
+	properties = append(properties,
+		newProp("MemoryAccounting", true),
+		newProp("CPUAccounting", true),
+		newProp("IOAccounting", true))
+
+	resourcesProperties, err := m.resourcesProperties(c.Resources)
+	if err != nil {
+		return err
+	}
+	properties = append(properties, resourcesProperties...)
+	// the properties from the annotations come last, to override ours
+	properties = append(properties, c.SystemdProps...)
+
+	if err := startUnit(m.conn(), unitName, properties); err != nil {
+		return err
+	}
+
+	path, err := m.getUnifiedPath()
+	if err != nil {
+		return err
+	}
+	// the unit may exist already, with another process
+	if pid != -1 {
+		if err := cgroups.WriteCgroupProc(path, pid); err != nil {
+			return err
+		}
+	}
+
+	m.mu.Lock()
+	m.Paths = map[string]string{"": path}
+	m.mu.Unlock()
+	return nil
+}
+
+// getUnifiedPath returns the path of the cgroup of the unit of the container.
+func (m *UnifiedManager) getUnifiedPath() (string, error) {
+	root, err := m.managerCgroup()
+	if err != nil {
+		return "", err
+	}
+
+	slice, err := ExpandSlice(parentSlice(m.Cgroups, m.Rootless))
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(cgroups.UnifiedMountpoint, root, slice, getUnitName(m.Cgroups)), nil
+}
+
+// managerCgroup returns the cgroup of the systemd instance managing the unit,
+// the slices of the unit are below it.
+func (m *UnifiedManager) managerCgroup() (string, error) {
+	if m.Rootless {
+		// the user instance runs in the cgroup of its service, such as
+		// /user.slice/user-1000.slice/user@1000.service
+		cgroup, err := m.conn().GetManagerProperty("ControlGroup")
+		if err != nil {
+			return "", err
+		}
+		return strings.Trim(cgroup, `"`), nil
+	}
+
+	initPath, err := cgroups.GetInitCgroup("")
+	if err != nil {
+		return "", err
+	}
+	// if pid 1 is systemd 226 or later, it will be in init.scope, not the root
+	return strings.TrimSuffix(filepath.Clean(initPath), "init.scope"), nil
+}
+
+// fsManager returns the fs2 manager of the cgroup of the unit, which reads
+// and writes its files.
+func (m *UnifiedManager) fsManager() *fs2.Manager {
+	return &fs2.Manager{
+		Cgroups:  m.Cgroups,
+		Rootless: m.Rootless,
+		Paths:    m.GetPaths(),
+	}
+}
+
+func (m *UnifiedManager) Destroy() error {
+	if m.Cgroups.Paths != nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.conn().StopUnit(getUnitName(m.Cgroups), "replace", nil)
+	if err := cgroups.RemovePaths(m.Paths); err != nil {
+		return err
+	}
+	m.Paths = make(map[string]string)
+	return nil
+}
+
+func (m *UnifiedManager) GetPaths() map[string]string {
+	m.mu.Lock()
+	paths := m.Paths
+	m.mu.Unlock()
+	return paths
+}
+
+func (m *UnifiedManager) Freeze(state configs.FreezerState) error {
+	return m.fsManager().Freeze(state)
+}
+
+func (m *UnifiedManager) GetPids() ([]int, error) {
+	return m.fsManager().GetPids()
+}
+
+func (m *UnifiedManager) GetAllPids() ([]int, error) {
+	return m.fsManager().GetAllPids()
+}
+
+func (m *UnifiedManager) GetStats() (*cgroups.Stats, error) {
+	return m.fsManager().GetStats()
+}
+
+func (m *UnifiedManager) Set(container *configs.Config) error {
+	// If Paths are set, then we are just joining cgroups paths
+	// and there is no need to set any values.
+	if m.Cgroups.Paths != nil {
+		return nil
+	}
+	properties, err := m.resourcesProperties(container.Cgroups.Resources)
+	if err != nil {
+		return err
+	}
+	if err := setUnitProperties(m.conn(), getUnitName(container.Cgroups), properties); err != nil {
+		return err
+	}
+	if err := m.fsManager().Set(container); err != nil {
+		if m.Rootless {
+			return fmt.Errorf("%v, the controller may not be delegated to the systemd user instance", err)
+		}
+		return err
+	}
+	return nil
+}
+
+// Snapshot saves the values of the cgroup files that Set may change.
+func (m *UnifiedManager) Snapshot() (*cgroups.Snapshot, error) {
+	return m.fsManager().Snapshot()
+}
@@ -0,0 +1,94 @@
+// +build linux,!static_build
+
+package systemd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	systemdDbus "github.com/coreos/go-systemd/dbus"
+	systemdUtil "github.com/coreos/go-systemd/util"
+	"github.com/godbus/dbus"
+	"github.com/opencontainers/runc/libcontainer/cgroups"
+	"github.com/opencontainers/runc/libcontainer/system"
+	"github.com/opencontainers/runc/libcontainer/user"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	userConnLock sync.Mutex
+	theUserConn  *systemdDbus.Conn
+)
+
+// UseSystemdUser returns whether the systemd user instance of the current
+// user can manage the cgroups of rootless containers. systemd only delegates
+// cgroups to unprivileged users on the cgroup v2 unified hierarchy.
+func UseSystemdUser() bool {
+	if !systemdUtil.IsRunningSystemd() || !cgroups.IsCgroup2UnifiedMode() {
+		return false
+	}
+
+	userConnLock.Lock()
+	defer userConnLock.Unlock()
+
+	if theUserConn == nil {
+		conn, err := newUserConnection()
+		if err != nil {
+			logrus.Debugf("cannot connect to the systemd user instance: %v", err)
+			return false
+		}
+		theUserConn = conn
+		featuresOnce.Do(func() { detectFeatures(theUserConn) })
+	}
+	return hasStartTransientUnit
+}
+
+// newUserConnection connects to the private socket of the systemd user
+// instance, which does not need a session bus.
+func newUserConnection() (*systemdDbus.Conn, error) {
+	runtimeDir := os.Getenv("XDG_RUNTIME_DIR")
+	if runtimeDir == "" {
+		return nil, fmt.Errorf("XDG_RUNTIME_DIR is not set")
+	}
+	uid, err := hostUID()
+	if err != nil {
+		return nil, err
+	}
+	address := "unix:path=" + filepath.Join(runtimeDir, "systemd/private")
+
+	return systemdDbus.NewConnection(func() (*dbus.Conn, error) {
+		conn, err := dbus.Dial(address)
+		if err != nil {
+			return nil, err
+		}
+		// Only use EXTERNAL method, with the uid systemd sees on the socket.
+		// Hello is skipped when talking directly to systemd.
+		if err := conn.Auth([]dbus.Auth{dbus.AuthExternal(strconv.Itoa(uid))}); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return conn, nil
+	})
+}
+
+// hostUID returns the uid of the current user in the parent user namespace
+// when running in a user namespace, such as the one of rootlesskit.
+func hostUID() (int, error) {
+	uid := os.Getuid()
+	if !system.RunningInUserNS() {
+		return uid, nil
+	}
+	maps, err := user.CurrentProcessUIDMap()
+	if err != nil {
+		return -1, err
+	}
+	for _, m := range maps {
+		if int64(uid) >= m.ID && int64(uid) < m.ID+m.Count {
+			return int(m.ParentID + int64(uid) - m.ID), nil
+		}
+	}
+	return -1, fmt.Errorf("uid %d is not mapped in the user namespace", uid)
+}
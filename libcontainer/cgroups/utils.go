@@ -11,6 +11,7 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	units "github.com/docker/go-units"
@@ -20,8 +21,29 @@ import (
 const (
 	CgroupNamePrefix = "name="
 	CgroupProcesses  = "cgroup.procs"
+
+	// UnifiedMountpoint is the mountpoint of the cgroup v2 unified hierarchy.
+	UnifiedMountpoint = "/sys/fs/cgroup"
+)
+
+var (
+	isUnifiedOnce sync.Once
+	isUnified     bool
 )
 
+// IsCgroup2UnifiedMode returns whether the host is booted with a pure cgroup v2
+// hierarchy, i.e. /sys/fs/cgroup is a cgroup2 filesystem.
+func IsCgroup2UnifiedMode() bool {
+	isUnifiedOnce.Do(func() {
+		var st unix.Statfs_t
+		if err := unix.Statfs(UnifiedMountpoint, &st); err != nil {
+			return
+		}
+		isUnified = st.Type == unix.CGROUP2_SUPER_MAGIC
+	})
+	return isUnified
+}
+
 // https://www.kernel.org/doc/Documentation/cgroup-v1/cgroups.txt
 func FindCgroupMountpoint(cgroupPath, subsystem string) (string, error) {
 	mnt, _, err := FindCgroupMountpointAndRoot(cgroupPath, subsystem)
@@ -501,3 +523,51 @@ func isEINVAL(err error) bool {
 		return false
 	}
 }
+
+// ConvertCPUSharesToCgroupV2Value converts CPU shares, in the [2-262144] range
+// of cgroup v1, to the [1-10000] range of cgroup v2 cpu.weight. 0 stays 0,
+// meaning unset.
+func ConvertCPUSharesToCgroupV2Value(cpuShares uint64) uint64 {
+	if cpuShares == 0 {
+		return 0
+	}
+	if cpuShares < 2 {
+		cpuShares = 2
+	}
+	if cpuShares > 262144 {
+		cpuShares = 262144
+	}
+	return 1 + ((cpuShares-2)*9999)/262142
+}
+
+// ConvertBlkIOToCgroupV2Value converts a blkio weight, in the [10-1000] range
+// of cgroup v1, to the [1-10000] range of cgroup v2 io.weight. 0 stays 0,
+// meaning unset.
+func ConvertBlkIOToCgroupV2Value(blkIoWeight uint16) uint64 {
+	if blkIoWeight == 0 {
+		return 0
+	}
+	weight := uint64(blkIoWeight)
+	if weight < 10 {
+		weight = 10
+	}
+	if weight > 1000 {
+		weight = 1000
+	}
+	return 1 + (weight-10)*9999/990
+}
+
+// ConvertMemorySwapToCgroupV2Value converts the memory+swap limit of cgroup v1
+// to the swap limit of cgroup v2 memory.swap.max, -1 meaning unlimited.
+func ConvertMemorySwapToCgroupV2Value(memorySwap, memory int64) (int64, error) {
+	if memorySwap == -1 {
+		return -1, nil
+	}
+	if memory <= 0 {
+		return 0, fmt.Errorf("unable to set swap limit without memory limit")
+	}
+	if memorySwap < memory {
+		return 0, fmt.Errorf("memory+swap limit should be greater than or equal to memory limit")
+	}
+	return memorySwap - memory, nil
+}
@@ -421,3 +421,59 @@ func TestFindCgroupMountpointAndRoot(t *testing.T) {
 		}
 	}
 }
+
+func TestConvertCPUSharesToCgroupV2Value(t *testing.T) {
+	cases := map[uint64]uint64{
+		0:      0,
+		2:      1,
+		1024:   39,
+		262144: 10000,
+	}
+	for shares, want := range cases {
+		if got := ConvertCPUSharesToCgroupV2Value(shares); got != want {
+			t.Errorf("ConvertCPUSharesToCgroupV2Value(%d) = %d, want %d", shares, got, want)
+		}
+	}
+}
+
+func TestConvertBlkIOToCgroupV2Value(t *testing.T) {
+	cases := map[uint16]uint64{
+		0:    0,
+		10:   1,
+		500:  4950,
+		1000: 10000,
+	}
+	for weight, want := range cases {
+		if got := ConvertBlkIOToCgroupV2Value(weight); got != want {
+			t.Errorf("ConvertBlkIOToCgroupV2Value(%d) = %d, want %d", weight, got, want)
+		}
+	}
+}
+
+func TestConvertMemorySwapToCgroupV2Value(t *testing.T) {
+	cases := []struct {
+		memorySwap, memory, want int64
+		expectErr                bool
+	}{
+		{memorySwap: -1, memory: 0, want: -1},
+		{memorySwap: 300, memory: 100, want: 200},
+		{memorySwap: 100, memory: 100, want: 0},
+		{memorySwap: 300, memory: 0, expectErr: true},
+		{memorySwap: 100, memory: 300, expectErr: true},
+	}
+	for _, c := range cases {
+		got, err := ConvertMemorySwapToCgroupV2Value(c.memorySwap, c.memory)
+		if c.expectErr {
+			if err == nil {
+				t.Errorf("expected error for memorySwap %d and memory %d", c.memorySwap, c.memory)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != c.want {
+			t.Errorf("ConvertMemorySwapToCgroupV2Value(%d, %d) = %d, want %d", c.memorySwap, c.memory, got, c.want)
+		}
+	}
+}
@@ -1,5 +1,9 @@
 package configs
 
+import (
+	systemdDbus "github.com/coreos/go-systemd/dbus"
+)
+
 type FreezerState string
 
 const (
@@ -29,6 +33,11 @@ type Cgroup struct {
 
 	// Resources contains various cgroups settings to apply
 	*Resources
+
+	// SystemdProps are the extra properties of the systemd unit of the
+	// container, set from the annotations of the spec. They are only used
+	// to start the unit, so they are not saved in the state.
+	SystemdProps []systemdDbus.Property `json:"-"`
 }
 
 type Resources struct {
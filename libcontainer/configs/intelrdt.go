@@ -1,6 +1,11 @@
 package configs
 
 type IntelRdt struct {
+	// The name of the group of the class of service (CLOS) to join, which
+	// may exist already or be shared with other containers. The group of
+	// the container is named after its id when empty.
+	ClosID string `json:"closID,omitempty"`
+
 	// The schema for L3 cache id and capacity bitmask (CBM)
 	// Format: "L3:<cache_id0>=<cbm0>;<cache_id1>=<cbm1>;..."
 	L3CacheSchema string `json:"l3_cache_schema,omitempty"`
@@ -181,7 +181,7 @@ func (v *ConfigValidator) sysctl(config *configs.Config) error {
 
 func (v *ConfigValidator) intelrdt(config *configs.Config) error {
 	if config.IntelRdt != nil {
-		if !intelrdt.IsCatEnabled() && !intelrdt.IsMbaEnabled() {
+		if !intelrdt.IsEnabled() {
 			return fmt.Errorf("intelRdt is specified in config, but Intel RDT is not supported or enabled")
 		}
 
@@ -192,6 +192,21 @@ func (v *ConfigValidator) intelrdt(config *configs.Config) error {
 			return fmt.Errorf("intelRdt.memBwSchema is specified in config, but Intel RDT/MBA is not enabled")
 		}
 
+		if closID := config.IntelRdt.ClosID; closID != "" {
+			if closID != filepath.Base(closID) || closID == "." || closID == ".." || closID == "info" || closID == "mon_groups" || closID == "mon_data" {
+				return fmt.Errorf("invalid intelRdt.closID %q", closID)
+			}
+		}
+
+		// With no schema, the container only has a monitoring group, or
+		// joins a class of service configured before
+		if config.IntelRdt.L3CacheSchema == "" && config.IntelRdt.MemBwSchema == "" {
+			if config.IntelRdt.ClosID == "" && !intelrdt.IsMonitoringEnabled() {
+				return fmt.Errorf("intelRdt is specified in config with no schema, but Intel RDT monitoring is not enabled")
+			}
+			return nil
+		}
+
 		if intelrdt.IsCatEnabled() && config.IntelRdt.L3CacheSchema == "" {
 			return fmt.Errorf("Intel RDT/CAT is enabled and intelRdt is specified in config, but intelRdt.l3CacheSchema is empty")
 		}
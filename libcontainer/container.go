@@ -115,8 +115,11 @@ type BaseContainer interface {
 	// Set resources of container as configured
 	//
 	// We can use this to change resources when containers are running.
+	// The device nodes of the devices added to or removed from the config are
+	// created or removed in the container.
 	//
 	// errors:
+	// ConfigInvalid - config is invalid,
 	// SystemError - System error.
 	Set(config configs.Config) error
 
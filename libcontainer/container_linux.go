@@ -53,6 +53,7 @@ type linuxContainer struct {
 	criuVersion          int
 	state                containerState
 	created              time.Time
+	subCgroups           []string
 }
 
 // State represents a running container's state
@@ -78,6 +79,11 @@ type State struct {
 
 	// Intel RDT "resource control" filesystem path
 	IntelRdtPath string `json:"intel_rdt_path"`
+
+	// SubCgroups are the sub-cgroups created by runc for the processes started
+	// in the container, relative to its cgroups. They are removed once they
+	// have no processes left.
+	SubCgroups []string `json:"sub_cgroups,omitempty"`
 }
 
 // Container is a libcontainer container object.
@@ -134,6 +140,21 @@ type Container interface {
 	// errors:
 	// Systemerror - System error.
 	NotifyMemoryPressure(level PressureLevel) (<-chan struct{}, error)
+
+	// NotifyPressureStall returns a read-only channel signaling when the pressure stall trigger
+	// of a resource (cpu, memory or io) fires.
+	//
+	// errors:
+	// Systemerror - System error.
+	NotifyPressureStall(resource string, trigger PSITrigger) (<-chan struct{}, error)
+
+	// NotifyMemoryEvents returns a read-only channel receiving the increase of the memory.events
+	// counters (high, max, oom and oom_kill) of the container each time they change. It requires
+	// cgroup v2.
+	//
+	// errors:
+	// Systemerror - System error.
+	NotifyMemoryEvents() (<-chan MemoryEvents, error)
 }
 
 // ID returns the container's unique ID
@@ -180,6 +201,13 @@ func (c *linuxContainer) Stats() (*Stats, error) {
 	if stats.CgroupStats, err = c.cgroupManager.GetStats(); err != nil {
 		return stats, newSystemErrorWithCause(err, "getting container stats from cgroups")
 	}
+	// the stats are read only, the sub-cgroups recorded by the processes
+	// started since the container was loaded are reported without pruning
+	subCgroups, err := c.loadSubCgroups()
+	if err != nil {
+		subCgroups = c.subCgroups
+	}
+	stats.SubCgroupStats = getSubCgroupStats(c.cgroupManager.GetPaths(), subCgroups)
 	if c.intelRdtManager != nil {
 		if stats.IntelRdtStats, err = c.intelRdtManager.GetStats(); err != nil {
 			return stats, newSystemErrorWithCause(err, "getting container's Intel RDT stats")
@@ -208,28 +236,212 @@ func (c *linuxContainer) Set(config configs.Config) error {
 	if status == Stopped {
 		return newGenericError(fmt.Errorf("container not running"), ContainerNotRunning)
 	}
-	if err := c.cgroupManager.Set(&config); err != nil {
-		// Set configs back
-		if err2 := c.cgroupManager.Set(c.config); err2 != nil {
-			logrus.Warnf("Setting back cgroup configs failed due to error: %v, your state.json and actual configs might be inconsistent.", err2)
-		}
-		return err
+	// The current values are saved to restore them if any part of the
+	// update fails, instead of leaving it half applied.
+	snapshot, err := c.cgroupManager.Snapshot()
+	if err != nil {
+		return newSystemErrorWithCause(err, "saving cgroup config")
 	}
+	var rdtSnapshot *cgroups.Snapshot
 	if c.intelRdtManager != nil {
-		if err := c.intelRdtManager.Set(&config); err != nil {
-			// Set configs back
-			if err2 := c.intelRdtManager.Set(c.config); err2 != nil {
-				logrus.Warnf("Setting back intelrdt configs failed due to error: %v, your state.json and actual configs might be inconsistent.", err2)
-			}
-			return err
+		if rdtSnapshot, err = c.intelRdtManager.Snapshot(); err != nil {
+			return newSystemErrorWithCause(err, "saving intelrdt config")
 		}
 	}
+	if err := c.set(&config); err != nil {
+		c.restoreConfig(&config, snapshot, rdtSnapshot)
+		return err
+	}
 	// After config setting succeed, update config and states
 	c.config = &config
 	_, err = c.updateState(nil)
 	return err
 }
 
+// set applies config to the running container.
+func (c *linuxContainer) set(config *configs.Config) error {
+	if err := c.cgroupManager.Set(config); err != nil {
+		return newSystemErrorWithCause(err, "setting cgroup config")
+	}
+	if c.intelRdtManager != nil {
+		if err := c.intelRdtManager.Set(config); err != nil {
+			return newSystemErrorWithCause(err, "setting intelrdt config")
+		}
+	}
+	if !reflect.DeepEqual(c.config.Rlimits, config.Rlimits) {
+		if err := c.setProcessRlimits(config.Rlimits); err != nil {
+			return err
+		}
+	}
+	return c.setDeviceNodes(c.config.Devices, config.Devices)
+}
+
+// restoreConfig restores the config of the container after applying config
+// failed. The device nodes are restored by setDeviceNodes itself.
+func (c *linuxContainer) restoreConfig(config *configs.Config, snapshot, rdtSnapshot *cgroups.Snapshot) {
+	// The device rules are not saved by the snapshot, they are set again
+	// from the config along the other values it has.
+	if err := c.cgroupManager.Set(c.config); err != nil {
+		logrus.Warnf("Setting back cgroup configs failed due to error: %v, your state.json and actual configs might be inconsistent.", err)
+	}
+	if err := snapshot.Restore(); err != nil {
+		logrus.Warnf("Restoring cgroup values failed due to error: %v, your state.json and actual configs might be inconsistent.", err)
+	}
+	if rdtSnapshot != nil {
+		if err := rdtSnapshot.Restore(); err != nil {
+			logrus.Warnf("Restoring intelrdt schemata failed due to error: %v, your state.json and actual configs might be inconsistent.", err)
+		}
+	}
+	if !reflect.DeepEqual(c.config.Rlimits, config.Rlimits) {
+		if err := c.setProcessRlimits(c.config.Rlimits); err != nil {
+			logrus.Warnf("Setting back rlimits failed due to error: %v, your state.json and actual configs might be inconsistent.", err)
+		}
+	}
+}
+
+// setProcessRlimits sets the rlimits of all the processes of the container.
+func (c *linuxContainer) setProcessRlimits(limits []configs.Rlimit) error {
+	pids, err := c.cgroupManager.GetAllPids()
+	if err != nil {
+		return newSystemErrorWithCause(err, "getting container pids")
+	}
+	for _, pid := range pids {
+		for _, rlimit := range limits {
+			if err := system.Prlimit(pid, rlimit.Type, unix.Rlimit{Max: rlimit.Hard, Cur: rlimit.Soft}); err != nil {
+				if err == unix.ESRCH {
+					// the process exited in the meantime
+					break
+				}
+				return newSystemErrorWithCausef(err, "setting rlimit type %v of pid %d", rlimit.Type, pid)
+			}
+		}
+	}
+	return nil
+}
+
+// setDeviceNodes creates the device nodes added to the devices of the
+// container and removes the ones removed from them, in the mount namespace of
+// the container.
+func (c *linuxContainer) setDeviceNodes(old, new []*configs.Device) error {
+	added, removed := diffDevices(old, new)
+	if len(added) == 0 && len(removed) == 0 {
+		return nil
+	}
+	// Device nodes of containers in a user namespace are bind mounts from the
+	// host, they can not be mounted from outside the mount namespace.
+	if c.config.Namespaces.Contains(configs.NEWUSER) || system.RunningInUserNS() {
+		return newGenericError(fmt.Errorf("cannot change the device nodes of a container in a user namespace"), ConfigInvalid)
+	}
+	rootfs := fmt.Sprintf("/proc/%d/root", c.initProcess.pid())
+	return updateDeviceNodes(rootfs, added, removed)
+}
+
+// diffDevices returns the devices of new that are not in old and the ones of
+// old that are not in new. A device whose path is reused for another device
+// is both removed and added.
+func diffDevices(old, new []*configs.Device) (added, removed []*configs.Device) {
+	byPath := make(map[string]*configs.Device, len(old))
+	for _, d := range old {
+		byPath[d.Path] = d
+	}
+	for _, d := range new {
+		o, ok := byPath[d.Path]
+		if ok && o.Type == d.Type && o.Major == d.Major && o.Minor == d.Minor {
+			delete(byPath, d.Path)
+			continue
+		}
+		added = append(added, d)
+	}
+	for _, d := range old {
+		if _, ok := byPath[d.Path]; ok {
+			removed = append(removed, d)
+		}
+	}
+	return added, removed
+}
+
+// deviceNodeAt is a device node in a directory opened by
+// utils.OpenDirNoFollow.
+type deviceNodeAt struct {
+	dir    *os.File
+	name   string
+	device *configs.Device
+}
+
+// openDeviceNodeAt opens the directory of the node of the device under
+// rootfs. The container may replace a component of the path with a symlink
+// at any time, so the path is walked without following symlinks and the node
+// is changed relative to its directory.
+func openDeviceNodeAt(rootfs string, d *configs.Device, create bool) (*deviceNodeAt, error) {
+	path := utils.CleanPath("/" + d.Path)
+	dir, err := utils.OpenDirNoFollow(rootfs, filepath.Dir(path), create, 0755)
+	if err != nil {
+		return nil, err
+	}
+	return &deviceNodeAt{dir: dir, name: filepath.Base(path), device: d}, nil
+}
+
+func (n *deviceNodeAt) create() error {
+	return mknodDeviceAt(int(n.dir.Fd()), n.name, n.device)
+}
+
+func (n *deviceNodeAt) remove() error {
+	return unix.Unlinkat(int(n.dir.Fd()), n.name, 0)
+}
+
+// updateDeviceNodes removes the nodes of the removed devices and creates the
+// ones of the added devices under rootfs. If one of them fails, the nodes
+// created are removed and the removed ones are created again.
+func updateDeviceNodes(rootfs string, added, removed []*configs.Device) (err error) {
+	oldMask := unix.Umask(0000)
+	defer unix.Umask(oldMask)
+
+	var opened, created, deleted []*deviceNodeAt
+	defer func() {
+		if err != nil {
+			for _, n := range created {
+				n.remove()
+			}
+			for _, n := range deleted {
+				n.create()
+			}
+		}
+		for _, n := range opened {
+			n.dir.Close()
+		}
+	}()
+
+	for _, d := range removed {
+		n, err := openDeviceNodeAt(rootfs, d, false)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return newSystemErrorWithCausef(err, "removing device node %s", d.Path)
+		}
+		opened = append(opened, n)
+		if err := n.remove(); err != nil {
+			if err == unix.ENOENT {
+				continue
+			}
+			return newSystemErrorWithCausef(err, "removing device node %s", d.Path)
+		}
+		deleted = append(deleted, n)
+	}
+	for _, d := range added {
+		n, err := openDeviceNodeAt(rootfs, d, true)
+		if err != nil {
+			return newSystemErrorWithCausef(err, "creating device node %s", d.Path)
+		}
+		opened = append(opened, n)
+		if err := n.create(); err != nil {
+			return newSystemErrorWithCausef(err, "creating device node %s", d.Path)
+		}
+		created = append(created, n)
+	}
+	return nil
+}
+
 func (c *linuxContainer) Start(process *Process) error {
 	c.m.Lock()
 	defer c.m.Unlock()
@@ -333,6 +545,11 @@ type openResult struct {
 }
 
 func (c *linuxContainer) start(process *Process) error {
+	if !process.Init {
+		if err := c.recordSubCgroup(process.SubCgroup); err != nil {
+			return err
+		}
+	}
 	parent, err := c.newParentProcess(process)
 	if err != nil {
 		return newSystemErrorWithCause(err, "creating new parent process")
@@ -374,6 +591,57 @@ func (c *linuxContainer) start(process *Process) error {
 	return nil
 }
 
+// recordSubCgroup prunes the sub-cgroups left by the former processes, and
+// records the sub-cgroup name before the process creates it, so that it is
+// pruned even if runc does not wait for the process.
+func (c *linuxContainer) recordSubCgroup(name string) error {
+	recorded, err := c.loadSubCgroups()
+	if err != nil {
+		return newSystemErrorWithCause(err, "loading sub-cgroups")
+	}
+	left := pruneSubCgroups(c.cgroupManager.GetPaths(), recorded)
+	changed := len(left) != len(recorded)
+	if name != "" {
+		name = filepath.Clean(name)
+		found := false
+		for _, sub := range left {
+			if sub == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			left = append(left, name)
+			changed = true
+		}
+	}
+	c.subCgroups = left
+	if !changed {
+		return nil
+	}
+	if _, err := c.updateState(nil); err != nil {
+		return newSystemErrorWithCause(err, "recording sub-cgroups")
+	}
+	return nil
+}
+
+// loadSubCgroups returns the sub-cgroups recorded in the state file, which
+// the other runc processes may have changed since the container was loaded.
+func (c *linuxContainer) loadSubCgroups() ([]string, error) {
+	f, err := os.Open(filepath.Join(c.root, stateFilename))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var state struct {
+		SubCgroups []string `json:"sub_cgroups"`
+	}
+	if err := json.NewDecoder(f).Decode(&state); err != nil {
+		return nil, err
+	}
+	return state.SubCgroups, nil
+}
+
 func (c *linuxContainer) Signal(s os.Signal, all bool) error {
 	if all {
 		return signalAllProcesses(c.cgroupManager, s)
@@ -534,9 +802,16 @@ func (c *linuxContainer) newSetnsProcess(p *Process, cmd *exec.Cmd, parentPipe,
 	if err != nil {
 		return nil, err
 	}
+	var sub *subCgroup
+	if p.SubCgroup != "" {
+		if sub, err = newSubCgroup(c.cgroupManager.GetPaths(), p.SubCgroup, p.SubCgroupResources); err != nil {
+			return nil, newGenericError(err, ConfigInvalid)
+		}
+	}
 	return &setnsProcess{
 		cmd:             cmd,
 		cgroupPaths:     c.cgroupManager.GetPaths(),
+		subCgroup:       sub,
 		rootlessCgroups: c.config.RootlessCgroups,
 		intelRdtPath:    state.IntelRdtPath,
 		childPipe:       childPipe,
@@ -642,6 +917,22 @@ func (c *linuxContainer) NotifyMemoryPressure(level PressureLevel) (<-chan struc
 	return notifyMemoryPressure(c.cgroupManager.GetPaths(), level)
 }
 
+func (c *linuxContainer) NotifyMemoryEvents() (<-chan MemoryEvents, error) {
+	// XXX(cyphar): This requires cgroups.
+	if c.config.RootlessCgroups {
+		logrus.Warn("getting memory event notifications may fail if you don't have the full access to cgroups")
+	}
+	return notifyMemoryEvents(c.cgroupManager.GetPaths())
+}
+
+func (c *linuxContainer) NotifyPressureStall(resource string, trigger PSITrigger) (<-chan struct{}, error) {
+	// XXX(cyphar): This requires cgroups.
+	if c.config.RootlessCgroups {
+		logrus.Warn("getting pressure stall notifications may fail if you don't have the full access to cgroups")
+	}
+	return notifyPressureStall(c.cgroupManager.GetPaths(), resource, trigger)
+}
+
 var criuFeatures *criurpc.CriuFeatures
 
 func (c *linuxContainer) checkCriuFeatures(criuOpts *CriuOpts, rpcOpts *criurpc.CriuOpts, criuFeat *criurpc.CriuFeatures) error {
@@ -997,7 +1288,12 @@ func (c *linuxContainer) Checkpoint(criuOpts *CriuOpts) error {
 		}
 	}
 
-	fcg := c.cgroupManager.GetPaths()["freezer"]
+	paths := c.cgroupManager.GetPaths()
+	fcg := paths["freezer"]
+	if fcg == "" {
+		// cgroup v2, criu freezes the unified cgroup
+		fcg = paths[""]
+	}
 	if fcg != "" {
 		rpcOpts.FreezeCgroup = proto.String(fcg)
 	}
@@ -1793,12 +2089,19 @@ func (c *linuxContainer) runType() (Status, error) {
 }
 
 func (c *linuxContainer) isPaused() (bool, error) {
-	fcg := c.cgroupManager.GetPaths()["freezer"]
+	paths := c.cgroupManager.GetPaths()
+	file, frozen := "freezer.state", []byte("FROZEN")
+	fcg := paths["freezer"]
+	if unified, ok := paths[""]; ok && fcg == "" {
+		// cgroup v2 has no freezer controller, every cgroup can be frozen
+		file, frozen = "cgroup.freeze", []byte("1")
+		fcg = unified
+	}
 	if fcg == "" {
 		// A container doesn't have a freezer cgroup
 		return false, nil
 	}
-	data, err := ioutil.ReadFile(filepath.Join(fcg, "freezer.state"))
+	data, err := ioutil.ReadFile(filepath.Join(fcg, file))
 	if err != nil {
 		// If freezer cgroup is not mounted, the container would just be not paused.
 		if os.IsNotExist(err) {
@@ -1806,7 +2109,7 @@ func (c *linuxContainer) isPaused() (bool, error) {
 		}
 		return false, newSystemErrorWithCause(err, "checking if container is paused")
 	}
-	return bytes.Equal(bytes.TrimSpace(data), []byte("FROZEN")), nil
+	return bytes.Equal(bytes.TrimSpace(data), frozen), nil
 }
 
 func (c *linuxContainer) currentState() (*State, error) {
@@ -1820,9 +2123,9 @@ func (c *linuxContainer) currentState() (*State, error) {
 		startTime, _ = c.initProcess.startTime()
 		externalDescriptors = c.initProcess.externalDescriptors()
 	}
-	intelRdtPath, err := intelrdt.GetIntelRdtPath(c.ID())
-	if err != nil {
-		intelRdtPath = ""
+	intelRdtPath := ""
+	if c.intelRdtManager != nil {
+		intelRdtPath = c.intelRdtManager.GetPath()
 	}
 	state := &State{
 		BaseState: BaseState{
@@ -1837,6 +2140,7 @@ func (c *linuxContainer) currentState() (*State, error) {
 		IntelRdtPath:        intelRdtPath,
 		NamespacePaths:      make(map[configs.NamespaceType]string),
 		ExternalDescriptors: externalDescriptors,
+		SubCgroups:          c.subCgroups,
 	}
 	if pid > 0 {
 		for _, ns := range c.config.Namespaces {
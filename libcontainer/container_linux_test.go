@@ -6,12 +6,15 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/opencontainers/runc/libcontainer/cgroups"
 	"github.com/opencontainers/runc/libcontainer/configs"
 	"github.com/opencontainers/runc/libcontainer/intelrdt"
 	"github.com/opencontainers/runc/libcontainer/system"
+
+	"golang.org/x/sys/unix"
 )
 
 type mockCgroupManager struct {
@@ -54,6 +57,10 @@ func (m *mockCgroupManager) GetPaths() map[string]string {
 	return m.paths
 }
 
+func (m *mockCgroupManager) Snapshot() (*cgroups.Snapshot, error) {
+	return &cgroups.Snapshot{}, nil
+}
+
 func (m *mockCgroupManager) Freeze(state configs.FreezerState) error {
 	return nil
 }
@@ -74,6 +81,10 @@ func (m *mockIntelRdtManager) GetPath() string {
 	return m.path
 }
 
+func (m *mockIntelRdtManager) Snapshot() (*cgroups.Snapshot, error) {
+	return &cgroups.Snapshot{}, nil
+}
+
 func (m *mockIntelRdtManager) Set(container *configs.Config) error {
 	return nil
 }
@@ -353,3 +364,172 @@ func TestGetContainerStateAfterUpdate(t *testing.T) {
 		t.Fatalf("expected Memory to be 2048 but received %q", state.Config.Cgroups.Memory)
 	}
 }
+
+func TestDiffDevices(t *testing.T) {
+	var (
+		null = &configs.Device{Type: 'c', Path: "/dev/null", Major: 1, Minor: 3}
+		zero = &configs.Device{Type: 'c', Path: "/dev/zero", Major: 1, Minor: 5}
+		full = &configs.Device{Type: 'c', Path: "/dev/full", Major: 1, Minor: 7}
+		// /dev/zero reused for another device
+		zero2 = &configs.Device{Type: 'c', Path: "/dev/zero", Major: 1, Minor: 8}
+	)
+	added, removed := diffDevices([]*configs.Device{null, zero}, []*configs.Device{null, zero2, full})
+	if len(added) != 2 || added[0] != zero2 || added[1] != full {
+		t.Fatalf("unexpected added devices %v", added)
+	}
+	if len(removed) != 1 || removed[0] != zero {
+		t.Fatalf("unexpected removed devices %v", removed)
+	}
+
+	added, removed = diffDevices([]*configs.Device{null, zero}, []*configs.Device{null, zero})
+	if len(added) != 0 || len(removed) != 0 {
+		t.Fatalf("expected no change, got added %v removed %v", added, removed)
+	}
+}
+
+func TestUpdateDeviceNodes(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("creating device nodes requires root")
+	}
+	rootfs, err := ioutil.TempDir("", "TestUpdateDeviceNodes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(rootfs)
+
+	var (
+		null = &configs.Device{Type: 'c', Path: "/dev/null", Major: 1, Minor: 3, FileMode: 0666}
+		zero = &configs.Device{Type: 'c', Path: "/dev/zero", Major: 1, Minor: 5, FileMode: 0666}
+		bad  = &configs.Device{Type: 'x', Path: "/dev/bad"}
+	)
+	if err := updateDeviceNodes(rootfs, []*configs.Device{null}, nil); err != nil {
+		t.Fatal(err)
+	}
+	var stat unix.Stat_t
+	if err := unix.Stat(filepath.Join(rootfs, "dev/null"), &stat); err != nil {
+		t.Fatal(err)
+	}
+	if stat.Mode&unix.S_IFMT != unix.S_IFCHR || unix.Major(uint64(stat.Rdev)) != 1 || unix.Minor(uint64(stat.Rdev)) != 3 {
+		t.Fatalf("unexpected device node mode %o rdev %d", stat.Mode, stat.Rdev)
+	}
+
+	// a failure restores the previous nodes
+	if err := updateDeviceNodes(rootfs, []*configs.Device{zero, bad}, []*configs.Device{null}); err == nil {
+		t.Fatal("expected an invalid device type to fail")
+	}
+	if _, err := os.Lstat(filepath.Join(rootfs, "dev/null")); err != nil {
+		t.Fatalf("removed device node not restored: %v", err)
+	}
+	if _, err := os.Lstat(filepath.Join(rootfs, "dev/zero")); !os.IsNotExist(err) {
+		t.Fatalf("created device node not removed: %v", err)
+	}
+
+	if err := updateDeviceNodes(rootfs, []*configs.Device{zero}, []*configs.Device{null}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Lstat(filepath.Join(rootfs, "dev/null")); !os.IsNotExist(err) {
+		t.Fatalf("device node not removed: %v", err)
+	}
+	if _, err := os.Lstat(filepath.Join(rootfs, "dev/zero")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUpdateDeviceNodesSymlinkedDev(t *testing.T) {
+	rootfs, err := ioutil.TempDir("", "TestUpdateDeviceNodesSymlinkedDev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(rootfs)
+	host, err := ioutil.TempDir("", "TestUpdateDeviceNodesSymlinkedDevHost")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(host)
+
+	// a fifo does not need root to be created
+	fifo := &configs.Device{Type: 'p', Path: "/dev/fifo", FileMode: 0666}
+	for _, target := range []string{host, "../" + filepath.Base(host)} {
+		os.Remove(filepath.Join(rootfs, "dev"))
+		if err := os.Symlink(target, filepath.Join(rootfs, "dev")); err != nil {
+			t.Fatal(err)
+		}
+		if err := updateDeviceNodes(rootfs, []*configs.Device{fifo}, nil); err == nil {
+			t.Fatalf("expected an error creating a device node in a symlinked /dev to %s", target)
+		}
+		if _, err := os.Lstat(filepath.Join(host, "fifo")); !os.IsNotExist(err) {
+			t.Fatalf("device node created through the symlink to %s: %v", target, err)
+		}
+
+		if err := ioutil.WriteFile(filepath.Join(host, "fifo"), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := updateDeviceNodes(rootfs, nil, []*configs.Device{fifo}); err == nil {
+			t.Fatalf("expected an error removing a device node in a symlinked /dev to %s", target)
+		}
+		if _, err := os.Lstat(filepath.Join(host, "fifo")); err != nil {
+			t.Fatalf("file removed through the symlink to %s: %v", target, err)
+		}
+		os.Remove(filepath.Join(host, "fifo"))
+	}
+}
+
+func TestSetRlimits(t *testing.T) {
+	pid := os.Getpid()
+	stat, err := system.Stat(pid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var orig unix.Rlimit
+	if err := unix.Getrlimit(unix.RLIMIT_NOFILE, &orig); err != nil {
+		t.Fatal(err)
+	}
+	defer unix.Setrlimit(unix.RLIMIT_NOFILE, &orig)
+
+	rootDir, err := ioutil.TempDir("", "TestSetRlimits")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(rootDir)
+
+	container := &linuxContainer{
+		root: rootDir,
+		id:   "myid",
+		config: &configs.Config{
+			Cgroups: &configs.Cgroup{
+				Resources: &configs.Resources{},
+			},
+		},
+		initProcess: &mockProcess{
+			_pid:    pid,
+			started: stat.StartTime,
+		},
+		initProcessStartTime: stat.StartTime,
+		cgroupManager: &mockCgroupManager{
+			allPids: []int{pid},
+		},
+	}
+	container.state = &runningState{c: container}
+
+	newConfig := container.Config()
+	newConfig.Rlimits = []configs.Rlimit{
+		{Type: unix.RLIMIT_NOFILE, Soft: orig.Cur - 1, Hard: orig.Max},
+	}
+	if err := container.Set(newConfig); err != nil {
+		t.Fatal(err)
+	}
+	var rlimit unix.Rlimit
+	if err := unix.Getrlimit(unix.RLIMIT_NOFILE, &rlimit); err != nil {
+		t.Fatal(err)
+	}
+	if rlimit.Cur != orig.Cur-1 || rlimit.Max != orig.Max {
+		t.Fatalf("expected rlimit %d:%d but received %d:%d", orig.Cur-1, orig.Max, rlimit.Cur, rlimit.Max)
+	}
+	state, err := container.State()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(state.Config.Rlimits) != 1 {
+		t.Fatalf("expected the rlimits to be kept in the state, got %v", state.Config.Rlimits)
+	}
+}
@@ -14,6 +14,7 @@ import (
 	"github.com/cyphar/filepath-securejoin"
 	"github.com/opencontainers/runc/libcontainer/cgroups"
 	"github.com/opencontainers/runc/libcontainer/cgroups/fs"
+	"github.com/opencontainers/runc/libcontainer/cgroups/fs2"
 	"github.com/opencontainers/runc/libcontainer/cgroups/systemd"
 	"github.com/opencontainers/runc/libcontainer/configs"
 	"github.com/opencontainers/runc/libcontainer/configs/validate"
@@ -49,9 +50,16 @@ func InitArgs(args ...string) func(*LinuxFactory) error {
 }
 
 // SystemdCgroups is an options func to configure a LinuxFactory to return
-// containers that use systemd to create and manage cgroups.
+// containers that use systemd to create and manage cgroups. The cgroup v2
+// implementation is used if the host is booted with the unified hierarchy.
 func SystemdCgroups(l *LinuxFactory) error {
 	l.NewCgroupsManager = func(config *configs.Cgroup, paths map[string]string) cgroups.Manager {
+		if cgroups.IsCgroup2UnifiedMode() {
+			return &systemd.UnifiedManager{
+				Cgroups: config,
+				Paths:   paths,
+			}
+		}
 		return &systemd.Manager{
 			Cgroups: config,
 			Paths:   paths,
@@ -60,11 +68,33 @@ func SystemdCgroups(l *LinuxFactory) error {
 	return nil
 }
 
+// RootlessSystemdCgroups is an options func to configure a LinuxFactory to
+// return rootless containers that use the systemd user instance of the
+// current user to create and manage cgroups, in the cgroup subtree systemd
+// delegates to the user. It needs the cgroup v2 unified hierarchy.
+func RootlessSystemdCgroups(l *LinuxFactory) error {
+	l.NewCgroupsManager = func(config *configs.Cgroup, paths map[string]string) cgroups.Manager {
+		return &systemd.UnifiedManager{
+			Cgroups:  config,
+			Rootless: true,
+			Paths:    paths,
+		}
+	}
+	return nil
+}
+
 // Cgroupfs is an options func to configure a LinuxFactory to return containers
 // that use the native cgroups filesystem implementation to create and manage
-// cgroups.
+// cgroups. The cgroup v2 implementation is used if the host is booted with the
+// unified hierarchy.
 func Cgroupfs(l *LinuxFactory) error {
 	l.NewCgroupsManager = func(config *configs.Cgroup, paths map[string]string) cgroups.Manager {
+		if cgroups.IsCgroup2UnifiedMode() {
+			return &fs2.Manager{
+				Cgroups: config,
+				Paths:   paths,
+			}
+		}
 		return &fs.Manager{
 			Cgroups: config,
 			Paths:   paths,
@@ -81,6 +111,13 @@ func Cgroupfs(l *LinuxFactory) error {
 // they've been set up properly).
 func RootlessCgroupfs(l *LinuxFactory) error {
 	l.NewCgroupsManager = func(config *configs.Cgroup, paths map[string]string) cgroups.Manager {
+		if cgroups.IsCgroup2UnifiedMode() {
+			return &fs2.Manager{
+				Cgroups:  config,
+				Rootless: true,
+				Paths:    paths,
+			}
+		}
 		return &fs.Manager{
 			Cgroups:  config,
 			Rootless: true,
@@ -222,7 +259,7 @@ func (l *LinuxFactory) Create(id string, config *configs.Config) (Container, err
 		newgidmapPath: l.NewgidmapPath,
 		cgroupManager: l.NewCgroupsManager(config.Cgroups, nil),
 	}
-	if intelrdt.IsCatEnabled() || intelrdt.IsMbaEnabled() {
+	if intelrdt.IsEnabled() {
 		c.intelRdtManager = l.NewIntelRdtManager(config, id, "")
 	}
 	c.state = &stoppedState{c: c}
@@ -263,12 +300,13 @@ func (l *LinuxFactory) Load(id string) (Container, error) {
 		cgroupManager:        l.NewCgroupsManager(state.Config.Cgroups, state.CgroupPaths),
 		root:                 containerRoot,
 		created:              state.Created,
+		subCgroups:           state.SubCgroups,
 	}
 	c.state = &loadedState{c: c}
 	if err := c.refreshState(); err != nil {
 		return nil, err
 	}
-	if intelrdt.IsCatEnabled() || intelrdt.IsMbaEnabled() {
+	if intelrdt.IsEnabled() {
 		c.intelRdtManager = l.NewIntelRdtManager(&state.Config, id, state.IntelRdtPath)
 	}
 	return c, nil
@@ -0,0 +1,204 @@
+// +build linux
+
+package intelrdt
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// The directory of the members of the shared classes of service. The groups
+// outlive the runc processes joining them, so their members are kept out of
+// the "resource control" filesystem, which only has the kernel files.
+var closStateDir = "/run/runc-intelrdt"
+
+// closState is the membership of a shared class of service, locked against
+// the other runc processes until it is closed.
+type closState struct {
+	lock *os.File
+	dir  string
+}
+
+func openClosState(closID string) (*closState, error) {
+	if err := os.MkdirAll(closStateDir, 0700); err != nil {
+		return nil, err
+	}
+	lock, err := os.Open(closStateDir)
+	if err != nil {
+		return nil, err
+	}
+	if err := unix.Flock(int(lock.Fd()), unix.LOCK_EX); err != nil {
+		lock.Close()
+		return nil, fmt.Errorf("unable to lock %s: %v", closStateDir, err)
+	}
+	return &closState{lock: lock, dir: filepath.Join(closStateDir, closID)}, nil
+}
+
+// close releases the lock.
+func (s *closState) close() {
+	s.lock.Close()
+}
+
+// owned returns whether runc created the group, and removes it with its last
+// member. The groups configured by the administrator are never removed.
+func (s *closState) owned() bool {
+	_, err := os.Stat(filepath.Join(s.dir, "owned"))
+	return err == nil
+}
+
+func (s *closState) members() ([]string, error) {
+	entries, err := ioutil.ReadDir(filepath.Join(s.dir, "members"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	var members []string
+	for _, entry := range entries {
+		members = append(members, entry.Name())
+	}
+	return members, nil
+}
+
+func (s *closState) add(id string, owned bool) error {
+	if err := os.MkdirAll(filepath.Join(s.dir, "members"), 0700); err != nil {
+		return err
+	}
+	if owned {
+		if err := ioutil.WriteFile(filepath.Join(s.dir, "owned"), nil, 0600); err != nil {
+			return err
+		}
+	}
+	return ioutil.WriteFile(filepath.Join(s.dir, "members", id), nil, 0600)
+}
+
+// remove removes a member, and returns the number of the remaining ones.
+func (s *closState) remove(id string) (int, error) {
+	if err := os.Remove(filepath.Join(s.dir, "members", id)); err != nil && !os.IsNotExist(err) {
+		return 0, err
+	}
+	members, err := s.members()
+	if err != nil {
+		return 0, err
+	}
+	return len(members), nil
+}
+
+// joinClos adds the container to the members of the class of service closID
+// in root. The group is created with the schemata when they are set and it
+// does not exist. They are written before the lock is released, the members
+// joining the group in the meantime check their schemata against them.
+func joinClos(root, closID, id, schemata string) error {
+	s, err := openClosState(closID)
+	if err != nil {
+		return err
+	}
+	defer s.close()
+
+	owned := false
+	group := filepath.Join(root, closID)
+	if _, err := os.Stat(group); err != nil {
+		if !os.IsNotExist(err) {
+			return err
+		}
+		if schemata == "" {
+			return fmt.Errorf("the Intel RDT class of service %q does not exist in %s", closID, root)
+		}
+		if err := os.Mkdir(group, 0755); err != nil {
+			return NewLastCmdError(err)
+		}
+		if err := writeFile(group, "schemata", schemata); err != nil {
+			os.Remove(group)
+			return NewLastCmdError(err)
+		}
+		owned = true
+	}
+	return s.add(id, owned)
+}
+
+// leaveClos removes the container from the members of the class of service
+// closID in root, and removes the group created by runc with its last member.
+func leaveClos(root, closID, id string) error {
+	s, err := openClosState(closID)
+	if err != nil {
+		return err
+	}
+	defer s.close()
+
+	remaining, err := s.remove(id)
+	if err != nil || remaining > 0 {
+		return err
+	}
+	if s.owned() {
+		if err := os.RemoveAll(filepath.Join(root, closID)); err != nil {
+			return err
+		}
+	}
+	return os.RemoveAll(s.dir)
+}
+
+// isClosOwner returns whether the container is the only member of the class
+// of service closID, and runc created its group.
+func isClosOwner(closID, id string) (bool, error) {
+	s, err := openClosState(closID)
+	if err != nil {
+		return false, err
+	}
+	defer s.close()
+
+	members, err := s.members()
+	if err != nil {
+		return false, err
+	}
+	return s.owned() && len(members) == 1 && members[0] == id, nil
+}
+
+// parseSchemata returns the values of the schemata by resource and L3 cache
+// id, such as "L3:0". The values are normalized, as the kernel pads the
+// bitmasks with zeros.
+func parseSchemata(schemata string) map[string]string {
+	values := make(map[string]string)
+	for _, line := range strings.Split(schemata, "\n") {
+		parts := strings.SplitN(strings.TrimSpace(line), ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		resource := strings.TrimSpace(parts[0])
+		base := 16
+		if resource == "MB" {
+			base = 10
+		}
+		for _, domain := range strings.Split(parts[1], ";") {
+			kv := strings.SplitN(domain, "=", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			value := strings.TrimSpace(kv[1])
+			if v, err := strconv.ParseUint(value, base, 64); err == nil {
+				value = strconv.FormatUint(v, 10)
+			}
+			values[resource+":"+strings.TrimSpace(kv[0])] = value
+		}
+	}
+	return values
+}
+
+// checkSchemata returns an error when the schemata of the group in path do
+// not have the values of schemata.
+func checkSchemata(path, schemata string) error {
+	current, err := getIntelRdtParamString(path, "schemata")
+	if err != nil {
+		return err
+	}
+	values := parseSchemata(current)
+	for key, value := range parseSchemata(schemata) {
+		if values[key] != value {
+			return fmt.Errorf("the Intel RDT schemata %q do not match the schemata of the shared class of service in %s:\n%s", schemata, path, current)
+		}
+	}
+	return nil
+}
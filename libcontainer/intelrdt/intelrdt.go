@@ -12,6 +12,7 @@ import (
 	"strings"
 	"sync"
 
+	"github.com/opencontainers/runc/libcontainer/cgroups"
 	"github.com/opencontainers/runc/libcontainer/configs"
 )
 
@@ -119,6 +120,54 @@ import (
  * "MB:0=5000;1=7000" which means 5000 MBps memory bandwidth limit on socket 0
  * and 7000 MBps memory bandwidth limit on socket 1.
  *
+ * Intel RDT monitoring:
+ * Cache Monitoring Technology (CMT) and Memory Bandwidth Monitoring (MBM)
+ * count the L3 cache occupancy and the memory bandwidth of the tasks of a
+ * group, per L3 cache domain (socket). The kernel lists the events it
+ * supports in "info/L3_MON/mon_features":
+ * /sys/fs/resctrl/
+ * |-- info
+ * |   |-- L3_MON
+ * |       |-- mon_features
+ * |       |-- num_rmids
+ * |-- mon_groups
+ * |   |-- <container_id>
+ * |       |-- mon_data
+ * |       |-- tasks
+ * |-- <container_id>
+ *     |-- mon_data
+ *     |   |-- mon_L3_00
+ *     |   |   |-- llc_occupancy
+ *     |   |   |-- mbm_local_bytes
+ *     |   |   |-- mbm_total_bytes
+ *     |   |-- mon_L3_01
+ *     |       |-- ...
+ *     |-- mon_groups
+ *     |-- schemata
+ *     |-- tasks
+ *
+ * Every allocation group is also monitored. A monitoring group in the
+ * "mon_groups" directory of an allocation group monitors its own tasks,
+ * which share the class of service of the allocation group. A container with
+ * no schema joins the default class of service in root with its own
+ * monitoring group, and the number of classes of service does not limit the
+ * number of such containers.
+ *
+ * Shared classes of service:
+ * The number of classes of service (CLOSIDs) is small, 16 on many CPUs, and
+ * a group per container exhausts them. Containers with the same "closID"
+ * join the same group in root, which runc creates if it does not exist. The
+ * group is removed with its last container, unless it was configured before
+ * by the administrator. The first container sets the schemata of the group,
+ * the schemata of the others must match them. Each container in a shared
+ * group has its own monitoring group when Intel RDT monitoring is enabled:
+ * /sys/fs/resctrl/
+ * |-- <clos_id>
+ *     |-- mon_groups
+ *     |   |-- <container_id>
+ *     |-- schemata
+ *     |-- tasks
+ *
  * For more information about Intel RDT kernel interface:
  * https://www.kernel.org/doc/Documentation/x86/intel_rdt_ui.txt
  *
@@ -155,6 +204,10 @@ type Manager interface {
 
 	// Set Intel RDT "resource control" filesystem as configured.
 	Set(container *configs.Config) error
+
+	// Saves the schemata of the Intel RDT group, to restore it when an
+	// update fails.
+	Snapshot() (*cgroups.Snapshot, error)
 }
 
 // This implements interface Manager
@@ -180,6 +233,19 @@ var (
 	isMbaEnabled bool
 	// The flag to indicate if Intel RDT/MBA Software Controller is enabled
 	isMbaScEnabled bool
+	// The flag to indicate if Intel RDT/CMT is enabled
+	isCmtEnabled bool
+	// The flag to indicate if Intel RDT/MBM is enabled
+	isMbmEnabled bool
+)
+
+const (
+	// The directory of the monitoring groups in an allocation group
+	monGroupsDir = "mon_groups"
+	// The directory of the monitoring data of a group
+	monDataDir = "mon_data"
+	// The prefix of the monitoring data directory of a L3 cache domain
+	monL3Prefix = "mon_L3_"
 )
 
 type intelRdtData struct {
@@ -222,6 +288,28 @@ func init() {
 			isMbaEnabled = true
 		}
 	}
+
+	// 4. Check if Intel RDT monitoring sub-features are available, the
+	// kernel lists the events it can monitor in "info/L3_MON/mon_features"
+	features, err := getIntelRdtParamString(filepath.Join(intelRdtRoot, "info", "L3_MON"), "mon_features")
+	if err == nil {
+		isCmtEnabled, isMbmEnabled = parseMonFeatures(features)
+	}
+}
+
+// parseMonFeatures returns whether the CMT and MBM events are in the list of
+// monitoring features
+func parseMonFeatures(features string) (bool, bool) {
+	cmt, mbm := false, false
+	for _, feature := range strings.Fields(features) {
+		switch feature {
+		case "llc_occupancy":
+			cmt = true
+		case "mbm_total_bytes", "mbm_local_bytes":
+			mbm = true
+		}
+	}
+	return cmt, mbm
 }
 
 // Return the mount point path of Intel RDT "resource control" filesysem
@@ -510,6 +598,26 @@ func IsMbaScEnabled() bool {
 	return isMbaScEnabled
 }
 
+// Check if Intel RDT/CMT is enabled
+func IsCmtEnabled() bool {
+	return isCmtEnabled
+}
+
+// Check if Intel RDT/MBM is enabled
+func IsMbmEnabled() bool {
+	return isMbmEnabled
+}
+
+// Check if Intel RDT monitoring (CMT or MBM) is enabled
+func IsMonitoringEnabled() bool {
+	return isCmtEnabled || isMbmEnabled
+}
+
+// Check if any Intel RDT sub-feature is enabled
+func IsEnabled() bool {
+	return isCatEnabled || isMbaEnabled || IsMonitoringEnabled()
+}
+
 // Get the 'container_id' path in Intel RDT "resource control" filesystem
 func GetIntelRdtPath(id string) (string, error) {
 	rootPath, err := getIntelRdtRoot()
@@ -521,6 +629,41 @@ func GetIntelRdtPath(id string) (string, error) {
 	return path, nil
 }
 
+// groupPath returns the path of the group of a container in root. A
+// container with no schema has a monitoring group in the default allocation
+// group, and a container in a shared class of service has one in its group
+// when monitoring is enabled.
+func groupPath(root, id string, config *configs.IntelRdt) string {
+	if config == nil {
+		return filepath.Join(root, id)
+	}
+	if config.ClosID != "" {
+		group := filepath.Join(root, config.ClosID)
+		if IsMonitoringEnabled() {
+			return filepath.Join(group, monGroupsDir, id)
+		}
+		return group
+	}
+	if config.L3CacheSchema == "" && config.MemBwSchema == "" {
+		return filepath.Join(root, monGroupsDir, id)
+	}
+	return filepath.Join(root, id)
+}
+
+// isMonGroup returns whether path is a monitoring group.
+func isMonGroup(path string) bool {
+	return filepath.Base(filepath.Dir(path)) == monGroupsDir
+}
+
+// allocGroup returns the allocation group of path, which has the schemata
+// of its tasks.
+func allocGroup(path string) string {
+	if isMonGroup(path) {
+		return filepath.Dir(filepath.Dir(path))
+	}
+	return path
+}
+
 // Applies Intel RDT configuration to the process with the specified pid
 func (m *IntelRdtManager) Apply(pid int) (err error) {
 	// If intelRdt is not specified in config, we do nothing
@@ -534,8 +677,19 @@ func (m *IntelRdtManager) Apply(pid int) (err error) {
 
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	path, err := d.join(m.Id)
+	// A shared class of service with no schema must have been configured
+	// before, as nothing would set its schemata
+	rdt := m.Config.IntelRdt
+	if rdt.ClosID != "" {
+		if err := joinClos(d.root, rdt.ClosID, m.Id, jointSchemata(rdt.L3CacheSchema, rdt.MemBwSchema)); err != nil {
+			return err
+		}
+	}
+	path, err := d.join(groupPath(d.root, m.Id, rdt))
 	if err != nil {
+		if rdt.ClosID != "" {
+			leaveClos(d.root, rdt.ClosID, m.Id)
+		}
 		return err
 	}
 
@@ -547,7 +701,27 @@ func (m *IntelRdtManager) Apply(pid int) (err error) {
 func (m *IntelRdtManager) Destroy() error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	if err := os.RemoveAll(m.GetPath()); err != nil {
+	path := m.GetPath()
+	if m.Config.IntelRdt == nil || m.Config.IntelRdt.ClosID == "" {
+		if err := os.RemoveAll(path); err != nil {
+			return err
+		}
+		m.Path = ""
+		return nil
+	}
+
+	// The group of a shared class of service is only removed with its
+	// last member
+	if isMonGroup(path) {
+		if err := os.RemoveAll(path); err != nil {
+			return err
+		}
+	}
+	root, err := getIntelRdtRoot()
+	if err != nil {
+		return err
+	}
+	if err := leaveClos(root, m.Config.IntelRdt.ClosID, m.Id); err != nil {
 		return err
 	}
 	m.Path = ""
@@ -558,7 +732,9 @@ func (m *IntelRdtManager) Destroy() error {
 // restore the object later
 func (m *IntelRdtManager) GetPath() string {
 	if m.Path == "" {
-		m.Path, _ = GetIntelRdtPath(m.Id)
+		if root, err := getIntelRdtRoot(); err == nil {
+			m.Path = groupPath(root, m.Id, m.Config.IntelRdt)
+		}
 	}
 	return m.Path
 }
@@ -585,8 +761,9 @@ func (m *IntelRdtManager) GetStats() (*Stats, error) {
 	}
 	schemaRootStrings := strings.Split(tmpRootStrings, "\n")
 
-	// The L3 cache and memory bandwidth schemata in 'container_id' group
-	tmpStrings, err := getIntelRdtParamString(m.GetPath(), "schemata")
+	// The L3 cache and memory bandwidth schemata in 'container_id' group,
+	// or in the allocation group of its monitoring group
+	tmpStrings, err := getIntelRdtParamString(allocGroup(m.GetPath()), "schemata")
 	if err != nil {
 		return nil, err
 	}
@@ -638,6 +815,63 @@ func (m *IntelRdtManager) GetStats() (*Stats, error) {
 		}
 	}
 
+	if IsMonitoringEnabled() {
+		l3Monitoring, err := getL3MonitoringStats(m.GetPath())
+		if err != nil {
+			return nil, err
+		}
+		stats.L3Monitoring = l3Monitoring
+	}
+
+	return stats, nil
+}
+
+// Get the monitoring data of the group per L3 cache domain
+func getL3MonitoringStats(path string) ([]L3MonitoringStats, error) {
+	dir := filepath.Join(path, monDataDir)
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var stats []L3MonitoringStats
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.Name(), monL3Prefix) {
+			continue
+		}
+		id, err := strconv.ParseUint(strings.TrimPrefix(entry.Name(), monL3Prefix), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse the L3 cache id of %s", entry.Name())
+		}
+		s := L3MonitoringStats{Id: id}
+		domain := filepath.Join(dir, entry.Name())
+		for _, c := range []struct {
+			enabled bool
+			file    string
+			value   *uint64
+		}{
+			{IsCmtEnabled(), "llc_occupancy", &s.LLCOccupancy},
+			{IsMbmEnabled(), "mbm_total_bytes", &s.MBMTotalBytes},
+			{IsMbmEnabled(), "mbm_local_bytes", &s.MBMLocalBytes},
+		} {
+			if !c.enabled {
+				continue
+			}
+			value, err := getIntelRdtParamString(domain, c.file)
+			if err != nil {
+				if os.IsNotExist(err) {
+					continue
+				}
+				return nil, err
+			}
+			// The kernel reports "Unavailable" when the counter of the
+			// group cannot be read yet.
+			if v, err := strconv.ParseUint(value, 10, 64); err == nil {
+				*c.value = v
+			}
+		}
+		stats = append(stats, s)
+	}
 	return stats, nil
 }
 
@@ -693,33 +927,56 @@ func (m *IntelRdtManager) Set(container *configs.Config) error {
 		l3CacheSchema := container.IntelRdt.L3CacheSchema
 		memBwSchema := container.IntelRdt.MemBwSchema
 
-		// Write a single joint schema string to schemata file
-		if l3CacheSchema != "" && memBwSchema != "" {
-			if err := writeFile(path, "schemata", l3CacheSchema+"\n"+memBwSchema); err != nil {
-				return NewLastCmdError(err)
+		// The schemata of a monitoring group are the ones of the
+		// allocation group it shares with others
+		if closID := container.IntelRdt.ClosID; closID != "" {
+			path = allocGroup(path)
+			if l3CacheSchema != "" || memBwSchema != "" {
+				owner, err := isClosOwner(closID, m.Id)
+				if err != nil {
+					return err
+				}
+				if !owner {
+					return checkSchemata(path, jointSchemata(l3CacheSchema, memBwSchema))
+				}
 			}
+		} else if isMonGroup(path) && (l3CacheSchema != "" || memBwSchema != "") {
+			return fmt.Errorf("the Intel RDT schemata of a container in a shared allocation group cannot be set")
 		}
 
-		// Write only L3 cache schema string to schemata file
-		if l3CacheSchema != "" && memBwSchema == "" {
-			if err := writeFile(path, "schemata", l3CacheSchema); err != nil {
+		// Write a single joint schema string to schemata file
+		if schemata := jointSchemata(l3CacheSchema, memBwSchema); schemata != "" {
+			if err := writeFile(path, "schemata", schemata); err != nil {
 				return NewLastCmdError(err)
 			}
 		}
+	}
 
-		// Write only memory bandwidth schema string to schemata file
-		if l3CacheSchema == "" && memBwSchema != "" {
-			if err := writeFile(path, "schemata", memBwSchema); err != nil {
-				return NewLastCmdError(err)
-			}
+	return nil
+}
+
+// jointSchemata returns the content of the schemata file with the L3 cache
+// schema and the memory bandwidth schema, empty when neither is set.
+func jointSchemata(l3CacheSchema, memBwSchema string) string {
+	var lines []string
+	for _, schema := range []string{l3CacheSchema, memBwSchema} {
+		if schema != "" {
+			lines = append(lines, schema)
 		}
 	}
+	return strings.Join(lines, "\n")
+}
 
-	return nil
+// Snapshot saves the schemata of the Intel RDT group.
+func (m *IntelRdtManager) Snapshot() (*cgroups.Snapshot, error) {
+	s := &cgroups.Snapshot{}
+	if err := s.Add(allocGroup(m.GetPath()), []cgroups.SnapshotFile{{Name: "schemata"}}); err != nil {
+		return nil, err
+	}
+	return s, nil
 }
 
-func (raw *intelRdtData) join(id string) (string, error) {
-	path := filepath.Join(raw.root, id)
+func (raw *intelRdtData) join(path string) (string, error) {
 	if err := os.MkdirAll(path, 0755); err != nil {
 		return "", NewLastCmdError(err)
 	}
@@ -3,8 +3,13 @@
 package intelrdt
 
 import (
+	"os"
+	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
+
+	"github.com/opencontainers/runc/libcontainer/configs"
 )
 
 func TestIntelRdtSetL3CacheSchema(t *testing.T) {
@@ -120,3 +125,229 @@ func TestIntelRdtSetMemBwScSchema(t *testing.T) {
 		t.Fatal("Got the wrong value, set 'schemata' failed.")
 	}
 }
+
+func TestParseMonFeatures(t *testing.T) {
+	for _, tc := range []struct {
+		features string
+		cmt, mbm bool
+	}{
+		{"llc_occupancy\nmbm_total_bytes\nmbm_local_bytes\n", true, true},
+		{"llc_occupancy\n", true, false},
+		{"mbm_local_bytes\n", false, true},
+		{"", false, false},
+	} {
+		cmt, mbm := parseMonFeatures(tc.features)
+		if cmt != tc.cmt || mbm != tc.mbm {
+			t.Errorf("%q: expected CMT %v and MBM %v, got %v and %v", tc.features, tc.cmt, tc.mbm, cmt, mbm)
+		}
+	}
+}
+
+func TestIntelRdtGroupPath(t *testing.T) {
+	const root = "/sys/fs/resctrl"
+	for _, tc := range []struct {
+		config     *configs.IntelRdt
+		path       string
+		allocGroup string
+	}{
+		{nil, "/sys/fs/resctrl/ctr", "/sys/fs/resctrl/ctr"},
+		{&configs.IntelRdt{L3CacheSchema: "L3:0=f"}, "/sys/fs/resctrl/ctr", "/sys/fs/resctrl/ctr"},
+		{&configs.IntelRdt{MemBwSchema: "MB:0=70"}, "/sys/fs/resctrl/ctr", "/sys/fs/resctrl/ctr"},
+		{&configs.IntelRdt{}, "/sys/fs/resctrl/mon_groups/ctr", "/sys/fs/resctrl"},
+	} {
+		path := groupPath(root, "ctr", tc.config)
+		if path != tc.path {
+			t.Errorf("%+v: expected the path %s, got %s", tc.config, tc.path, path)
+		}
+		if group := allocGroup(path); group != tc.allocGroup {
+			t.Errorf("%s: expected the allocation group %s, got %s", path, tc.allocGroup, group)
+		}
+	}
+}
+
+func TestIntelRdtGetL3MonitoringStats(t *testing.T) {
+	helper := NewIntelRdtTestUtil(t)
+	defer helper.cleanup()
+
+	oldCmt, oldMbm := isCmtEnabled, isMbmEnabled
+	isCmtEnabled, isMbmEnabled = true, true
+	defer func() { isCmtEnabled, isMbmEnabled = oldCmt, oldMbm }()
+
+	for _, dir := range []string{"mon_L3_00", "mon_L3_01"} {
+		if err := os.MkdirAll(filepath.Join(helper.IntelRdtPath, "mon_data", dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	helper.writeFileContents(map[string]string{
+		"mon_data/mon_L3_00/llc_occupancy":   "1048576\n",
+		"mon_data/mon_L3_00/mbm_total_bytes": "4096\n",
+		"mon_data/mon_L3_00/mbm_local_bytes": "2048\n",
+		"mon_data/mon_L3_01/llc_occupancy":   "65536\n",
+		"mon_data/mon_L3_01/mbm_total_bytes": "Unavailable\n",
+	})
+
+	stats, err := getL3MonitoringStats(helper.IntelRdtPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []L3MonitoringStats{
+		{Id: 0, LLCOccupancy: 1048576, MBMTotalBytes: 4096, MBMLocalBytes: 2048},
+		{Id: 1, LLCOccupancy: 65536},
+	}
+	if !reflect.DeepEqual(stats, expected) {
+		t.Errorf("expected %+v, got %+v", expected, stats)
+	}
+}
+
+func TestIntelRdtSetSchemaInMonGroup(t *testing.T) {
+	helper := NewIntelRdtTestUtil(t)
+	defer helper.cleanup()
+
+	helper.IntelRdtData.config.IntelRdt.L3CacheSchema = "L3:0=f"
+	intelrdt := &IntelRdtManager{
+		Config: helper.IntelRdtData.config,
+		Path:   filepath.Join(helper.IntelRdtPath, "mon_groups", "ctr"),
+	}
+	if err := intelrdt.Set(helper.IntelRdtData.config); err == nil {
+		t.Fatal("expected an error when setting a schema in a monitoring group")
+	}
+}
+
+func TestIntelRdtClosGroupPath(t *testing.T) {
+	oldCmt := isCmtEnabled
+	defer func() { isCmtEnabled = oldCmt }()
+
+	config := &configs.IntelRdt{ClosID: "shared"}
+	isCmtEnabled = false
+	if path := groupPath("/sys/fs/resctrl", "ctr", config); path != "/sys/fs/resctrl/shared" {
+		t.Errorf("expected the path of the shared group, got %s", path)
+	}
+	isCmtEnabled = true
+	path := groupPath("/sys/fs/resctrl", "ctr", config)
+	if path != "/sys/fs/resctrl/shared/mon_groups/ctr" {
+		t.Errorf("expected a monitoring group in the shared group, got %s", path)
+	}
+	if group := allocGroup(path); group != "/sys/fs/resctrl/shared" {
+		t.Errorf("expected the allocation group of the shared group, got %s", group)
+	}
+}
+
+func TestIntelRdtClosMembers(t *testing.T) {
+	helper := NewIntelRdtTestUtil(t)
+	defer helper.cleanup()
+
+	oldStateDir := closStateDir
+	closStateDir = filepath.Join(helper.tempDir, "state")
+	defer func() { closStateDir = oldStateDir }()
+
+	root := helper.IntelRdtPath
+	group := filepath.Join(root, "shared")
+
+	if err := joinClos(root, "shared", "ctr1", ""); err == nil {
+		t.Fatal("expected an error when joining a missing group with no schema")
+	}
+	if err := joinClos(root, "shared", "ctr1", "L3:0=f0"); err != nil {
+		t.Fatal(err)
+	}
+	if err := joinClos(root, "shared", "ctr2", ""); err != nil {
+		t.Fatal(err)
+	}
+	if owner, err := isClosOwner("shared", "ctr1"); err != nil || owner {
+		t.Errorf("expected ctr1 not to own a group with two members, got %v, %v", owner, err)
+	}
+
+	if err := leaveClos(root, "shared", "ctr1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(group); err != nil {
+		t.Fatalf("expected the group to remain with a member: %v", err)
+	}
+	if err := leaveClos(root, "shared", "ctr2"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(group); !os.IsNotExist(err) {
+		t.Fatalf("expected the group to be removed with its last member: %v", err)
+	}
+
+	// The groups configured before are never removed
+	if err := os.Mkdir(group, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := joinClos(root, "shared", "ctr3", "L3:0=f0"); err != nil {
+		t.Fatal(err)
+	}
+	if owner, err := isClosOwner("shared", "ctr3"); err != nil || owner {
+		t.Errorf("expected ctr3 not to own a group configured before, got %v, %v", owner, err)
+	}
+	if err := leaveClos(root, "shared", "ctr3"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(group); err != nil {
+		t.Fatalf("expected the group configured before to remain: %v", err)
+	}
+}
+
+func TestIntelRdtClosJoinBeforeSet(t *testing.T) {
+	helper := NewIntelRdtTestUtil(t)
+	defer helper.cleanup()
+
+	oldStateDir := closStateDir
+	closStateDir = filepath.Join(helper.tempDir, "state")
+	defer func() { closStateDir = oldStateDir }()
+
+	// Both members join the group before the first one sets its schemata
+	root := helper.IntelRdtPath
+	config := &configs.Config{
+		IntelRdt: &configs.IntelRdt{ClosID: "shared", L3CacheSchema: "L3:0=f0;1=1f"},
+	}
+	for _, id := range []string{"ctr1", "ctr2"} {
+		if err := joinClos(root, "shared", id, jointSchemata(config.IntelRdt.L3CacheSchema, "")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, id := range []string{"ctr1", "ctr2"} {
+		m := &IntelRdtManager{Config: config, Id: id, Path: filepath.Join(root, "shared")}
+		if err := m.Set(config); err != nil {
+			t.Fatalf("%s: %v", id, err)
+		}
+	}
+
+	// A member with other schemata is refused
+	other := &configs.Config{
+		IntelRdt: &configs.IntelRdt{ClosID: "shared", L3CacheSchema: "L3:0=f;1=1f"},
+	}
+	if err := joinClos(root, "shared", "ctr3", jointSchemata(other.IntelRdt.L3CacheSchema, "")); err != nil {
+		t.Fatal(err)
+	}
+	m := &IntelRdtManager{Config: other, Id: "ctr3", Path: filepath.Join(root, "shared")}
+	if err := m.Set(other); err == nil {
+		t.Fatal("expected the schemata of the group not to match")
+	}
+}
+
+func TestIntelRdtCheckSchemata(t *testing.T) {
+	helper := NewIntelRdtTestUtil(t)
+	defer helper.cleanup()
+
+	helper.writeFileContents(map[string]string{
+		"schemata": "    L3:0=000f0;1=0001f\n    MB:0=20;1=70\n",
+	})
+	for _, tc := range []struct {
+		schemata string
+		match    bool
+	}{
+		{"L3:0=f0;1=1f", true},
+		{"MB:0=20;1=70", true},
+		{"L3:0=f0;1=1f\nMB:0=20;1=70", true},
+		{"L3:0=f;1=1f", false},
+		{"MB:0=70;1=20", false},
+		{"L3:2=f", false},
+	} {
+		err := checkSchemata(helper.IntelRdtPath, tc.schemata)
+		if tc.match && err != nil {
+			t.Errorf("%q: unexpected error: %v", tc.schemata, err)
+		} else if !tc.match && err == nil {
+			t.Errorf("%q: expected a mismatch", tc.schemata)
+		}
+	}
+}
@@ -15,6 +15,20 @@ type MemBwInfo struct {
 	NumClosids    uint64 `json:"num_closids,omitempty"`
 }
 
+// L3MonitoringStats are the monitoring data of a L3 cache domain, which is
+// a socket on most machines.
+type L3MonitoringStats struct {
+	// The id of the L3 cache domain
+	Id uint64 `json:"id"`
+
+	// The L3 cache occupancy in bytes (CMT)
+	LLCOccupancy uint64 `json:"llc_occupancy,omitempty"`
+
+	// The total and local memory bandwidth counters in bytes (MBM)
+	MBMTotalBytes uint64 `json:"mbm_total_bytes,omitempty"`
+	MBMLocalBytes uint64 `json:"mbm_local_bytes,omitempty"`
+}
+
 type Stats struct {
 	// The read-only L3 cache information
 	L3CacheInfo *L3CacheInfo `json:"l3_cache_info,omitempty"`
@@ -33,6 +47,9 @@ type Stats struct {
 
 	// The memory bandwidth schema in 'container_id' group
 	MemBwSchema string `json:"mem_bw_schema,omitempty"`
+
+	// The monitoring data of 'container_id' group per L3 cache domain
+	L3Monitoring []L3MonitoringStats `json:"l3_monitoring,omitempty"`
 }
 
 func NewStats() *Stats {
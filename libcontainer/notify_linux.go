@@ -7,7 +7,9 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"time"
 
+	"github.com/opencontainers/runc/libcontainer/cgroups"
 	"golang.org/x/sys/unix"
 )
 
@@ -67,6 +69,16 @@ func registerMemoryEvent(cgDir string, evName string, arg string) (<-chan struct
 // notifyOnOOM returns channel on which you can expect event about OOM,
 // if process died without OOM this channel will be closed.
 func notifyOnOOM(paths map[string]string) (<-chan struct{}, error) {
+	if unifiedPath(paths) != "" {
+		events, err := notifyMemoryEvents(paths)
+		if err != nil {
+			return nil, err
+		}
+		return filterMemoryEvents(events, func(e MemoryEvents) bool {
+			return e.Oom > 0 || e.OomKill > 0
+		}), nil
+	}
+
 	dir := paths[oomCgroupName]
 	if dir == "" {
 		return nil, fmt.Errorf("path %q missing", oomCgroupName)
@@ -75,16 +87,113 @@ func notifyOnOOM(paths map[string]string) (<-chan struct{}, error) {
 	return registerMemoryEvent(dir, "memory.oom_control", "")
 }
 
+// notifyMemoryPressure returns a channel signaling when the memory pressure
+// of the cgroup reaches level. On cgroup v2, LowPressure and MediumPressure
+// are both the "high" event of memory.events and cannot be told apart.
 func notifyMemoryPressure(paths map[string]string, level PressureLevel) (<-chan struct{}, error) {
+	if level > CriticalPressure {
+		return nil, fmt.Errorf("invalid pressure level %d", level)
+	}
+
+	if unifiedPath(paths) != "" {
+		// cgroup v2 has no pressure levels: the usage going over
+		// memory.high is the low and medium pressures, reaching memory.max
+		// the critical one.
+		events, err := notifyMemoryEvents(paths)
+		if err != nil {
+			return nil, err
+		}
+		return filterMemoryEvents(events, func(e MemoryEvents) bool {
+			if level == CriticalPressure {
+				return e.Max > 0
+			}
+			return e.High > 0
+		}), nil
+	}
+
 	dir := paths[oomCgroupName]
 	if dir == "" {
 		return nil, fmt.Errorf("path %q missing", oomCgroupName)
 	}
 
-	if level > CriticalPressure {
-		return nil, fmt.Errorf("invalid pressure level %d", level)
-	}
-
 	levelStr := []string{"low", "medium", "critical"}[level]
 	return registerMemoryEvent(dir, "memory.pressure_level", levelStr)
 }
+
+// PSITrigger is a pressure stall information trigger: it fires when the tasks
+// of the container are stalled on a resource for Stall within Window.
+type PSITrigger struct {
+	// Full triggers on the time all non-idle tasks are stalled at once
+	// rather than some of them.
+	Full   bool
+	Stall  time.Duration
+	Window time.Duration
+}
+
+// String returns the trigger in the format of the pressure files.
+func (t PSITrigger) String() string {
+	kind := "some"
+	if t.Full {
+		kind = "full"
+	}
+	return fmt.Sprintf("%s %d %d", kind, t.Stall/time.Microsecond, t.Window/time.Microsecond)
+}
+
+// psiPollTimeout is how often the cgroup is checked while waiting for a
+// trigger to fire.
+const psiPollTimeout = time.Second
+
+// notifyPressureStall returns a channel on which you can expect an event each
+// time the pressure stall trigger of resource fires, the channel is closed
+// once the cgroup is removed.
+func notifyPressureStall(paths map[string]string, resource string, trigger PSITrigger) (<-chan struct{}, error) {
+	// The pressure files are in the cgroup v2 cgroup, or in the cpuacct
+	// cgroup on kernels tracking the pressure of cgroup v1 hierarchies.
+	dir := unifiedPath(paths)
+	if dir == "" {
+		dir = paths["cpuacct"]
+	}
+	if dir == "" {
+		return nil, fmt.Errorf("no cgroup with pressure stall information")
+	}
+
+	path := filepath.Join(dir, cgroups.PSIFile(resource))
+	fd, err := unix.Open(path, unix.O_RDWR|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: path, Err: err}
+	}
+	// The trigger lives as long as the file is open. The kernel replaces the
+	// last byte written with a NUL, so write one.
+	if _, err := unix.Write(fd, append([]byte(trigger.String()), 0)); err != nil {
+		unix.Close(fd)
+		return nil, fmt.Errorf("failed to set pressure stall trigger %q on %s: %v", trigger, path, err)
+	}
+
+	ch := make(chan struct{})
+	go func() {
+		defer func() {
+			unix.Close(fd)
+			close(ch)
+		}()
+		for {
+			fds := []unix.PollFd{{Fd: int32(fd), Events: unix.POLLPRI}}
+			n, err := unix.Poll(fds, int(psiPollTimeout/time.Millisecond))
+			if err != nil && err != unix.EINTR {
+				return
+			}
+			if n == 0 || err == unix.EINTR {
+				if _, err := os.Lstat(path); os.IsNotExist(err) {
+					return
+				}
+				continue
+			}
+			if fds[0].Revents&unix.POLLERR != 0 {
+				return
+			}
+			if fds[0].Revents&unix.POLLPRI != 0 {
+				ch <- struct{}{}
+			}
+		}
+	}()
+	return ch, nil
+}
@@ -0,0 +1,190 @@
+// +build linux
+
+package libcontainer
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// cgroup v2 has no cgroup.event_control, the memory notifications come from
+// the counters of memory.events, watched with inotify.
+
+const memoryEventsFile = "memory.events"
+
+// MemoryEvents are counters of the memory.events file of cgroup v2.
+type MemoryEvents struct {
+	// Number of times the usage went over memory.high and was throttled.
+	High uint64
+	// Number of times the usage was about to go over memory.max.
+	Max uint64
+	// Number of times the usage reached memory.max and allocations failed.
+	Oom uint64
+	// Number of processes killed by the OOM killer.
+	OomKill uint64
+}
+
+func (e MemoryEvents) isZero() bool {
+	return e == MemoryEvents{}
+}
+
+// sub returns the increase of the counters since prev.
+func (e MemoryEvents) sub(prev MemoryEvents) MemoryEvents {
+	return MemoryEvents{
+		High:    e.High - prev.High,
+		Max:     e.Max - prev.Max,
+		Oom:     e.Oom - prev.Oom,
+		OomKill: e.OomKill - prev.OomKill,
+	}
+}
+
+// add returns the sum of the counters of e and other.
+func (e MemoryEvents) add(other MemoryEvents) MemoryEvents {
+	return MemoryEvents{
+		High:    e.High + other.High,
+		Max:     e.Max + other.Max,
+		Oom:     e.Oom + other.Oom,
+		OomKill: e.OomKill + other.OomKill,
+	}
+}
+
+// unifiedPath returns the cgroup v2 path of the paths of a cgroup manager.
+func unifiedPath(paths map[string]string) string {
+	return paths[""]
+}
+
+func readMemoryEvents(path string) (MemoryEvents, error) {
+	var events MemoryEvents
+	f, err := os.Open(path)
+	if err != nil {
+		return events, err
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		value, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return events, fmt.Errorf("invalid %s entry %q: %v", memoryEventsFile, sc.Text(), err)
+		}
+		switch fields[0] {
+		case "high":
+			events.High = value
+		case "max":
+			events.Max = value
+		case "oom":
+			events.Oom = value
+		case "oom_kill":
+			events.OomKill = value
+		}
+	}
+	return events, sc.Err()
+}
+
+// memoryEventsPollTimeout is how often the cgroup is checked while waiting
+// for memory.events to change.
+const memoryEventsPollTimeout = time.Second
+
+// registerMemoryEventsV2 returns a channel on which you can expect the
+// increase of the memory.events counters of the cgroup v2 dir each time they
+// change, the channel is closed once the cgroup is removed. Increases
+// happening while the previous one is not received are added up, so none is
+// lost. The watch never blocks on a reader that stopped receiving, it ends
+// and closes its inotify fd with the cgroup.
+func registerMemoryEventsV2(dir string) (<-chan MemoryEvents, error) {
+	path := filepath.Join(dir, memoryEventsFile)
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC)
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+	if _, err := unix.InotifyAddWatch(fd, path, unix.IN_MODIFY); err != nil {
+		unix.Close(fd)
+		return nil, &os.PathError{Op: "inotify_add_watch", Path: path, Err: err}
+	}
+	last, err := readMemoryEvents(path)
+	if err != nil {
+		unix.Close(fd)
+		return nil, err
+	}
+
+	ch := make(chan MemoryEvents, 1)
+	go func() {
+		defer func() {
+			unix.Close(fd)
+			close(ch)
+		}()
+		buf := make([]byte, 4096)
+		for {
+			fds := []unix.PollFd{{Fd: int32(fd), Events: unix.POLLIN}}
+			n, err := unix.Poll(fds, int(memoryEventsPollTimeout/time.Millisecond))
+			if err != nil && err != unix.EINTR {
+				return
+			}
+			if n > 0 {
+				if _, err := unix.Read(fd, buf); err != nil && err != unix.EINTR {
+					return
+				}
+			}
+			// The counters are read on timeouts too, the cgroup being
+			// removed is only noticed that way.
+			current, err := readMemoryEvents(path)
+			if err != nil {
+				return
+			}
+			delta := current.sub(last)
+			last = current
+			if delta.isZero() {
+				continue
+			}
+			// Merge the increase the reader has not received yet, the
+			// channel is then empty and the send does not block.
+			select {
+			case prev := <-ch:
+				delta = delta.add(prev)
+			default:
+			}
+			ch <- delta
+		}
+	}()
+	return ch, nil
+}
+
+// filterMemoryEvents returns a channel signaling the memory events for which
+// match returns true. The events not received yet are signaled once, so the
+// filter ends with events even if the reader stopped receiving.
+func filterMemoryEvents(events <-chan MemoryEvents, match func(MemoryEvents) bool) <-chan struct{} {
+	ch := make(chan struct{}, 1)
+	go func() {
+		defer close(ch)
+		for e := range events {
+			if match(e) {
+				select {
+				case ch <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+	return ch
+}
+
+// notifyMemoryEvents returns a channel on which you can expect the increase
+// of the memory.events counters of the cgroup v2 of the container.
+func notifyMemoryEvents(paths map[string]string) (<-chan MemoryEvents, error) {
+	dir := unifiedPath(paths)
+	if dir == "" {
+		return nil, fmt.Errorf("memory events require cgroup v2")
+	}
+	return registerMemoryEventsV2(dir)
+}
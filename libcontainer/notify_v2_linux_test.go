@@ -0,0 +1,125 @@
+// +build linux
+
+package libcontainer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeMemoryEvents updates the counters in place like the kernel does, the
+// file is not truncated so the counters must keep their length.
+func writeMemoryEvents(t *testing.T, dir string, data string) {
+	f, err := os.OpenFile(filepath.Join(dir, memoryEventsFile), os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.Write([]byte(data)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNotifyMemoryEvents(t *testing.T) {
+	dir, err := ioutil.TempDir("", "testmemoryevents")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeMemoryEvents(t, dir, "low 0\nhigh 3\nmax 1\noom 0\noom_kill 0\n")
+	ch, err := notifyMemoryEvents(map[string]string{"": dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeMemoryEvents(t, dir, "low 0\nhigh 5\nmax 1\noom 1\noom_kill 2\n")
+	select {
+	case e := <-ch:
+		expected := MemoryEvents{High: 2, Oom: 1, OomKill: 2}
+		if e != expected {
+			t.Fatalf("got %+v, want %+v", e, expected)
+		}
+	case <-time.After(2 * memoryEventsPollTimeout):
+		t.Fatal("no notification on channel")
+	}
+
+	// the cgroup is removed
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case _, ok := <-ch:
+		if ok {
+			t.Fatal("expected no notification to be triggered")
+		}
+	case <-time.After(2 * memoryEventsPollTimeout):
+		t.Fatal("channel not closed")
+	}
+}
+
+func TestNotifyMemoryEventsNoReader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "testmemoryevents")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeMemoryEvents(t, dir, "high 0\nmax 0\noom 0\noom_kill 0\n")
+	ch, err := notifyMemoryEvents(map[string]string{"": dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the events are not received while they happen
+	for _, data := range []string{"high 1\nmax 0\noom 0\noom_kill 0\n", "high 2\nmax 1\noom 0\noom_kill 0\n", "high 4\nmax 1\noom 1\noom_kill 0\n"} {
+		writeMemoryEvents(t, dir, data)
+		time.Sleep(memoryEventsPollTimeout + 100*time.Millisecond)
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(2 * memoryEventsPollTimeout)
+
+	// the watch ended with the cgroup, and the events are not lost
+	var total MemoryEvents
+	for e := range ch {
+		total = total.add(e)
+	}
+	if expected := (MemoryEvents{High: 4, Max: 1, Oom: 1}); total != expected {
+		t.Fatalf("got %+v, want %+v", total, expected)
+	}
+}
+
+func TestNotifyOnOOMV2(t *testing.T) {
+	dir, err := ioutil.TempDir("", "testoomv2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeMemoryEvents(t, dir, "high 0\nmax 0\noom 0\noom_kill 0\n")
+	ch, err := notifyOnOOM(map[string]string{"": dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a high event is not an oom
+	writeMemoryEvents(t, dir, "high 1\nmax 0\noom 0\noom_kill 0\n")
+	writeMemoryEvents(t, dir, "high 1\nmax 0\noom 0\noom_kill 1\n")
+	select {
+	case <-ch:
+	case <-time.After(2 * memoryEventsPollTimeout):
+		t.Fatal("no notification on channel")
+	}
+	select {
+	case _, ok := <-ch:
+		if ok {
+			t.Fatal("expected a single notification")
+		}
+	case <-time.After(memoryEventsPollTimeout / 2):
+	}
+}
@@ -75,6 +75,14 @@ type Process struct {
 	// Init specifies whether the process is the first process in the container.
 	Init bool
 
+	// SubCgroup is the path, relative to the cgroups of the container, of the
+	// cgroups to run the process in instead. They are created with the
+	// resources of SubCgroupResources if missing, recorded in the state of
+	// the container, and removed once no process uses them. The resources
+	// can not be limited on cgroup v2.
+	SubCgroup          string
+	SubCgroupResources *configs.Resources
+
 	ops processOperations
 }
 
@@ -54,6 +54,7 @@ type setnsProcess struct {
 	parentPipe      *os.File
 	childPipe       *os.File
 	cgroupPaths     map[string]string
+	subCgroup       *subCgroup
 	rootlessCgroups bool
 	intelRdtPath    string
 	config          *initConfig
@@ -90,7 +91,14 @@ func (p *setnsProcess) start() (err error) {
 	if err = p.execSetns(); err != nil {
 		return newSystemErrorWithCause(err, "executing setns process")
 	}
-	if len(p.cgroupPaths) > 0 {
+	if p.subCgroup != nil {
+		if err := p.subCgroup.create(); err != nil {
+			return newSystemErrorWithCausef(err, "creating sub-cgroup %s", p.subCgroup.name)
+		}
+		if err := cgroups.EnterPid(p.subCgroup.manager.GetPaths(), p.pid()); err != nil {
+			return newSystemErrorWithCausef(err, "adding pid %d to sub-cgroup %s", p.pid(), p.subCgroup.name)
+		}
+	} else if len(p.cgroupPaths) > 0 {
 		if err := cgroups.EnterPid(p.cgroupPaths, p.pid()); err != nil && !p.rootlessCgroups {
 			return newSystemErrorWithCausef(err, "adding pid %d to cgroups", p.pid())
 		}
@@ -190,6 +198,9 @@ func (p *setnsProcess) terminate() error {
 
 func (p *setnsProcess) wait() (*os.ProcessState, error) {
 	err := p.cmd.Wait()
+	if p.subCgroup != nil {
+		p.subCgroup.remove()
+	}
 
 	// Return actual ProcessState even on Wait error
 	return p.cmd.ProcessState, err
@@ -309,6 +309,9 @@ func mountToRootfs(m *configs.Mount, rootfs, mountLabel string, enableCgroupns b
 			}
 		}
 	case "cgroup":
+		if cgroups.IsCgroup2UnifiedMode() {
+			return mountCgroupV2(m, rootfs, mountLabel, enableCgroupns)
+		}
 		binds, err := getCgroupMounts(m)
 		if err != nil {
 			return err
@@ -401,6 +404,41 @@ func mountToRootfs(m *configs.Mount, rootfs, mountLabel string, enableCgroupns b
 	return nil
 }
 
+// mountCgroupV2 mounts the cgroup of the container in the cgroup v2 unified
+// hierarchy at the destination of m.
+func mountCgroupV2(m *configs.Mount, rootfs, mountLabel string, enableCgroupns bool) error {
+	dest, err := securejoin.SecureJoin(rootfs, m.Destination)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		return err
+	}
+	if enableCgroupns {
+		// The cgroup namespace makes the cgroup of the container the root of
+		// a new cgroup2 mount.
+		cgroupmount := &configs.Mount{
+			Source:      "cgroup2",
+			Device:      "cgroup2",
+			Destination: dest,
+			Flags:       defaultMountFlags | m.Flags&unix.MS_RDONLY,
+		}
+		return mountNewCgroup(cgroupmount)
+	}
+	cgroupPaths, err := cgroups.ParseCgroupFile("/proc/self/cgroup")
+	if err != nil {
+		return err
+	}
+	bind := &configs.Mount{
+		Device:           "bind",
+		Source:           filepath.Join(cgroups.UnifiedMountpoint, cgroupPaths[""]),
+		Destination:      m.Destination,
+		Flags:            unix.MS_BIND | unix.MS_REC | m.Flags,
+		PropagationFlags: m.PropagationFlags,
+	}
+	return mountToRootfs(bind, rootfs, mountLabel, enableCgroupns)
+}
+
 func getCgroupMounts(m *configs.Mount) ([]*configs.Mount, error) {
 	mounts, err := cgroups.GetCgroupMounts(false)
 	if err != nil {
@@ -576,6 +614,30 @@ func createDeviceNode(rootfs string, node *configs.Device, bind bool) error {
 }
 
 func mknodDevice(dest string, node *configs.Device) error {
+	fileMode, err := deviceFileMode(node)
+	if err != nil {
+		return err
+	}
+	if err := unix.Mknod(dest, fileMode, node.Mkdev()); err != nil {
+		return err
+	}
+	return unix.Chown(dest, int(node.Uid), int(node.Gid))
+}
+
+// mknodDeviceAt creates the node of the device as name in the directory
+// dirfd, without following a symlink named name.
+func mknodDeviceAt(dirfd int, name string, node *configs.Device) error {
+	fileMode, err := deviceFileMode(node)
+	if err != nil {
+		return err
+	}
+	if err := unix.Mknodat(dirfd, name, fileMode, node.Mkdev()); err != nil {
+		return err
+	}
+	return unix.Fchownat(dirfd, name, int(node.Uid), int(node.Gid), unix.AT_SYMLINK_NOFOLLOW)
+}
+
+func deviceFileMode(node *configs.Device) (uint32, error) {
 	fileMode := node.FileMode
 	switch node.Type {
 	case 'c', 'u':
@@ -585,12 +647,9 @@ func mknodDevice(dest string, node *configs.Device) error {
 	case 'p':
 		fileMode |= unix.S_IFIFO
 	default:
-		return fmt.Errorf("%c is not a valid device type for device %s", node.Type, node.Path)
-	}
-	if err := unix.Mknod(dest, uint32(fileMode), node.Mkdev()); err != nil {
-		return err
+		return 0, fmt.Errorf("%c is not a valid device type for device %s", node.Type, node.Path)
 	}
-	return unix.Chown(dest, int(node.Uid), int(node.Gid))
+	return uint32(fileMode), nil
 }
 
 func getMountInfo(mountinfo []*mount.Info, dir string) *mount.Info {
@@ -8,9 +8,13 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
 	"time"
 
+	systemdDbus "github.com/coreos/go-systemd/dbus"
+	"github.com/godbus/dbus"
 	"github.com/opencontainers/runc/libcontainer/configs"
 	"github.com/opencontainers/runc/libcontainer/seccomp"
 	libcontainerUtils "github.com/opencontainers/runc/libcontainer/utils"
@@ -31,6 +35,86 @@ var namespaceMapping = map[specs.LinuxNamespaceType]configs.NamespaceType{
 	specs.CgroupNamespace:  configs.NEWCGROUP,
 }
 
+// systemdPropertyPrefix is the prefix of the annotations setting a property
+// of the systemd unit of the container, such as
+// org.systemd.property.TimeoutStopUSec.
+const systemdPropertyPrefix = "org.systemd.property."
+
+// systemdPropertyTypes are the D-Bus types of the properties of scopes and
+// slices, the values of the annotations setting them must have these types.
+var systemdPropertyTypes = map[string]string{
+	"Description":              "s",
+	"Documentation":            "as",
+	"CollectMode":              "s",
+	"JobTimeoutUSec":           "t",
+	"JobRunningTimeoutUSec":    "t",
+	"TimeoutStopUSec":          "t",
+	"RuntimeMaxUSec":           "t",
+	"OOMPolicy":                "s",
+	"KillMode":                 "s",
+	"KillSignal":               "i",
+	"FinalKillSignal":          "i",
+	"SendSIGKILL":              "b",
+	"SendSIGHUP":               "b",
+	"CPUAccounting":            "b",
+	"CPUWeight":                "t",
+	"StartupCPUWeight":         "t",
+	"CPUShares":                "t",
+	"StartupCPUShares":         "t",
+	"CPUQuotaPerSecUSec":       "t",
+	"CPUQuotaPeriodUSec":       "t",
+	"AllowedCPUs":              "ay",
+	"AllowedMemoryNodes":       "ay",
+	"MemoryAccounting":         "b",
+	"MemoryMin":                "t",
+	"MemoryLow":                "t",
+	"MemoryHigh":               "t",
+	"MemoryMax":                "t",
+	"MemorySwapMax":            "t",
+	"MemoryLimit":              "t",
+	"IOAccounting":             "b",
+	"IOWeight":                 "t",
+	"StartupIOWeight":          "t",
+	"BlockIOAccounting":        "b",
+	"BlockIOWeight":            "t",
+	"StartupBlockIOWeight":     "t",
+	"TasksAccounting":          "b",
+	"TasksMax":                 "t",
+	"IPAccounting":             "b",
+	"DevicePolicy":             "s",
+	"ManagedOOMSwap":           "s",
+	"ManagedOOMMemoryPressure": "s",
+}
+
+// reservedSystemdProperties are the properties runc needs to manage the unit
+// of the container, they cannot be set by annotations.
+var reservedSystemdProperties = map[string]bool{
+	"PIDs":     true,
+	"Slice":    true,
+	"Wants":    true,
+	"Delegate": true,
+}
+
+// systemdPropertyNameRe matches the names of D-Bus properties.
+var systemdPropertyNameRe = regexp.MustCompile(`^[A-Z][A-Za-z0-9]*$`)
+
+// gvariantTypeKeywords are the keywords giving the type of a value in the text
+// format of GVariant, besides the "@" type annotations.
+var gvariantTypeKeywords = map[string]bool{
+	"boolean":    true,
+	"byte":       true,
+	"int16":      true,
+	"uint16":     true,
+	"int32":      true,
+	"uint32":     true,
+	"int64":      true,
+	"uint64":     true,
+	"double":     true,
+	"string":     true,
+	"objectpath": true,
+	"signature":  true,
+}
+
 var mountPropagationMapping = map[string]int{
 	"rprivate":    unix.MS_PRIVATE | unix.MS_REC,
 	"private":     unix.MS_PRIVATE,
@@ -151,6 +235,7 @@ type CreateOpts struct {
 	Spec             *specs.Spec
 	RootlessEUID     bool
 	RootlessCgroups  bool
+	SystemdUser      bool
 }
 
 // CreateLibcontainerConfig creates a new libcontainer configuration from a
@@ -243,7 +328,9 @@ func CreateLibcontainerConfig(opts *CreateOpts) (*configs.Config, error) {
 			config.Seccomp = seccomp
 		}
 		if spec.Linux.IntelRdt != nil {
-			config.IntelRdt = &configs.IntelRdt{}
+			config.IntelRdt = &configs.IntelRdt{
+				ClosID: spec.Linux.IntelRdt.ClosID,
+			}
 			if spec.Linux.IntelRdt.L3CacheSchema != "" {
 				config.IntelRdt.L3CacheSchema = spec.Linux.IntelRdt.L3CacheSchema
 			}
@@ -295,6 +382,70 @@ func createLibcontainerMount(cwd string, m specs.Mount) *configs.Mount {
 	}
 }
 
+// initSystemdProps returns the systemd unit properties set by the annotations
+// of the spec with the systemdPropertyPrefix, in the order of their names.
+func initSystemdProps(spec *specs.Spec) ([]systemdDbus.Property, error) {
+	var keys []string
+	for k := range spec.Annotations {
+		if strings.HasPrefix(k, systemdPropertyPrefix) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	var sp []systemdDbus.Property
+	for _, k := range keys {
+		prop, err := parseSystemdProperty(strings.TrimPrefix(k, systemdPropertyPrefix), spec.Annotations[k])
+		if err != nil {
+			return nil, fmt.Errorf("annotation %s: %v", k, err)
+		}
+		sp = append(sp, prop)
+	}
+	return sp, nil
+}
+
+// parseSystemdProperty parses the value of a systemd property from the text
+// format of GVariant, such as "uint64 5000000" or "['a', 'b']". The values of
+// the known properties are checked against their type, and can be unquoted
+// when they are strings. The values of the other properties must give their
+// type, such as "uint64 5000" or "@as []": the type inferred from "5000" is
+// int32, which systemd rejects for an uint64 property only once the container
+// is started.
+func parseSystemdProperty(name, value string) (systemdDbus.Property, error) {
+	if !systemdPropertyNameRe.MatchString(name) {
+		return systemdDbus.Property{}, fmt.Errorf("invalid systemd property name %q", name)
+	}
+	if reservedSystemdProperties[name] {
+		return systemdDbus.Property{}, fmt.Errorf("systemd property %s is managed by runc", name)
+	}
+
+	var sig dbus.Signature
+	if t, ok := systemdPropertyTypes[name]; ok {
+		if t == "s" && !strings.HasPrefix(value, "'") && !strings.HasPrefix(value, `"`) {
+			return systemdDbus.Property{Name: name, Value: dbus.MakeVariant(value)}, nil
+		}
+		sig = dbus.ParseSignatureMust(t)
+	} else if !hasGVariantType(value) {
+		return systemdDbus.Property{}, fmt.Errorf("the value %q of systemd property %s must give its type, such as \"uint64 5000\", runc does not know the type of the property", value, name)
+	}
+	v, err := dbus.ParseVariant(value, sig)
+	if err != nil {
+		return systemdDbus.Property{}, fmt.Errorf("invalid value %q of systemd property %s: %v", value, name, err)
+	}
+	return systemdDbus.Property{Name: name, Value: v}, nil
+}
+
+// hasGVariantType returns whether a value in the text format of GVariant
+// starts with its type.
+func hasGVariantType(value string) bool {
+	value = strings.TrimSpace(value)
+	if strings.HasPrefix(value, "@") {
+		return true
+	}
+	fields := strings.Fields(value)
+	return len(fields) > 1 && gvariantTypeKeywords[fields[0]]
+}
+
 func createCgroupConfig(opts *CreateOpts) (*configs.Cgroup, error) {
 	var (
 		myCgroupPath string
@@ -318,6 +469,9 @@ func createCgroupConfig(opts *CreateOpts) (*configs.Cgroup, error) {
 	if useSystemdCgroup {
 		if myCgroupPath == "" {
 			c.Parent = "system.slice"
+			if opts.SystemdUser {
+				c.Parent = "user.slice"
+			}
 			c.ScopePrefix = "runc"
 			c.Name = name
 		} else {
@@ -331,6 +485,11 @@ func createCgroupConfig(opts *CreateOpts) (*configs.Cgroup, error) {
 			c.ScopePrefix = parts[1]
 			c.Name = parts[2]
 		}
+		sp, err := initSystemdProps(spec)
+		if err != nil {
+			return nil, err
+		}
+		c.SystemdProps = sp
 	} else {
 		if myCgroupPath == "" {
 			c.Name = name
@@ -4,6 +4,7 @@ package specconv
 
 import (
 	"os"
+	"reflect"
 	"strings"
 	"testing"
 
@@ -312,6 +313,25 @@ func TestLinuxCgroupSystemdWithEmptyPath(t *testing.T) {
 	}
 }
 
+func TestLinuxCgroupSystemdUserWithEmptyPath(t *testing.T) {
+	opts := &CreateOpts{
+		CgroupName:       "ContainerID",
+		UseSystemdCgroup: true,
+		SystemdUser:      true,
+		Spec:             &specs.Spec{Linux: &specs.Linux{}},
+	}
+
+	cgroup, err := createCgroupConfig(opts)
+	if err != nil {
+		t.Fatalf("Couldn't create Cgroup config: %v", err)
+	}
+
+	expectedParent := "user.slice"
+	if cgroup.Parent != expectedParent {
+		t.Errorf("Expected to have %s as Parent instead of %s", expectedParent, cgroup.Parent)
+	}
+}
+
 func TestLinuxCgroupSystemdWithInvalidPath(t *testing.T) {
 	cgroupsPath := "/user/cgroups/path/id"
 
@@ -331,6 +351,85 @@ func TestLinuxCgroupSystemdWithInvalidPath(t *testing.T) {
 		t.Error("Expected to produce an error if not using the correct format for cgroup paths belonging to systemd")
 	}
 }
+func TestLinuxCgroupSystemdProps(t *testing.T) {
+	spec := &specs.Spec{
+		Annotations: map[string]string{
+			"org.systemd.property.TimeoutStopUSec": "uint64 123456789",
+			"org.systemd.property.CollectMode":     "inactive-or-failed",
+			"org.systemd.property.Description":     "'quoted description'",
+			"org.systemd.property.SendSIGHUP":      "true",
+			"org.systemd.property.Documentation":   "['man:runc(8)']",
+			"org.systemd.property.CustomProp":      "int64 -1",
+			"org.example.unrelated":                "value",
+		},
+	}
+	opts := &CreateOpts{
+		CgroupName:       "ContainerID",
+		UseSystemdCgroup: true,
+		Spec:             spec,
+	}
+
+	cgroup, err := createCgroupConfig(opts)
+	if err != nil {
+		t.Fatalf("Couldn't create Cgroup config: %v", err)
+	}
+
+	expected := []struct {
+		name  string
+		value interface{}
+	}{
+		{"CollectMode", "inactive-or-failed"},
+		{"CustomProp", int64(-1)},
+		{"Description", "quoted description"},
+		{"Documentation", []string{"man:runc(8)"}},
+		{"SendSIGHUP", true},
+		{"TimeoutStopUSec", uint64(123456789)},
+	}
+	if len(cgroup.SystemdProps) != len(expected) {
+		t.Fatalf("Expected %d systemd properties, got %v", len(expected), cgroup.SystemdProps)
+	}
+	for i, e := range expected {
+		prop := cgroup.SystemdProps[i]
+		if prop.Name != e.name || !reflect.DeepEqual(prop.Value.Value(), e.value) {
+			t.Errorf("Expected property %s=%#v, got %s=%#v", e.name, e.value, prop.Name, prop.Value.Value())
+		}
+	}
+
+	opts.UseSystemdCgroup = false
+	cgroup, err = createCgroupConfig(opts)
+	if err != nil {
+		t.Fatalf("Couldn't create Cgroup config: %v", err)
+	}
+	if len(cgroup.SystemdProps) != 0 {
+		t.Errorf("Expected no systemd properties without systemd cgroups, got %v", cgroup.SystemdProps)
+	}
+}
+
+func TestLinuxCgroupSystemdInvalidProps(t *testing.T) {
+	for _, annotations := range []map[string]string{
+		{"org.systemd.property.TimeoutStopUSec": "'five seconds'"},
+		{"org.systemd.property.TimeoutStopUSec": "-5"},
+		{"org.systemd.property.SendSIGHUP": "1"},
+		{"org.systemd.property.PIDs": "[uint32 1]"},
+		{"org.systemd.property.Slice": "other.slice"},
+		{"org.systemd.property.lowercase": "'value'"},
+		{"org.systemd.property.": "'value'"},
+		{"org.systemd.property.Custom": "[unterminated"},
+		{"org.systemd.property.RuntimeRandomizedExtraUSec": "5000"},
+		{"org.systemd.property.Custom": "'untyped'"},
+		{"org.systemd.property.Custom": "uint64"},
+	} {
+		opts := &CreateOpts{
+			CgroupName:       "ContainerID",
+			UseSystemdCgroup: true,
+			Spec:             &specs.Spec{Annotations: annotations},
+		}
+		if _, err := createCgroupConfig(opts); err == nil {
+			t.Errorf("Expected an error for the annotations %v", annotations)
+		}
+	}
+}
+
 func TestLinuxCgroupsPathSpecified(t *testing.T) {
 	cgroupsPath := "/user/cgroups/path/id"
 
@@ -43,7 +43,15 @@ func destroy(c *linuxContainer) error {
 			logrus.Warn(err)
 		}
 	}
-	err := c.cgroupManager.Destroy()
+	// the sub-cgroups are removed first, the cgroup managers only remove
+	// the cgroups they created
+	subCgroups, err := c.loadSubCgroups()
+	if err != nil {
+		subCgroups = c.subCgroups
+	}
+	pruneSubCgroups(c.cgroupManager.GetPaths(), subCgroups)
+	c.subCgroups = nil
+	err = c.cgroupManager.Destroy()
 	if c.intelRdtManager != nil {
 		if ierr := c.intelRdtManager.Destroy(); err == nil {
 			err = ierr
@@ -7,4 +7,7 @@ type Stats struct {
 	Interfaces    []*NetworkInterface
 	CgroupStats   *cgroups.Stats
 	IntelRdtStats *intelrdt.Stats
+	// Stats of the sub-cgroups of the processes started in their own
+	// cgroups, by the name of the sub-cgroup.
+	SubCgroupStats map[string]*cgroups.Stats
 }
@@ -0,0 +1,138 @@
+// +build linux
+
+package libcontainer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/opencontainers/runc/libcontainer/cgroups"
+	"github.com/opencontainers/runc/libcontainer/cgroups/fs"
+	"github.com/opencontainers/runc/libcontainer/cgroups/fs2"
+	"github.com/opencontainers/runc/libcontainer/configs"
+	"github.com/sirupsen/logrus"
+)
+
+// A sub-cgroup is a child cgroup of the cgroups of the container, a process
+// started in the container runs in to have its usage limited and accounted
+// apart from the one of the other processes.
+
+type subCgroup struct {
+	name    string
+	config  *configs.Cgroup
+	manager cgroups.Manager
+}
+
+// newSubCgroup returns the sub-cgroup name of the container cgroups at paths,
+// limited to the resources r.
+func newSubCgroup(paths map[string]string, name string, r *configs.Resources) (*subCgroup, error) {
+	clean := filepath.Clean(name)
+	if filepath.IsAbs(clean) || clean == "." || clean == ".." || strings.HasPrefix(clean, "../") {
+		return nil, fmt.Errorf("invalid sub-cgroup %q: it must be a path relative to the cgroup of the container", name)
+	}
+	if r == nil {
+		r = &configs.Resources{}
+	}
+	subPaths := make(map[string]string, len(paths))
+	for subsystem, path := range paths {
+		subPaths[subsystem] = filepath.Join(path, clean)
+	}
+	config := &configs.Cgroup{Resources: r}
+	s := &subCgroup{name: clean, config: config}
+	if unifiedPath(paths) != "" {
+		// cgroup v2 only has the controllers enabled in the subtree_control
+		// of the parent, and they can not be enabled in the cgroup of the
+		// container as long as the init process runs in it.
+		if !reflect.DeepEqual(*r, configs.Resources{}) {
+			return nil, fmt.Errorf("cannot limit the resources of sub-cgroup %s: not supported on cgroup v2, where the processes of the container run in its cgroup", clean)
+		}
+		s.manager = &fs2.Manager{Cgroups: config, Paths: subPaths}
+	} else {
+		s.manager = &fs.Manager{Cgroups: config, Paths: subPaths}
+	}
+	return s, nil
+}
+
+// create creates the sub-cgroup and sets its resources.
+func (s *subCgroup) create() error {
+	for subsystem, path := range s.manager.GetPaths() {
+		if subsystem == "cpuset" {
+			// the cpus and mems of the parent are copied to the new cpuset,
+			// it can not have processes until they are set.
+			if err := (&fs.CpusetGroup{}).ApplyDir(path, s.config, -1); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := os.MkdirAll(path, 0755); err != nil {
+			return err
+		}
+	}
+	return s.manager.Set(&configs.Config{Cgroups: s.config})
+}
+
+// remove removes the sub-cgroup once it has no processes left, the ones
+// shared with other processes are kept.
+func (s *subCgroup) remove() {
+	for _, path := range s.manager.GetPaths() {
+		// the parents created for a nested sub-cgroup are removed along.
+		for dir, name := path, s.name; name != "."; dir, name = filepath.Dir(dir), filepath.Dir(name) {
+			if os.Remove(dir) != nil {
+				break
+			}
+		}
+	}
+}
+
+// exists returns whether the sub-cgroup is left in any hierarchy.
+func (s *subCgroup) exists() bool {
+	for _, path := range s.manager.GetPaths() {
+		if _, err := os.Stat(path); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// pruneSubCgroups removes the sub-cgroups names of the container cgroups at
+// paths that have no processes left, and returns the ones left.
+func pruneSubCgroups(paths map[string]string, names []string) []string {
+	var left []string
+	for _, name := range names {
+		s, err := newSubCgroup(paths, name, nil)
+		if err != nil {
+			continue
+		}
+		s.remove()
+		if s.exists() {
+			left = append(left, name)
+		}
+	}
+	return left
+}
+
+// getSubCgroupStats returns the stats of the sub-cgroups names of the
+// container cgroups at paths by their name. The sub-cgroups that are gone or
+// fail are left out, they do not prevent the stats of the container.
+func getSubCgroupStats(paths map[string]string, names []string) map[string]*cgroups.Stats {
+	var stats map[string]*cgroups.Stats
+	for _, name := range names {
+		s, err := newSubCgroup(paths, name, nil)
+		if err != nil || !s.exists() {
+			continue
+		}
+		sub, err := s.manager.GetStats()
+		if err != nil {
+			logrus.Warnf("getting stats of sub-cgroup %s: %v", name, err)
+			continue
+		}
+		if stats == nil {
+			stats = make(map[string]*cgroups.Stats, len(names))
+		}
+		stats[name] = sub
+	}
+	return stats
+}
@@ -0,0 +1,154 @@
+// +build linux
+
+package libcontainer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/opencontainers/runc/libcontainer/configs"
+)
+
+func TestNewSubCgroupInvalid(t *testing.T) {
+	paths := map[string]string{"pids": "/sys/fs/cgroup/pids/ct"}
+	for _, name := range []string{"", ".", "..", "../other", "a/../../other", "/abs"} {
+		if _, err := newSubCgroup(paths, name, nil); err == nil {
+			t.Errorf("expected sub-cgroup %q to be invalid", name)
+		}
+	}
+}
+
+func TestNewSubCgroupV2Resources(t *testing.T) {
+	paths := map[string]string{"": "/sys/fs/cgroup/ct"}
+	if _, err := newSubCgroup(paths, "debug", &configs.Resources{PidsLimit: 10}); err == nil {
+		t.Fatal("expected the resources of a cgroup v2 sub-cgroup to be rejected")
+	}
+	if _, err := newSubCgroup(paths, "debug", nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSubCgroup(t *testing.T) {
+	root, err := ioutil.TempDir("", "testsubcgroup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	paths := map[string]string{
+		"pids": filepath.Join(root, "pids", "ct"),
+		"cpu":  filepath.Join(root, "cpu", "ct"),
+	}
+	for _, path := range paths {
+		if err := os.MkdirAll(path, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s, err := newSubCgroup(paths, "debug/shell", &configs.Resources{PidsLimit: 10, CpuShares: 512})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.create(); err != nil {
+		t.Fatal(err)
+	}
+	for file, expected := range map[string]string{
+		"pids/ct/debug/shell/pids.max":  "10",
+		"cpu/ct/debug/shell/cpu.shares": "512",
+	} {
+		data, err := ioutil.ReadFile(filepath.Join(root, file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != expected {
+			t.Errorf("expected %s to be %q, got %q", file, expected, data)
+		}
+	}
+
+	// unlike the ones of a cgroup, the files of a regular directory prevent
+	// its removal, as the processes of a sub-cgroup do.
+	names := []string{"debug/shell", "gone"}
+	if left := pruneSubCgroups(paths, names); !reflect.DeepEqual(left, []string{"debug/shell"}) {
+		t.Fatalf("expected the busy sub-cgroup to be left, got %v", left)
+	}
+	// the sub-cgroups failing or gone are left out of the stats
+	if stats := getSubCgroupStats(paths, names); len(stats) != 0 {
+		t.Fatalf("expected no stats, got %v", stats)
+	}
+
+	for _, path := range s.manager.GetPaths() {
+		files, _ := ioutil.ReadDir(path)
+		for _, f := range files {
+			os.Remove(filepath.Join(path, f.Name()))
+		}
+	}
+	if left := pruneSubCgroups(paths, names); len(left) != 0 {
+		t.Fatalf("expected the sub-cgroups to be pruned, got %v", left)
+	}
+	for _, path := range paths {
+		if _, err := os.Stat(filepath.Join(path, "debug")); !os.IsNotExist(err) {
+			t.Errorf("expected sub-cgroup to be removed from %s: %v", path, err)
+		}
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("expected cgroup of the container to be kept: %v", err)
+		}
+	}
+}
+
+func TestRecordSubCgroupReloadsState(t *testing.T) {
+	root, err := ioutil.TempDir("", "testsubcgroup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	paths := map[string]string{"pids": filepath.Join(root, "pids", "ct")}
+	// "busy" still has a process, "gone" was removed
+	if err := os.MkdirAll(filepath.Join(paths["pids"], "busy"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(paths["pids"], "busy", "cgroup.procs"), []byte("1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	stateDir := filepath.Join(root, "state")
+	if err := os.Mkdir(stateDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	// another runc exec recorded sub-cgroups since the container was loaded
+	state := []byte(`{"sub_cgroups":["busy","gone"]}`)
+	if err := ioutil.WriteFile(filepath.Join(stateDir, stateFilename), state, 0600); err != nil {
+		t.Fatal(err)
+	}
+	c := &linuxContainer{
+		id:            "myid",
+		root:          stateDir,
+		config:        &configs.Config{},
+		cgroupManager: &mockCgroupManager{paths: paths},
+	}
+
+	// the stats do not change the state
+	if _, err := c.Stats(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(stateDir, stateFilename))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != string(state) {
+		t.Fatalf("expected the state to be kept by the stats, got %s", data)
+	}
+
+	if err := c.recordSubCgroup("new"); err != nil {
+		t.Fatal(err)
+	}
+	recorded, err := c.loadSubCgroups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"busy", "new"}; !reflect.DeepEqual(recorded, expected) {
+		t.Fatalf("expected sub-cgroups %v, got %v", expected, recorded)
+	}
+}
@@ -0,0 +1,47 @@
+// +build linux
+
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// OpenDirNoFollow opens the directory path below root with O_PATH, and
+// follows no symlink in the components of path. The missing directories are
+// created with mode when create is set.
+//
+// It guards the changes made from the host to a root that another user
+// controls, such as the root of a running container, where a component of a
+// path checked beforehand can be swapped for a symlink to a host path. The
+// returned directory is meant for the *at syscalls.
+func OpenDirNoFollow(root, path string, create bool, mode os.FileMode) (*os.File, error) {
+	fd, err := unix.Open(root, unix.O_PATH|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: root, Err: err}
+	}
+	current := root
+	for _, name := range strings.Split(CleanPath("/"+path), "/") {
+		if name == "" {
+			continue
+		}
+		current = filepath.Join(current, name)
+		next, err := unix.Openat(fd, name, unix.O_PATH|unix.O_DIRECTORY|unix.O_NOFOLLOW|unix.O_CLOEXEC, 0)
+		if err == unix.ENOENT && create {
+			if err := unix.Mkdirat(fd, name, uint32(mode)); err != nil && err != unix.EEXIST {
+				unix.Close(fd)
+				return nil, &os.PathError{Op: "mkdirat", Path: current, Err: err}
+			}
+			next, err = unix.Openat(fd, name, unix.O_PATH|unix.O_DIRECTORY|unix.O_NOFOLLOW|unix.O_CLOEXEC, 0)
+		}
+		unix.Close(fd)
+		if err != nil {
+			return nil, &os.PathError{Op: "openat", Path: current, Err: err}
+		}
+		fd = next
+	}
+	return os.NewFile(uintptr(fd), current), nil
+}
@@ -0,0 +1,274 @@
+// +build linux
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/opencontainers/runc/libcontainer"
+
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+	"golang.org/x/sys/unix"
+)
+
+// The runc commands changing the state of a container append lifecycle events
+// to a log in the state directory of the container, runc events streams them.
+
+const lifecycleLogFile = "events.json"
+
+// lifecycle event types.
+const (
+	lifecycleCreated      = "created"
+	lifecycleStarted      = "started"
+	lifecyclePaused       = "paused"
+	lifecycleResumed      = "resumed"
+	lifecycleExecStarted  = "exec_started"
+	lifecycleExecExited   = "exec_exited"
+	lifecycleExited       = "exited"
+	lifecycleCheckpointed = "checkpointed"
+	lifecycleDeleted      = "deleted"
+)
+
+// lifecycle is the data of the lifecycle events.
+type lifecycle struct {
+	Time time.Time `json:"time"`
+	// Host pid of the init or exec process.
+	Pid int `json:"pid,omitempty"`
+	// Exit code of the process, only known when runc waited for it.
+	ExitCode *int `json:"exitCode,omitempty"`
+}
+
+// lifecycleLogPath returns the path of the lifecycle event log of container id.
+func lifecycleLogPath(context *cli.Context, id string) string {
+	root, err := filepath.Abs(context.GlobalString("root"))
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(root, id, lifecycleLogFile)
+}
+
+// recordLifecycleEvent appends a lifecycle event to the log at path. Failing
+// to record it does not fail the command.
+func recordLifecycleEvent(path, id, typ string, data *lifecycle) {
+	if path == "" {
+		return
+	}
+	data.Time = time.Now()
+	b, err := json.Marshal(&event{Type: typ, ID: id, Data: data})
+	if err != nil {
+		logrus.Warnf("unable to record %s event: %v", typ, err)
+		return
+	}
+	// a single write to a file opened in append mode is not interleaved
+	// with the ones of other runc commands.
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		logrus.Warnf("unable to record %s event: %v", typ, err)
+		return
+	}
+	defer f.Close()
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		logrus.Warnf("unable to record %s event: %v", typ, err)
+	}
+}
+
+// recordContainerEvent appends a lifecycle event of container to its log.
+func recordContainerEvent(context *cli.Context, container libcontainer.Container, typ string, data *lifecycle) {
+	recordLifecycleEvent(lifecycleLogPath(context, container.ID()), container.ID(), typ, data)
+}
+
+// lifecyclePollTimeout is how often the state of the container is checked
+// while waiting for lifecycle events.
+const lifecyclePollTimeout = time.Second
+
+// lifecycleContainer is the part of a container watched for lifecycle events.
+type lifecycleContainer interface {
+	ID() string
+	Status() (libcontainer.Status, error)
+	Processes() ([]int, error)
+}
+
+// watchLifecycle returns a channel streaming the lifecycle events recorded
+// from now on in the log at path for container. The exits of the init and
+// exec processes are reported even when no runc command waited for them, with
+// no exit code then, and the removal of the state directory is reported as
+// the deleted event. The channel is closed after it.
+func watchLifecycle(path string, container lifecycleContainer) (<-chan *event, error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC)
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+	dir := filepath.Dir(path)
+	if _, err := unix.InotifyAddWatch(fd, dir, unix.IN_CREATE|unix.IN_MODIFY|unix.IN_DELETE_SELF); err != nil {
+		unix.Close(fd)
+		return nil, &os.PathError{Op: "inotify_add_watch", Path: dir, Err: err}
+	}
+	// The log is kept open to read the last events after runc delete
+	// removed it. Only the events recorded from now on are streamed.
+	var offset int64
+	execs := make(map[int]bool)
+	log, err := os.Open(path)
+	if err == nil {
+		// the exec processes started before are watched too
+		var events []*event
+		events, offset = readLifecycleLog(log, 0)
+		for _, e := range events {
+			trackExec(execs, e)
+		}
+	}
+
+	ch := make(chan *event, 16)
+	go func() {
+		defer func() {
+			if log != nil {
+				log.Close()
+			}
+			unix.Close(fd)
+			close(ch)
+		}()
+		exited, stopped := false, false
+		buf := make([]byte, 4096)
+		for {
+			fds := []unix.PollFd{{Fd: int32(fd), Events: unix.POLLIN}}
+			n, err := unix.Poll(fds, int(lifecyclePollTimeout/time.Millisecond))
+			if err != nil && err != unix.EINTR {
+				logrus.Error(err)
+				return
+			}
+			if n > 0 {
+				if _, err := unix.Read(fd, buf); err != nil && err != unix.EINTR {
+					logrus.Error(err)
+					return
+				}
+			}
+
+			if log == nil {
+				// the container was created without a log
+				if log, err = os.Open(path); err != nil {
+					log = nil
+				}
+			}
+			var events []*event
+			events, offset = readLifecycleLog(log, offset)
+			for _, e := range events {
+				if e.Type == lifecycleExited {
+					exited = true
+				}
+				trackExec(execs, e)
+				ch <- e
+			}
+
+			if _, err := os.Stat(dir); os.IsNotExist(err) {
+				for pid := range execs {
+					ch <- &event{Type: lifecycleExecExited, ID: container.ID(), Data: &lifecycle{Time: time.Now(), Pid: pid}}
+				}
+				if !exited {
+					ch <- &event{Type: lifecycleExited, ID: container.ID(), Data: &lifecycle{Time: time.Now()}}
+				}
+				ch <- &event{Type: lifecycleDeleted, ID: container.ID(), Data: &lifecycle{Time: time.Now()}}
+				return
+			}
+			if !exited {
+				// The exit is reported a poll later, the runc command
+				// waiting for the init process may record it with its exit
+				// code in the meantime.
+				if status, err := container.Status(); err == nil && status == libcontainer.Stopped {
+					if stopped {
+						exited = true
+						ch <- &event{Type: lifecycleExited, ID: container.ID(), Data: &lifecycle{Time: time.Now()}}
+					}
+					stopped = true
+				}
+			}
+			if len(execs) > 0 {
+				for _, e := range reapExecs(container, execs) {
+					ch <- e
+				}
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// trackExec adds the exec processes started by e to execs, and removes the
+// ones whose exit e records.
+func trackExec(execs map[int]bool, e *event) {
+	var pid int
+	switch data := e.Data.(type) {
+	case *lifecycle:
+		pid = data.Pid
+	case map[string]interface{}:
+		if p, ok := data["pid"].(float64); ok {
+			pid = int(p)
+		}
+	}
+	if pid == 0 {
+		return
+	}
+	switch e.Type {
+	case lifecycleExecStarted:
+		execs[pid] = false
+	case lifecycleExecExited:
+		delete(execs, pid)
+	}
+}
+
+// reapExecs returns the exec_exited events of the exec processes of execs
+// that are no longer in the container, which were started detached. As for
+// the init process, an exit is reported a poll later, the runc exec waiting
+// for the process may record it with its exit code in the meantime.
+func reapExecs(container lifecycleContainer, execs map[int]bool) []*event {
+	pids, err := container.Processes()
+	if err != nil {
+		return nil
+	}
+	running := make(map[int]bool, len(pids))
+	for _, pid := range pids {
+		running[pid] = true
+	}
+	var events []*event
+	for pid, gone := range execs {
+		switch {
+		case running[pid]:
+			execs[pid] = false
+		case gone:
+			delete(execs, pid)
+			events = append(events, &event{Type: lifecycleExecExited, ID: container.ID(), Data: &lifecycle{Time: time.Now(), Pid: pid}})
+		default:
+			execs[pid] = true
+		}
+	}
+	return events
+}
+
+// readLifecycleLog returns the events recorded in log after offset, and the
+// offset following the last complete one.
+func readLifecycleLog(log *os.File, offset int64) ([]*event, int64) {
+	if log == nil {
+		return nil, offset
+	}
+
+	var events []*event
+	r := bufio.NewReader(io.NewSectionReader(log, offset, math.MaxInt64-offset))
+	for {
+		line, err := r.ReadBytes('\n')
+		if err != nil {
+			// an incomplete line is read again once it is complete
+			return events, offset
+		}
+		offset += int64(len(line))
+		e := &event{}
+		if err := json.Unmarshal(line, e); err != nil {
+			logrus.Warnf("invalid lifecycle event %q: %v", line, err)
+			continue
+		}
+		events = append(events, e)
+	}
+}
@@ -0,0 +1,128 @@
+// +build linux
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/opencontainers/runc/libcontainer"
+)
+
+type fakeLifecycleContainer struct {
+	id string
+}
+
+func (c *fakeLifecycleContainer) ID() string {
+	return c.id
+}
+
+func (c *fakeLifecycleContainer) Status() (libcontainer.Status, error) {
+	return libcontainer.Running, nil
+}
+
+func (c *fakeLifecycleContainer) Processes() ([]int, error) {
+	return []int{1}, nil
+}
+
+func TestReadLifecycleLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lifecycle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, lifecycleLogFile)
+	data := `{"type":"created","id":"ctr","data":{"pid":1}}` + "\n" +
+		"not json\n" +
+		`{"type":"started","id":"ctr","data":{"pid":1}}` + "\n" +
+		`{"type":"paused",`
+	if err := ioutil.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	log, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+
+	// the invalid line is skipped, the partial one is left for later
+	events, offset := readLifecycleLog(log, 0)
+	if len(events) != 2 || events[0].Type != lifecycleCreated || events[1].Type != lifecycleStarted {
+		t.Fatalf("unexpected events %+v", events)
+	}
+	if expected := int64(len(data) - len(`{"type":"paused",`)); offset != expected {
+		t.Fatalf("expected offset %d, got %d", expected, offset)
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteString(`"id":"ctr"}` + "\n"); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	events, _ = readLifecycleLog(log, offset)
+	if len(events) != 1 || events[0].Type != lifecyclePaused {
+		t.Fatalf("expected the completed line, got %+v", events)
+	}
+}
+
+func TestWatchLifecycle(t *testing.T) {
+	root, err := ioutil.TempDir("", "lifecycle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	dir := filepath.Join(root, "ctr")
+	if err := os.Mkdir(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	// an exec process started detached before the watch, it is no longer
+	// in the container
+	path := filepath.Join(dir, lifecycleLogFile)
+	recordLifecycleEvent(path, "ctr", lifecycleExecStarted, &lifecycle{Pid: 12345})
+	ch, err := watchLifecycle(path, &fakeLifecycleContainer{id: "ctr"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recordLifecycleEvent(path, "ctr", lifecyclePaused, &lifecycle{})
+	var types []string
+	timeout := time.After(10 * lifecyclePollTimeout)
+	for len(types) < 2 {
+		select {
+		case e := <-ch:
+			types = append(types, e.Type)
+		case <-timeout:
+			t.Fatalf("missing events, got %v", types)
+		}
+	}
+	if types[0] != lifecyclePaused || types[1] != lifecycleExecExited {
+		t.Fatalf("expected paused and exec_exited events, got %v", types)
+	}
+
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	types = nil
+	for {
+		select {
+		case e, ok := <-ch:
+			if !ok {
+				if len(types) != 2 || types[0] != lifecycleExited || types[1] != lifecycleDeleted {
+					t.Fatalf("expected exited and deleted events, got %v", types)
+				}
+				return
+			}
+			types = append(types, e.Type)
+		case <-timeout:
+			t.Fatalf("channel not closed, got %v", types)
+		}
+	}
+}
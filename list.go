@@ -16,6 +16,7 @@ import (
 	"github.com/opencontainers/runc/libcontainer"
 	"github.com/opencontainers/runc/libcontainer/user"
 	"github.com/opencontainers/runc/libcontainer/utils"
+	"github.com/opencontainers/runc/prehook/richcontainer"
 	"github.com/urfave/cli"
 )
 
@@ -42,6 +43,8 @@ type containerState struct {
 	Annotations map[string]string `json:"annotations,omitempty"`
 	// The owner of the state directory (the owner of the container).
 	Owner string `json:"owner"`
+	// RichContainer is the state of the main service of a rich container.
+	RichContainer *richcontainer.Health `json:"richContainer,omitempty"`
 }
 
 var listCommand = cli.Command{
@@ -168,6 +171,7 @@ func getContainers(context *cli.Context) ([]containerState, error) {
 				Created:        state.BaseState.Created,
 				Annotations:    annotations,
 				Owner:          owner.Name,
+				RichContainer:  richContainerHealth(container, containerStatus, pid, annotations),
 			})
 		}
 	}
@@ -6,6 +6,7 @@ import (
 	"os"
 	"strings"
 
+	"github.com/opencontainers/runc/prehook/external"
 	"github.com/opencontainers/runtime-spec/specs-go"
 
 	"github.com/sirupsen/logrus"
@@ -112,6 +113,11 @@ func main() {
 			Value: "auto",
 			Usage: "ignore cgroup permission errors ('true', 'false', or 'auto')",
 		},
+		cli.StringFlag{
+			Name:  "prehook-dir",
+			Value: external.DefaultDir,
+			Usage: "directory of the external prehook definitions run before creating a container",
+		},
 	}
 	app.Commands = []cli.Command{
 		checkpointCommand,
@@ -122,7 +128,9 @@ func main() {
 		initCommand,
 		killCommand,
 		listCommand,
+		metricsCommand,
 		pauseCommand,
+		prehookCommand,
 		psCommand,
 		restoreCommand,
 		resumeCommand,
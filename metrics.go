@@ -0,0 +1,384 @@
+// +build linux
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/opencontainers/runc/libcontainer"
+	"github.com/opencontainers/runc/libcontainer/utils"
+
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+const openMetricsContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+
+var metricsCommand = cli.Command{
+	Name:  "metrics",
+	Usage: "display the stats of containers in the OpenMetrics text format",
+	ArgsUsage: `[container-id]
+
+Where "[container-id]" is the name for the instance of the container, the stats
+of all the running containers under the given root are displayed without it.`,
+	Description: `The metrics command displays the cpu, memory, pids, blkio, hugetlb, intel_rdt
+and network interface stats of "runc events --stats" in the OpenMetrics text
+format. The container ID and annotations are the labels of the metrics. With
+--listen, runc serves the metrics over HTTP at /metrics instead, collecting them
+on each scrape. The metrics are served without authentication, an address
+without host only listens on localhost.`,
+	Flags: []cli.Flag{
+		cli.StringFlag{Name: "listen", Usage: "serve the metrics over HTTP at the given address, e.g. :9100 for localhost:9100"},
+	},
+	Action: func(context *cli.Context) error {
+		if err := checkArgs(context, 1, maxArgs); err != nil {
+			return err
+		}
+		listen := context.String("listen")
+		if listen == "" {
+			var buf bytes.Buffer
+			if err := writeMetrics(context, &buf); err != nil {
+				return err
+			}
+			_, err := buf.WriteTo(os.Stdout)
+			return err
+		}
+
+		http.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+			var buf bytes.Buffer
+			if err := writeMetrics(context, &buf); err != nil {
+				logrus.Error(err)
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", openMetricsContentType)
+			if _, err := buf.WriteTo(w); err != nil {
+				logrus.Error(err)
+			}
+		})
+		return http.ListenAndServe(listenAddress(listen), nil)
+	},
+}
+
+// listenAddress returns the address to listen on for address, localhost when
+// it has no host. The metrics have the annotations of the containers, they
+// are only served to other hosts when asked for explicitly, e.g. 0.0.0.0:9100.
+func listenAddress(address string) string {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil || host != "" {
+		return address
+	}
+	return net.JoinHostPort("localhost", port)
+}
+
+// writeMetrics writes the metrics of the container given on the command line,
+// or of all the running containers.
+func writeMetrics(context *cli.Context, w io.Writer) error {
+	m := newOpenMetrics()
+	if context.Args().First() != "" {
+		container, err := getContainer(context)
+		if err != nil {
+			return err
+		}
+		if err := addContainerMetrics(m, container); err != nil {
+			return err
+		}
+		return m.write(w)
+	}
+
+	states, err := getContainers(context)
+	if err != nil {
+		return err
+	}
+	factory, err := loadFactory(context)
+	if err != nil {
+		return err
+	}
+	for _, s := range states {
+		if s.Status != libcontainer.Running.String() && s.Status != libcontainer.Paused.String() {
+			continue
+		}
+		container, err := factory.Load(s.ID)
+		if err != nil {
+			continue
+		}
+		// the container may have stopped in the meantime
+		if err := addContainerMetrics(m, container); err != nil {
+			logrus.Warnf("stats of %s: %v", s.ID, err)
+		}
+	}
+	return m.write(w)
+}
+
+func addContainerMetrics(m *openMetrics, container libcontainer.Container) error {
+	state, err := container.State()
+	if err != nil {
+		return err
+	}
+	ls, err := container.Stats()
+	if err != nil {
+		return err
+	}
+	s := convertLibcontainerStats(ls)
+	if s == nil {
+		return nil
+	}
+
+	_, annotations := utils.Annotations(state.Config.Labels)
+	labels := containerLabels(container.ID(), annotations)
+	addStatsMetrics(m, labels, s)
+	return nil
+}
+
+// labelNameRe matches the characters not allowed in label names.
+var labelNameRe = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// containerLabels returns the labels of the metrics of a container: its ID
+// and its annotations, prefixed with annotation_.
+func containerLabels(id string, annotations map[string]string) []label {
+	labels := []label{{"id", id}}
+	keys := make([]string, 0, len(annotations))
+	for k := range annotations {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	seen := make(map[string]bool)
+	for _, k := range keys {
+		name := "annotation_" + labelNameRe.ReplaceAllString(k, "_")
+		// a label name may only appear once
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		labels = append(labels, label{name, annotations[k]})
+	}
+	return labels
+}
+
+func addStatsMetrics(m *openMetrics, labels []label, s *stats) {
+	const nsPerSecond = 1e9
+
+	m.counter("runc_cpu_usage_seconds", "seconds", "Total CPU time consumed.", labels, float64(s.CPU.Usage.Total)/nsPerSecond)
+	m.counter("runc_cpu_kernel_seconds", "seconds", "CPU time consumed in kernel mode.", labels, float64(s.CPU.Usage.Kernel)/nsPerSecond)
+	m.counter("runc_cpu_user_seconds", "seconds", "CPU time consumed in user mode.", labels, float64(s.CPU.Usage.User)/nsPerSecond)
+	for i, u := range s.CPU.Usage.Percpu {
+		m.counter("runc_cpu_percpu_usage_seconds", "seconds", "CPU time consumed per core.", with(labels, "cpu", strconv.Itoa(i)), float64(u)/nsPerSecond)
+	}
+	m.counter("runc_cpu_throttling_periods", "", "Number of periods with throttling active.", labels, float64(s.CPU.Throttling.Periods))
+	m.counter("runc_cpu_throttled_periods", "", "Number of periods the container hit its throttling limit.", labels, float64(s.CPU.Throttling.ThrottledPeriods))
+	m.counter("runc_cpu_throttled_seconds", "seconds", "Time the container was throttled.", labels, float64(s.CPU.Throttling.ThrottledTime)/nsPerSecond)
+	addPSIMetrics(m, with(labels, "resource", "cpu"), s.CPU.PSI)
+
+	m.gauge("runc_memory_cache_bytes", "bytes", "Memory used for cache.", labels, float64(s.Memory.Cache))
+	for _, e := range []struct {
+		typ   string
+		entry memoryEntry
+	}{
+		{"usage", s.Memory.Usage},
+		{"swap", s.Memory.Swap},
+		{"kernel", s.Memory.Kernel},
+		{"kernel_tcp", s.Memory.KernelTCP},
+	} {
+		l := with(labels, "type", e.typ)
+		m.gauge("runc_memory_usage_bytes", "bytes", "Memory usage.", l, float64(e.entry.Usage))
+		m.gauge("runc_memory_max_usage_bytes", "bytes", "Maximum memory usage recorded.", l, float64(e.entry.Max))
+		m.gauge("runc_memory_limit_bytes", "bytes", "Memory limit.", l, float64(e.entry.Limit))
+		m.counter("runc_memory_failcnt", "", "Number of times the memory limit was hit.", l, float64(e.entry.Failcnt))
+	}
+	raw := make([]string, 0, len(s.Memory.Raw))
+	for k := range s.Memory.Raw {
+		raw = append(raw, k)
+	}
+	sort.Strings(raw)
+	for _, k := range raw {
+		m.gauge("runc_memory_stat", "", "Raw memory statistics of the cgroup.", with(labels, "name", k), float64(s.Memory.Raw[k]))
+	}
+	addPSIMetrics(m, with(labels, "resource", "memory"), s.Memory.PSI)
+
+	m.gauge("runc_pids_current", "", "Number of pids in the cgroup.", labels, float64(s.Pids.Current))
+	m.gauge("runc_pids_limit", "", "Pids limit, 0 being no limit.", labels, float64(s.Pids.Limit))
+
+	for _, b := range []struct {
+		name    string
+		entries []blkioEntry
+		// the queued requests are the only current value, the others
+		// add up since the cgroup was created
+		gauge bool
+	}{
+		{"io_service_bytes_recursive", s.Blkio.IoServiceBytesRecursive, false},
+		{"io_serviced_recursive", s.Blkio.IoServicedRecursive, false},
+		{"io_queue_recursive", s.Blkio.IoQueuedRecursive, true},
+		{"io_service_time_recursive", s.Blkio.IoServiceTimeRecursive, false},
+		{"io_wait_time_recursive", s.Blkio.IoWaitTimeRecursive, false},
+		{"io_merged_recursive", s.Blkio.IoMergedRecursive, false},
+		{"io_time_recursive", s.Blkio.IoTimeRecursive, false},
+		{"sectors_recursive", s.Blkio.SectorsRecursive, false},
+	} {
+		for _, e := range b.entries {
+			l := with(labels, "major", strconv.FormatUint(e.Major, 10))
+			l = with(l, "minor", strconv.FormatUint(e.Minor, 10))
+			l = with(l, "op", e.Op)
+			if b.gauge {
+				m.gauge("runc_blkio_"+b.name, "", "Block IO statistics of the cgroup.", l, float64(e.Value))
+			} else {
+				m.counter("runc_blkio_"+b.name, "", "Block IO statistics of the cgroup.", l, float64(e.Value))
+			}
+		}
+	}
+	addPSIMetrics(m, with(labels, "resource", "io"), s.Blkio.PSI)
+
+	sizes := make([]string, 0, len(s.Hugetlb))
+	for size := range s.Hugetlb {
+		sizes = append(sizes, size)
+	}
+	sort.Strings(sizes)
+	for _, size := range sizes {
+		h := s.Hugetlb[size]
+		l := with(labels, "pagesize", size)
+		m.gauge("runc_hugetlb_usage_bytes", "bytes", "Huge pages usage.", l, float64(h.Usage))
+		m.gauge("runc_hugetlb_max_usage_bytes", "bytes", "Maximum huge pages usage recorded.", l, float64(h.Max))
+		m.counter("runc_hugetlb_failcnt", "", "Number of huge page allocation failures.", l, float64(h.Failcnt))
+	}
+
+	if rdt := s.IntelRdt; rdt.L3CacheSchema != "" || rdt.MemBwSchema != "" {
+		l := labels
+		if rdt.L3CacheSchema != "" {
+			l = with(l, "l3_cache_schema", rdt.L3CacheSchema)
+		}
+		if rdt.MemBwSchema != "" {
+			l = with(l, "mem_bw_schema", rdt.MemBwSchema)
+		}
+		m.info("runc_intel_rdt", "Intel RDT schemata of the container.", l)
+	}
+	for _, mon := range s.IntelRdt.L3Monitoring {
+		l := with(labels, "l3_domain", strconv.FormatUint(mon.Id, 10))
+		m.gauge("runc_intel_rdt_llc_occupancy_bytes", "bytes", "L3 cache occupancy.", l, float64(mon.LLCOccupancy))
+		m.counter("runc_intel_rdt_mbm_bytes", "bytes", "Memory bandwidth used.", l, float64(mon.MBMTotalBytes))
+		m.counter("runc_intel_rdt_mbm_local_bytes", "bytes", "Local memory bandwidth used.", l, float64(mon.MBMLocalBytes))
+	}
+
+	for _, i := range s.NetworkInterfaces {
+		l := with(labels, "interface", i.Name)
+		m.counter("runc_network_receive_bytes", "bytes", "Bytes received.", l, float64(i.RxBytes))
+		m.counter("runc_network_receive_packets", "", "Packets received.", l, float64(i.RxPackets))
+		m.counter("runc_network_receive_errors", "", "Receive errors.", l, float64(i.RxErrors))
+		m.counter("runc_network_receive_dropped", "", "Received packets dropped.", l, float64(i.RxDropped))
+		m.counter("runc_network_transmit_bytes", "bytes", "Bytes transmitted.", l, float64(i.TxBytes))
+		m.counter("runc_network_transmit_packets", "", "Packets transmitted.", l, float64(i.TxPackets))
+		m.counter("runc_network_transmit_errors", "", "Transmit errors.", l, float64(i.TxErrors))
+		m.counter("runc_network_transmit_dropped", "", "Transmitted packets dropped.", l, float64(i.TxDropped))
+	}
+}
+
+func addPSIMetrics(m *openMetrics, labels []label, psi *psiStats) {
+	if psi == nil {
+		return
+	}
+	for _, p := range []struct {
+		kind string
+		data psiData
+	}{
+		{"some", psi.Some},
+		{"full", psi.Full},
+	} {
+		l := with(labels, "kind", p.kind)
+		m.counter("runc_pressure_stall_seconds", "seconds", "Time tasks were stalled on the resource.", l, float64(p.data.Total)/1e6)
+		m.gauge("runc_pressure_stall_avg10_ratio", "ratio", "Share of the time tasks were stalled on the resource over 10 seconds.", l, p.data.Avg10/100)
+		m.gauge("runc_pressure_stall_avg60_ratio", "ratio", "Share of the time tasks were stalled on the resource over 60 seconds.", l, p.data.Avg60/100)
+		m.gauge("runc_pressure_stall_avg300_ratio", "ratio", "Share of the time tasks were stalled on the resource over 300 seconds.", l, p.data.Avg300/100)
+	}
+}
+
+type label struct {
+	name, value string
+}
+
+// with returns labels with a new label, labels is not modified.
+func with(labels []label, name, value string) []label {
+	l := make([]label, len(labels), len(labels)+1)
+	copy(l, labels)
+	return append(l, label{name, value})
+}
+
+type metricSample struct {
+	suffix string
+	labels []label
+	value  float64
+}
+
+type metricFamily struct {
+	name, typ, unit, help string
+	samples               []metricSample
+}
+
+// openMetrics collects metric families, the samples of a family are written
+// together as the OpenMetrics text format requires.
+type openMetrics struct {
+	families []*metricFamily
+	index    map[string]*metricFamily
+}
+
+func newOpenMetrics() *openMetrics {
+	return &openMetrics{index: make(map[string]*metricFamily)}
+}
+
+func (m *openMetrics) add(name, typ, unit, help, suffix string, labels []label, value float64) {
+	f, ok := m.index[name]
+	if !ok {
+		f = &metricFamily{name: name, typ: typ, unit: unit, help: help}
+		m.index[name] = f
+		m.families = append(m.families, f)
+	}
+	f.samples = append(f.samples, metricSample{suffix: suffix, labels: labels, value: value})
+}
+
+func (m *openMetrics) counter(name, unit, help string, labels []label, value float64) {
+	m.add(name, "counter", unit, help, "_total", labels, value)
+}
+
+func (m *openMetrics) gauge(name, unit, help string, labels []label, value float64) {
+	m.add(name, "gauge", unit, help, "", labels, value)
+}
+
+func (m *openMetrics) info(name, help string, labels []label) {
+	m.add(name, "info", "", help, "_info", labels, 1)
+}
+
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func (m *openMetrics) write(w io.Writer) error {
+	var buf bytes.Buffer
+	for _, f := range m.families {
+		fmt.Fprintf(&buf, "# TYPE %s %s\n", f.name, f.typ)
+		if f.unit != "" {
+			fmt.Fprintf(&buf, "# UNIT %s %s\n", f.name, f.unit)
+		}
+		fmt.Fprintf(&buf, "# HELP %s %s\n", f.name, f.help)
+		for _, s := range f.samples {
+			buf.WriteString(f.name + s.suffix)
+			if len(s.labels) > 0 {
+				buf.WriteByte('{')
+				for i, l := range s.labels {
+					if i > 0 {
+						buf.WriteByte(',')
+					}
+					fmt.Fprintf(&buf, `%s="%s"`, l.name, labelValueReplacer.Replace(l.value))
+				}
+				buf.WriteByte('}')
+			}
+			fmt.Fprintf(&buf, " %s\n", strconv.FormatFloat(s.value, 'g', -1, 64))
+		}
+	}
+	buf.WriteString("# EOF\n")
+	_, err := buf.WriteTo(w)
+	return err
+}
@@ -0,0 +1,60 @@
+// +build linux
+
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestOpenMetricsWrite(t *testing.T) {
+	m := newOpenMetrics()
+	labels := containerLabels("ctr", map[string]string{
+		"org.example/quote": `say "hi"`,
+		"org.example.path":  `C:\dir` + "\nnext",
+	})
+	m.info("runc_container", "Information about the container.", with(labels, "status", "running"))
+	m.counter("runc_cpu_usage_seconds", "seconds", "Total CPU time consumed.", labels, 1.5)
+	m.gauge("runc_memory_usage_bytes", "bytes", "Memory usage.", labels, 4096)
+	m.gauge("runc_pids_current", "", "Number of processes.", []label{{"id", "other"}}, 3)
+	// a second sample of a family is written with the first one
+	m.counter("runc_cpu_usage_seconds", "seconds", "Total CPU time consumed.", []label{{"id", "other"}}, 2e10)
+
+	var buf bytes.Buffer
+	if err := m.write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	const expected = `# TYPE runc_container info
+# HELP runc_container Information about the container.
+runc_container_info{id="ctr",annotation_org_example_path="C:\\dir\nnext",annotation_org_example_quote="say \"hi\"",status="running"} 1
+# TYPE runc_cpu_usage_seconds counter
+# UNIT runc_cpu_usage_seconds seconds
+# HELP runc_cpu_usage_seconds Total CPU time consumed.
+runc_cpu_usage_seconds_total{id="ctr",annotation_org_example_path="C:\\dir\nnext",annotation_org_example_quote="say \"hi\""} 1.5
+runc_cpu_usage_seconds_total{id="other"} 2e+10
+# TYPE runc_memory_usage_bytes gauge
+# UNIT runc_memory_usage_bytes bytes
+# HELP runc_memory_usage_bytes Memory usage.
+runc_memory_usage_bytes{id="ctr",annotation_org_example_path="C:\\dir\nnext",annotation_org_example_quote="say \"hi\""} 4096
+# TYPE runc_pids_current gauge
+# HELP runc_pids_current Number of processes.
+runc_pids_current{id="other"} 3
+# EOF
+`
+	if buf.String() != expected {
+		t.Fatalf("expected:\n%s\ngot:\n%s", expected, buf.String())
+	}
+}
+
+func TestListenAddress(t *testing.T) {
+	for address, expected := range map[string]string{
+		":9100":        "localhost:9100",
+		"0.0.0.0:9100": "0.0.0.0:9100",
+		"[::1]:9100":   "[::1]:9100",
+		"localhost:80": "localhost:80",
+	} {
+		if got := listenAddress(address); got != expected {
+			t.Errorf("listenAddress(%q) = %q, expected %q", address, got, expected)
+		}
+	}
+}
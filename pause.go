@@ -32,7 +32,11 @@ Use runc list to identify instances of containers and their current status.`,
 		if err != nil {
 			return err
 		}
-		return container.Pause()
+		if err := container.Pause(); err != nil {
+			return err
+		}
+		recordContainerEvent(context, container, lifecyclePaused, &lifecycle{})
+		return nil
 	},
 }
 
@@ -61,6 +65,10 @@ Use runc list to identify instances of containers and their current status.`,
 		if err != nil {
 			return err
 		}
-		return container.Resume()
+		if err := container.Resume(); err != nil {
+			return err
+		}
+		recordContainerEvent(context, container, lifecycleResumed, &lifecycle{})
+		return nil
 	},
 }
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/urfave/cli"
+
+	"github.com/opencontainers/runc/prehook"
+	"github.com/opencontainers/runc/prehook/external"
+	"github.com/opencontainers/runc/utils"
+)
+
+//container id passed to the prehooks if not set
+const dryRunContainerID = "prehook-dry-run"
+
+//prehookResult is the json output of the prehook command
+type prehookResult struct {
+	Diff   string                `json:"diff"`
+	Writes []prehook.RootfsWrite `json:"writes"`
+}
+
+var prehookCommand = cli.Command{
+	Name:  "prehook",
+	Usage: "show the changes the prehooks would make to a bundle",
+	ArgsUsage: `[container-id]
+
+Where "[container-id]" is the container id passed to the prehooks, it defaults
+to "` + dryRunContainerID + `".`,
+	Description: `The prehook command runs the prehooks matching the spec of a bundle in dry
+run mode. It prints the diff of the spec and the files the prehooks would
+inject into the root filesystem, the bundle itself is left untouched.`,
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "bundle, b",
+			Value: "",
+			Usage: `path to the root of the bundle directory, defaults to the current directory`,
+		},
+		cli.StringFlag{
+			Name:  "format, f",
+			Value: "text",
+			Usage: `select one of: text or json`,
+		},
+	},
+	Action: func(context *cli.Context) error {
+		if err := checkArgs(context, 1, maxArgs); err != nil {
+			return err
+		}
+		spec, err := setupSpec(context)
+		if err != nil {
+			return err
+		}
+		if err := external.Load(context.GlobalString("prehook-dir")); err != nil {
+			return err
+		}
+
+		before, err := json.MarshalIndent(spec, "", "\t")
+		if err != nil {
+			return err
+		}
+
+		opt, err := prehook.CreateHookOptions(context, spec)
+		if err != nil {
+			return err
+		}
+		if opt.ID == "" {
+			opt.ID = dryRunContainerID
+			opt.StagingDir = prehook.StagingDir(context.GlobalString("root"), opt.ID)
+		}
+		if err := prehook.DryRun(opt, spec); err != nil {
+			return err
+		}
+
+		after, err := json.MarshalIndent(spec, "", "\t")
+		if err != nil {
+			return err
+		}
+
+		result := prehookResult{
+			Diff:   utils.UnifiedDiff("a/"+specConfig, "b/"+specConfig, string(before), string(after)),
+			Writes: opt.Writes,
+		}
+		if result.Writes == nil {
+			result.Writes = []prehook.RootfsWrite{}
+		}
+
+		switch context.String("format") {
+		case "text":
+			if result.Diff == "" {
+				fmt.Println("spec: no changes")
+			} else {
+				fmt.Print(result.Diff)
+			}
+			if len(result.Writes) == 0 {
+				fmt.Println("rootfs: no changes")
+				return nil
+			}
+			fmt.Println("rootfs:")
+			w := tabwriter.NewWriter(os.Stdout, 4, 4, 2, ' ', 0)
+			for _, write := range result.Writes {
+				if write.Target != "" {
+					fmt.Fprintf(w, "  %s\t%s\t%s -> %s\n", write.Type, write.Mode, write.Path, write.Target)
+					continue
+				}
+				fmt.Fprintf(w, "  %s\t%s\t%s\n", write.Type, write.Mode, write.Path)
+			}
+			return w.Flush()
+		case "json":
+			return json.NewEncoder(os.Stdout).Encode(result)
+		default:
+			return fmt.Errorf("invalid format option")
+		}
+	},
+}
@@ -0,0 +1,328 @@
+package external
+
+//external prehooks are executables configured by json files in a drop-in
+//directory, each receives the hook options and the spec on stdin and prints
+//the modified spec on stdout; options.dryRun is set by `runc prehook` and the
+//hook must not write to the rootfs then
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+
+	"github.com/opencontainers/runc/prehook"
+	"github.com/opencontainers/runc/utils"
+)
+
+const (
+	//DefaultDir is the default drop-in directory of external prehooks
+	DefaultDir = "/etc/runc/prehook.d"
+
+	//only supported hook definition version
+	definitionVersion = "1"
+
+	defaultTimeout = 10 * time.Second
+	//time the output of a killed hook is waited for, a process the hook
+	//started in another process group may still hold its stdout
+	killWaitTimeout = time.Second
+	hookTypePrefix  = "external:"
+)
+
+// Command is an executable run by an external prehook
+type Command struct {
+	Path string   `json:"path"`
+	Args []string `json:"args,omitempty"`
+	Env  []string `json:"env,omitempty"`
+	//timeout in seconds, 10 if not set
+	Timeout int `json:"timeout,omitempty"`
+}
+
+// When selects the containers an external prehook applies to
+type When struct {
+	Always bool `json:"always,omitempty"`
+	//annotation key to value regexp, all of them must match
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// Definition is the content of a drop-in json file
+type Definition struct {
+	Version  string   `json:"version"`
+	Priority int      `json:"priority,omitempty"`
+	Hook     Command  `json:"hook"`
+	Revert   *Command `json:"revert,omitempty"`
+	When     When     `json:"when"`
+}
+
+// Input is written to the stdin of the hook executable
+type Input struct {
+	Options *prehook.HookOptions `json:"options"`
+	Spec    *specs.Spec          `json:"spec"`
+}
+
+var (
+	log = utils.GetLogger()
+
+	loadedDirs = map[string]bool{}
+	loadMutex  = &sync.Mutex{}
+)
+
+// Load registers the external prehooks defined by dir/*.json, the hooks are
+// typed by file name; a missing dir is not an error
+func Load(dir string) error {
+	loadMutex.Lock()
+	defer loadMutex.Unlock()
+
+	if dir == "" || loadedDirs[dir] {
+		return nil
+	}
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(paths)
+
+	registrations := []*prehook.HookRegistration{}
+	for _, path := range paths {
+		def, err := ReadDefinition(path)
+		if err != nil {
+			return err
+		}
+
+		name := strings.TrimSuffix(filepath.Base(path), ".json")
+		registrations = append(registrations, newRegistration(name, def))
+	}
+
+	for _, r := range registrations {
+		prehook.RegisterPreHook(r)
+	}
+
+	loadedDirs[dir] = true
+
+	return nil
+}
+
+// ReadDefinition reads and validates a hook definition file
+func ReadDefinition(path string) (*Definition, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	def := &Definition{}
+
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(def); err != nil {
+		return nil, fmt.Errorf("parse prehook definition %s error: %v", path, err)
+	}
+
+	if err := def.validate(); err != nil {
+		return nil, fmt.Errorf("invalid prehook definition %s: %v", path, err)
+	}
+
+	return def, nil
+}
+
+func (d *Definition) validate() error {
+	if d.Version != definitionVersion {
+		return fmt.Errorf("unsupported version %q", d.Version)
+	}
+
+	if err := d.Hook.validate(); err != nil {
+		return err
+	}
+
+	if d.Revert != nil {
+		if err := d.Revert.validate(); err != nil {
+			return fmt.Errorf("revert: %v", err)
+		}
+	}
+
+	if !d.When.Always && len(d.When.Annotations) == 0 {
+		return errors.New("when must set always or annotations")
+	}
+
+	for key, pattern := range d.When.Annotations {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("invalid annotation %s pattern: %v", key, err)
+		}
+	}
+
+	return nil
+}
+
+func (c *Command) validate() error {
+	if !filepath.IsAbs(c.Path) {
+		return fmt.Errorf("hook path %q must be absolute", c.Path)
+	}
+
+	if c.Timeout < 0 {
+		return fmt.Errorf("invalid timeout %d", c.Timeout)
+	}
+
+	return nil
+}
+
+func (w *When) match(spec *specs.Spec) bool {
+	if w.Always {
+		return true
+	}
+
+	for key, pattern := range w.Annotations {
+		value, ok := spec.Annotations[key]
+		if !ok {
+			return false
+		}
+
+		//patterns are checked on load
+		if !regexp.MustCompile(pattern).MatchString(value) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func newRegistration(name string, def *Definition) *prehook.HookRegistration {
+	r := &prehook.HookRegistration{
+		Type:     hookTypePrefix + name,
+		Priority: def.Priority,
+		Match:    def.When.match,
+		RunFunc: func(opt *prehook.HookOptions, spec *specs.Spec) error {
+			newSpec, err := def.Hook.run(opt, spec)
+			if err != nil {
+				return err
+			}
+
+			if err := checkSpec(spec, newSpec); err != nil {
+				return fmt.Errorf("prehook %s returned an invalid spec: %v", name, err)
+			}
+
+			*spec = *newSpec
+			return nil
+		},
+	}
+
+	if def.Revert != nil {
+		r.Revert = func(opt *prehook.HookOptions, spec *specs.Spec) error {
+			_, err := def.Revert.execute(opt, spec)
+			return err
+		}
+	}
+
+	return r
+}
+
+// execute runs the command with the input on stdin and returns its stdout
+func (c *Command) execute(opt *prehook.HookOptions, spec *specs.Spec) ([]byte, error) {
+	input, err := json.Marshal(&Input{Options: opt, Spec: spec})
+	if err != nil {
+		return nil, err
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Cmd{
+		Path:   c.Path,
+		Args:   append([]string{c.Path}, c.Args...),
+		Env:    c.Env,
+		Stdin:  bytes.NewReader(input),
+		Stdout: &stdout,
+		Stderr: &stderr,
+		//the processes started by the hook are killed with it on timeout
+		SysProcAttr: &syscall.SysProcAttr{Setpgid: true},
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	errC := make(chan error, 1)
+	go func() {
+		errC <- cmd.Wait()
+	}()
+
+	timeout := defaultTimeout
+	if c.Timeout > 0 {
+		timeout = time.Duration(c.Timeout) * time.Second
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case err := <-errC:
+		if err != nil {
+			return nil, fmt.Errorf("error running prehook %s: %v, stderr: %s", c.Path, err, stderr.String())
+		}
+	case <-timer.C:
+		syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		select {
+		case <-errC:
+		case <-time.After(killWaitTimeout):
+			log.Warnf("prehook %s output is still open after it was killed", c.Path)
+		}
+		return nil, fmt.Errorf("prehook %s ran past timeout of %s", c.Path, timeout)
+	}
+
+	return stdout.Bytes(), nil
+}
+
+// run executes the command and decodes the spec it prints
+func (c *Command) run(opt *prehook.HookOptions, spec *specs.Spec) (*specs.Spec, error) {
+	out, err := c.execute(opt, spec)
+	if err != nil {
+		return nil, err
+	}
+
+	newSpec := &specs.Spec{}
+
+	dec := json.NewDecoder(bytes.NewReader(out))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(newSpec); err != nil {
+		return nil, fmt.Errorf("decode spec from prehook %s error: %v", c.Path, err)
+	}
+
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("prehook %s printed trailing data after the spec", c.Path)
+	}
+
+	return newSpec, nil
+}
+
+// checkSpec rejects the changes a prehook is not allowed to make
+func checkSpec(old *specs.Spec, spec *specs.Spec) error {
+	if spec.Version != old.Version {
+		return fmt.Errorf("ociVersion changed from %q to %q", old.Version, spec.Version)
+	}
+
+	if spec.Root == nil || old.Root == nil || spec.Root.Path != old.Root.Path {
+		return errors.New("root path must not be changed")
+	}
+
+	if spec.Process == nil {
+		return errors.New("process is not set")
+	}
+
+	if len(spec.Process.Args) == 0 {
+		return errors.New("process args are not set")
+	}
+
+	if (spec.Linux == nil) != (old.Linux == nil) {
+		return errors.New("linux section must not be added or removed")
+	}
+
+	return nil
+}
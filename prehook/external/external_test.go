@@ -0,0 +1,181 @@
+package external
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+
+	"github.com/opencontainers/runc/prehook"
+)
+
+const helperModeEnv = "RUNC_PREHOOK_HELPER"
+
+func testSpec() *specs.Spec {
+	return &specs.Spec{
+		Version: specs.Version,
+		Root:    &specs.Root{Path: "rootfs"},
+		Process: &specs.Process{Args: []string{"sh"}},
+	}
+}
+
+func helperCommand(mode string) Command {
+	return Command{
+		Path: os.Args[0],
+		Args: []string{"-test.run=TestHelperPreHook"},
+		Env:  []string{helperModeEnv + "=" + mode},
+	}
+}
+
+func TestCommandRun(t *testing.T) {
+	c := helperCommand("annotate")
+	spec, err := c.run(&prehook.HookOptions{ID: "test"}, testSpec())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if spec.Annotations["prehook.id"] != "test" {
+		t.Fatalf("expected annotation set by prehook, got %v", spec.Annotations)
+	}
+	if err := checkSpec(testSpec(), spec); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCommandRunRejectsUnknownFields(t *testing.T) {
+	c := helperCommand("unknown-field")
+	if _, err := c.run(&prehook.HookOptions{ID: "test"}, testSpec()); err == nil {
+		t.Fatal("expected error decoding spec with unknown fields")
+	}
+}
+
+func TestCommandRunTimeout(t *testing.T) {
+	c := helperCommand("sleep")
+	c.Timeout = 1
+
+	start := time.Now()
+	if _, err := c.run(&prehook.HookOptions{ID: "test"}, testSpec()); err == nil {
+		t.Fatal("expected timeout error")
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Fatal("prehook was not killed on timeout")
+	}
+}
+
+func TestCommandRunTimeoutKillsChildren(t *testing.T) {
+	for _, mode := range []string{"fork-sleep", "setsid-sleep"} {
+		c := helperCommand(mode)
+		c.Timeout = 1
+
+		start := time.Now()
+		if _, err := c.run(&prehook.HookOptions{ID: "test"}, testSpec()); err == nil {
+			t.Fatalf("%s: expected timeout error", mode)
+		}
+		if time.Since(start) > 5*time.Second {
+			t.Fatalf("%s: prehook was not killed on timeout", mode)
+		}
+	}
+}
+
+func TestCheckSpec(t *testing.T) {
+	spec := testSpec()
+	spec.Root.Path = "/other"
+	if err := checkSpec(testSpec(), spec); err == nil {
+		t.Fatal("expected error changing root path")
+	}
+
+	spec = testSpec()
+	spec.Process.Args = nil
+	if err := checkSpec(testSpec(), spec); err == nil {
+		t.Fatal("expected error clearing process args")
+	}
+}
+
+func TestReadDefinition(t *testing.T) {
+	dir, err := ioutil.TempDir("", "prehook.d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for name, content := range map[string]string{
+		"valid.json":   `{"version": "1", "hook": {"path": "/bin/true", "timeout": 5}, "when": {"annotations": {"io.example.mode": "^on$"}}}`,
+		"unknown.json": `{"version": "1", "hook": {"path": "/bin/true"}, "when": {"always": true}, "extra": 1}`,
+		"relpath.json": `{"version": "1", "hook": {"path": "true"}, "when": {"always": true}}`,
+		"nowhen.json":  `{"version": "1", "hook": {"path": "/bin/true"}}`,
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	def, err := ReadDefinition(filepath.Join(dir, "valid.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec := testSpec()
+	if def.When.match(spec) {
+		t.Fatal("expected hook not to match spec without annotation")
+	}
+	spec.Annotations = map[string]string{"io.example.mode": "on"}
+	if !def.When.match(spec) {
+		t.Fatal("expected hook to match annotated spec")
+	}
+
+	for _, name := range []string{"unknown.json", "relpath.json", "nowhen.json"} {
+		if _, err := ReadDefinition(filepath.Join(dir, name)); err == nil {
+			t.Fatalf("expected error reading %s", name)
+		}
+	}
+}
+
+func TestHelperPreHook(*testing.T) {
+	mode := os.Getenv(helperModeEnv)
+	if mode == "" {
+		return
+	}
+
+	input := &Input{}
+	if err := json.NewDecoder(os.Stdin).Decode(input); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	switch mode {
+	case "annotate":
+		input.Spec.Annotations = map[string]string{"prehook.id": input.Options.ID}
+		json.NewEncoder(os.Stdout).Encode(input.Spec)
+	case "unknown-field":
+		data, _ := json.Marshal(input.Spec)
+		fmt.Print(strings.Replace(string(data), "{", `{"bogus":true,`, 1))
+	case "sleep":
+		time.Sleep(time.Minute)
+	case "fork-sleep", "setsid-sleep":
+		//the child holds the stdout of the hook
+		//the hook env has no PATH
+		os.Setenv("PATH", "/usr/bin:/bin")
+		child := exec.Command("sleep", "60")
+		child.Stdout = os.Stdout
+		if mode == "setsid-sleep" {
+			//escapes the kill, so it does not outlive the test for long
+			child = exec.Command("sleep", "5")
+			child.Stdout = os.Stdout
+			child.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+		}
+		if err := child.Start(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		time.Sleep(time.Minute)
+	}
+
+	os.Exit(0)
+}
@@ -3,25 +3,81 @@ package prehook
 //hook in pre create container
 
 import (
+	"fmt"
+	"os"
 	"path/filepath"
+	"sort"
 	"sync"
 
 	"github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/urfave/cli"
+
+	"github.com/opencontainers/runc/utils"
 )
 
 type HookOptions struct {
 	//container rootfs path
-	RootfsDir string
+	RootfsDir string `json:"rootfsDir"`
 	//container id
-	ID string
+	ID string `json:"id"`
+	//bundle path
+	BundleDir string `json:"bundleDir"`
+	//directory the hooks stage the files they inject into the rootfs, the
+	//staged files are mounted into the container so that the rootfs is left
+	//untouched; it is removed when the container is deleted
+	StagingDir string `json:"stagingDir,omitempty"`
+	//hooks must not write to the rootfs in dry run mode, they record the
+	//intended writes by RecordWrite instead
+	DryRun bool `json:"dryRun,omitempty"`
+	//rootfs writes recorded in dry run mode
+	Writes []RootfsWrite `json:"-"`
+}
+
+//RootfsWrite is a rootfs change a hook would make
+type RootfsWrite struct {
+	//path in container rootfs
+	Path string `json:"path"`
+	//file, directory or symlink
+	Type string      `json:"type"`
+	Mode os.FileMode `json:"mode"`
+	//symlink target
+	Target string `json:"target,omitempty"`
+}
+
+//RecordWrite records a rootfs write in dry run mode, path is relative to the
+//host root and is converted to the path in container rootfs
+func (o *HookOptions) RecordWrite(w RootfsWrite) {
+	if rel, err := filepath.Rel(o.RootfsDir, w.Path); err == nil {
+		w.Path = filepath.Join("/", rel)
+	}
+
+	//a path written several times is reported once
+	for _, recorded := range o.Writes {
+		if recorded.Path == w.Path {
+			return
+		}
+	}
+
+	o.Writes = append(o.Writes, w)
 }
 
 type HookFunc func(opt *HookOptions, spec *specs.Spec) error
 
+//MatchFunc reports whether a hook applies to the container spec
+type MatchFunc func(spec *specs.Spec) bool
+
 type HookRegistration struct {
-	Type    string
+	//unique hook type name
+	Type string
+	//hooks with lower priority run first, hooks with the same priority
+	//run in registration order
+	Priority int
+	//hook is skipped if Match is set and returns false
+	Match   MatchFunc
 	RunFunc HookFunc
+	//undo the changes made by RunFunc, called in reverse order on every hook
+	//that already ran when a later hook fails
+	Revert HookFunc
 }
 
 func RegisterPreHook(f *HookRegistration) {
@@ -32,18 +88,51 @@ func RegisterPreHook(f *HookRegistration) {
 		panic("not set hook type")
 	}
 
+	if f.RunFunc == nil {
+		panic(fmt.Sprintf("not set run func of hook %s", f.Type))
+	}
+
+	for _, hook := range hookRegistrations {
+		if hook.Type == f.Type {
+			panic(fmt.Sprintf("hook %s has been registered", f.Type))
+		}
+	}
+
 	hookRegistrations = append(hookRegistrations, f)
+	sort.SliceStable(hookRegistrations, func(i, j int) bool {
+		return hookRegistrations[i].Priority < hookRegistrations[j].Priority
+	})
 }
 
 var (
+	log = utils.GetLogger()
+
 	hookRegistrations = []*HookRegistration{}
 	registerMutex     = &sync.Mutex{}
 )
 
+//PreHook runs the matching hooks by priority, if one fails the hooks already
+//run are reverted and the error of the failed hook is returned
 func PreHook(opt *HookOptions, spec *specs.Spec) error {
-	for _, hook := range hookRegistrations {
+	registerMutex.Lock()
+	hooks := make([]*HookRegistration, len(hookRegistrations))
+	copy(hooks, hookRegistrations)
+	registerMutex.Unlock()
+
+	applied := []*HookRegistration{}
+
+	for _, hook := range hooks {
+		if hook.Match != nil && !hook.Match(spec) {
+			continue
+		}
+
+		//a failed hook may have done part of its work, so revert it too
+		applied = append(applied, hook)
+
 		err := hook.RunFunc(opt, spec)
 		if err != nil {
+			err = fmt.Errorf("run prehook %s error: %v", hook.Type, err)
+			revert(opt, spec, applied)
 			return err
 		}
 	}
@@ -51,13 +140,35 @@ func PreHook(opt *HookOptions, spec *specs.Spec) error {
 	return nil
 }
 
+//DryRun runs the matching hooks in dry run mode on spec, the rootfs writes
+//the hooks would make are recorded in opt.Writes
+func DryRun(opt *HookOptions, spec *specs.Spec) error {
+	opt.DryRun = true
+	return PreHook(opt, spec)
+}
+
+func revert(opt *HookOptions, spec *specs.Spec, applied []*HookRegistration) {
+	for i := len(applied) - 1; i >= 0; i-- {
+		hook := applied[i]
+		if hook.Revert == nil {
+			continue
+		}
+
+		if err := hook.Revert(opt, spec); err != nil {
+			log.Warnf("container %s, revert prehook %s error: %v", opt.ID, hook.Type, err)
+		}
+	}
+}
+
 func CreateHookOptions(context *cli.Context, spec *specs.Spec) (*HookOptions, error) {
 	rootfsPath := ""
 
 	if filepath.IsAbs(spec.Root.Path) {
 		rootfsPath = spec.Root.Path
 	} else {
-		p, err := filepath.Abs(filepath.Join(context.String("bundle"), spec.Root.Path))
+		//the working directory is already the bundle, see setupSpec, so a
+		//relative --bundle must not be joined again
+		p, err := filepath.Abs(spec.Root.Path)
 		if err != nil {
 			return nil, err
 		}
@@ -65,8 +176,41 @@ func CreateHookOptions(context *cli.Context, spec *specs.Spec) (*HookOptions, er
 		rootfsPath = p
 	}
 
+	bundleDir, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+
+	id := context.Args().First()
+
 	return &HookOptions{
-		RootfsDir: rootfsPath,
-		ID:        context.Args().First(),
+		RootfsDir:  rootfsPath,
+		ID:         id,
+		BundleDir:  bundleDir,
+		StagingDir: StagingDir(context.GlobalString("root"), id),
 	}, nil
 }
+
+//StagingDir returns the staging directory of container id, it is kept out of
+//root so that it is not taken for a container
+func StagingDir(root string, id string) string {
+	if id == "" {
+		return ""
+	}
+
+	if abs, err := filepath.Abs(root); err == nil {
+		root = abs
+	}
+
+	return filepath.Join(filepath.Clean(root)+"-prehook", id)
+}
+
+//RemoveStagingDir removes the staging directory of container id
+func RemoveStagingDir(root string, id string) error {
+	dir := StagingDir(root, id)
+	if dir == "" {
+		return nil
+	}
+
+	return os.RemoveAll(dir)
+}
@@ -0,0 +1,146 @@
+package prehook
+
+import (
+	"errors"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/urfave/cli"
+)
+
+//withRegistrations replaces the registered hooks, call the returned func to
+//restore them
+func withRegistrations(hooks ...*HookRegistration) func() {
+	saved := hookRegistrations
+	hookRegistrations = []*HookRegistration{}
+
+	for _, hook := range hooks {
+		RegisterPreHook(hook)
+	}
+
+	return func() { hookRegistrations = saved }
+}
+
+func TestPreHookOrderAndMatch(t *testing.T) {
+	order := []string{}
+	record := func(name string) HookFunc {
+		return func(opt *HookOptions, spec *specs.Spec) error {
+			order = append(order, name)
+			return nil
+		}
+	}
+
+	defer withRegistrations(
+		&HookRegistration{Type: "late", Priority: 10, RunFunc: record("late")},
+		&HookRegistration{Type: "first", Priority: -1, RunFunc: record("first")},
+		&HookRegistration{Type: "default-a", RunFunc: record("default-a")},
+		&HookRegistration{Type: "default-b", RunFunc: record("default-b")},
+		&HookRegistration{
+			Type:    "skipped",
+			Match:   func(spec *specs.Spec) bool { return false },
+			RunFunc: record("skipped"),
+		},
+	)()
+
+	if err := PreHook(&HookOptions{ID: "test"}, &specs.Spec{}); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"first", "default-a", "default-b", "late"}
+	if !reflect.DeepEqual(order, expected) {
+		t.Fatalf("expected hooks to run as %v, got %v", expected, order)
+	}
+}
+
+func TestPreHookRevert(t *testing.T) {
+	reverted := []string{}
+	revert := func(name string) HookFunc {
+		return func(opt *HookOptions, spec *specs.Spec) error {
+			reverted = append(reverted, name)
+			return nil
+		}
+	}
+	ok := func(opt *HookOptions, spec *specs.Spec) error { return nil }
+
+	defer withRegistrations(
+		&HookRegistration{Type: "a", Priority: 1, RunFunc: ok, Revert: revert("a")},
+		&HookRegistration{Type: "no-revert", Priority: 2, RunFunc: ok},
+		&HookRegistration{Type: "b", Priority: 3, RunFunc: ok, Revert: revert("b")},
+		&HookRegistration{
+			Type:     "failing",
+			Priority: 4,
+			RunFunc:  func(opt *HookOptions, spec *specs.Spec) error { return errors.New("boom") },
+			Revert:   revert("failing"),
+		},
+		&HookRegistration{Type: "not-run", Priority: 5, RunFunc: ok, Revert: revert("not-run")},
+	)()
+
+	if err := PreHook(&HookOptions{ID: "test"}, &specs.Spec{}); err == nil {
+		t.Fatal("expected prehook error")
+	}
+
+	expected := []string{"failing", "b", "a"}
+	if !reflect.DeepEqual(reverted, expected) {
+		t.Fatalf("expected hooks to be reverted as %v, got %v", expected, reverted)
+	}
+}
+
+func TestRegisterPreHookDuplicateType(t *testing.T) {
+	ok := func(opt *HookOptions, spec *specs.Spec) error { return nil }
+	defer withRegistrations(&HookRegistration{Type: "dup", RunFunc: ok})()
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected panic registering a duplicate hook type")
+		}
+	}()
+	RegisterPreHook(&HookRegistration{Type: "dup", RunFunc: ok})
+}
+
+func TestCreateHookOptionsRelativeBundle(t *testing.T) {
+	dir, err := ioutil.TempDir("", "prehook-bundle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	dir, err = filepath.EvalSymlinks(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bundle := filepath.Join(dir, "bundle")
+	if err := os.Mkdir(bundle, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(cwd)
+	//runc is started in dir with --bundle bundle, and setupSpec enters it
+	if err := os.Chdir(bundle); err != nil {
+		t.Fatal(err)
+	}
+
+	set := flag.NewFlagSet("test", flag.ContinueOnError)
+	set.String("bundle", "", "")
+	if err := set.Parse([]string{"--bundle", "bundle", "ctr"}); err != nil {
+		t.Fatal(err)
+	}
+
+	opt, err := CreateHookOptions(cli.NewContext(nil, set, nil), &specs.Spec{Root: &specs.Root{Path: "rootfs"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := filepath.Join(bundle, "rootfs"); opt.RootfsDir != expected {
+		t.Fatalf("expected rootfs %s, got %s", expected, opt.RootfsDir)
+	}
+	if opt.BundleDir != bundle || opt.ID != "ctr" {
+		t.Fatalf("unexpected options %+v", opt)
+	}
+}
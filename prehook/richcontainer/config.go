@@ -0,0 +1,168 @@
+package richcontainer
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+//rich container is configured by oci annotations, the env vars below are
+//still accepted as a deprecated fallback
+const (
+	annotationPrefix     = "io.alibaba.rich-container."
+	annotationEnabled    = annotationPrefix + "enabled"
+	annotationLauncher   = annotationPrefix + "launcher"
+	annotationUser       = annotationPrefix + "user"
+	annotationInitScript = annotationPrefix + "init-script"
+	//set by the launcher, see CheckHealth
+	annotationHealthCheck = annotationPrefix + "health-check"
+
+	richModeEnvKey       = "rich_mode"
+	richModeLaunchEnvKey = "rich_mode_launch_manner"
+	richModeScriptEnvKey = "initscript"
+)
+
+//Config is the rich container configuration of a container
+type Config struct {
+	Enabled bool
+	//launcher name, the default launcher is used if empty
+	Launcher string
+	//user the launcher runs the container process as, keep spec user if empty
+	User string
+	//absolute path in container rootfs of a script run before the entrypoint
+	InitScript string
+	//services run by the launcher besides the container args
+	Services []*Service
+	//file the services are loaded from, relative path is relative to bundle
+	ServicesFile string
+	//env names not persisted to rootfs, a trailing * matches a prefix
+	EnvExclude []string
+}
+
+//ParseConfig reads rich container config from spec annotations, falling back
+//to the deprecated env vars for the keys not set by annotations
+func ParseConfig(spec *specs.Spec) (*Config, error) {
+	config := &Config{}
+
+	envs := map[string]string{}
+	if spec.Process != nil {
+		for _, env := range spec.Process.Env {
+			kvs := strings.SplitN(env, "=", 2)
+			if len(kvs) == 2 {
+				envs[kvs[0]] = kvs[1]
+			}
+		}
+	}
+
+	if v, ok := spec.Annotations[annotationEnabled]; ok {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid annotation %s=%q: %v", annotationEnabled, v, err)
+		}
+		config.Enabled = enabled
+	} else if v, ok := envs[richModeEnvKey]; ok {
+		config.Enabled = strings.TrimSpace(v) == "true"
+		if config.Enabled {
+			log.Warnf("env %s is deprecated, use annotation %s instead", richModeEnvKey, annotationEnabled)
+		}
+	}
+
+	if v, ok := spec.Annotations[annotationLauncher]; ok {
+		config.Launcher = v
+	} else if v, ok := envs[richModeLaunchEnvKey]; ok {
+		config.Launcher = v
+		log.Warnf("env %s is deprecated, use annotation %s instead", richModeLaunchEnvKey, annotationLauncher)
+	}
+
+	if v, ok := spec.Annotations[annotationUser]; ok {
+		config.User = v
+	}
+
+	if v, ok := spec.Annotations[annotationInitScript]; ok {
+		config.InitScript = v
+	} else if v, ok := envs[richModeScriptEnvKey]; ok && config.Enabled {
+		config.InitScript = v
+		log.Warnf("env %s is deprecated, use annotation %s instead", richModeScriptEnvKey, annotationInitScript)
+	}
+
+	if !config.Enabled {
+		return config, nil
+	}
+
+	if v, ok := spec.Annotations[annotationServices]; ok {
+		services, err := decodeServices([]byte(v), "annotation "+annotationServices)
+		if err != nil {
+			return nil, err
+		}
+		config.Services = services
+	}
+
+	if v, ok := spec.Annotations[annotationServicesFile]; ok {
+		config.ServicesFile = v
+	}
+
+	if v, ok := spec.Annotations[annotationEnvExclude]; ok {
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				config.EnvExclude = append(config.EnvExclude, name)
+			}
+		}
+	}
+
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+func (c *Config) validate() error {
+	if c.Launcher != "" && GetLauncher(c.Launcher) == nil {
+		return fmt.Errorf("not found rich container launcher %s", c.Launcher)
+	}
+
+	if c.Launcher == "" && GetDefaultLauncher() == nil {
+		return fmt.Errorf("not found default rich container launcher %s", launcherManager.defaultLauncher)
+	}
+
+	if c.User != "" && strings.TrimSpace(c.User) != c.User {
+		return fmt.Errorf("invalid rich container user %q", c.User)
+	}
+
+	if c.InitScript != "" && !filepath.IsAbs(c.InitScript) {
+		return fmt.Errorf("rich container init script %s must be an absolute path", c.InitScript)
+	}
+
+	if c.ServicesFile != "" && len(c.Services) > 0 {
+		return fmt.Errorf("annotations %s and %s are exclusive", annotationServices, annotationServicesFile)
+	}
+
+	if err := validateServices(c.Services); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+//stripControlEnv removes the rich container control env vars so they do not
+//leak into the workload environment
+func stripControlEnv(spec *specs.Spec) {
+	if spec.Process == nil {
+		return
+	}
+
+	envs := make([]string, 0, len(spec.Process.Env))
+	for _, env := range spec.Process.Env {
+		key := strings.SplitN(env, "=", 2)[0]
+		switch strings.TrimSpace(key) {
+		case richModeEnvKey, richModeLaunchEnvKey, richModeScriptEnvKey:
+			continue
+		}
+		envs = append(envs, env)
+	}
+
+	spec.Process.Env = envs
+}
@@ -0,0 +1,115 @@
+package richcontainer
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+
+	"github.com/opencontainers/runc/prehook"
+)
+
+func TestParseConfigAnnotations(t *testing.T) {
+	spec := &specs.Spec{
+		Process: &specs.Process{},
+		Annotations: map[string]string{
+			annotationEnabled:    "true",
+			annotationLauncher:   systemdLauncherName,
+			annotationUser:       "nobody",
+			annotationInitScript: "/opt/init.sh",
+		},
+	}
+
+	config, err := ParseConfig(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := &Config{
+		Enabled:    true,
+		Launcher:   systemdLauncherName,
+		User:       "nobody",
+		InitScript: "/opt/init.sh",
+	}
+	if !reflect.DeepEqual(config, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, config)
+	}
+}
+
+func TestParseConfigEnvFallback(t *testing.T) {
+	spec := &specs.Spec{
+		Process: &specs.Process{
+			Env: []string{"PATH=/bin", "rich_mode=true", "rich_mode_launch_manner=sbin-init", "initscript=/init.sh"},
+		},
+	}
+
+	config, err := ParseConfig(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !config.Enabled || config.Launcher != initdLauncherName || config.InitScript != "/init.sh" {
+		t.Fatalf("unexpected config %+v", config)
+	}
+
+	stripControlEnv(spec)
+	if !reflect.DeepEqual(spec.Process.Env, []string{"PATH=/bin"}) {
+		t.Fatalf("control env not stripped: %v", spec.Process.Env)
+	}
+}
+
+func TestParseConfigAnnotationOverridesEnv(t *testing.T) {
+	spec := &specs.Spec{
+		Process: &specs.Process{
+			Env: []string{"rich_mode=true"},
+		},
+		Annotations: map[string]string{
+			annotationEnabled: "false",
+		},
+	}
+
+	config, err := ParseConfig(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Enabled {
+		t.Fatal("annotation should override the deprecated env")
+	}
+}
+
+func TestParseConfigInvalid(t *testing.T) {
+	for _, annotations := range []map[string]string{
+		{annotationEnabled: "yes please"},
+		{annotationEnabled: "true", annotationLauncher: "no-such-launcher"},
+		{annotationEnabled: "true", annotationInitScript: "relative/init.sh"},
+	} {
+		spec := &specs.Spec{
+			Process:     &specs.Process{},
+			Annotations: annotations,
+		}
+		if _, err := ParseConfig(spec); err == nil {
+			t.Fatalf("expected error for annotations %v", annotations)
+		}
+	}
+}
+
+func TestRunHookKeepsEnvWhenDisabled(t *testing.T) {
+	env := []string{"PATH=/bin", "rich_mode=false", "initscript=/init.sh"}
+	spec := &specs.Spec{
+		Process: &specs.Process{
+			Env: append([]string{}, env...),
+		},
+		Annotations: map[string]string{
+			annotationHealthCheck: "systemd",
+		},
+	}
+
+	if err := runHook(&prehook.HookOptions{ID: "test"}, spec); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(spec.Process.Env, env) {
+		t.Fatalf("env of a container that is not rich changed: %v", spec.Process.Env)
+	}
+	if _, ok := spec.Annotations[annotationHealthCheck]; ok {
+		t.Fatal("health check annotation not removed")
+	}
+}
@@ -2,11 +2,7 @@ package richcontainer
 
 import (
 	"errors"
-	"fmt"
-	"io"
-	"os"
 	"os/exec"
-	"path/filepath"
 
 	"github.com/opencontainers/runtime-spec/specs-go"
 
@@ -34,8 +30,8 @@ func (l *dumbInitLauncher) Name() string {
 }
 
 //todo:
-func (l *dumbInitLauncher) Launch(opt *prehook.HookOptions, spec *specs.Spec) error {
-	fmt.Println("rich container mode in dumb-init mode")
+func (l *dumbInitLauncher) Launch(opt *prehook.HookOptions, spec *specs.Spec, config *Config) error {
+	log.Infof("container %s, rich container mode in dumb-init mode", opt.ID)
 
 	//find dumb-init path in node
 	path, err := exec.LookPath(dumbInitAppName)
@@ -43,12 +39,7 @@ func (l *dumbInitLauncher) Launch(opt *prehook.HookOptions, spec *specs.Spec) er
 		return err
 	}
 
-	abPath, err := filepath.Abs(path)
-	if err != nil {
-		return err
-	}
-
-	err = l.copyToContainerRootfs(abPath, opt.RootfsDir)
+	err = injectHostBinary(journalFor(opt), path, opt.RootfsDir, dumbInitRootfsPath)
 	if err != nil {
 		return err
 	}
@@ -59,51 +50,19 @@ func (l *dumbInitLauncher) Launch(opt *prehook.HookOptions, spec *specs.Spec) er
 		return errors.New("not set args")
 	}
 
+	if config.InitScript != "" {
+		args = wrapWithInitScript(config.InitScript, args)
+	}
+
 	newArgs := []string{dumbInitRootfsPath, "--"}
 	newArgs = append(newArgs, args...)
 
 	spec.Process.Args = newArgs
-	//set user to admin
-	spec.Process.User.Username = "admin"
-
-	return nil
-}
-
-func (l *dumbInitLauncher) copyToContainerRootfs(binPath string, rootfs string) error {
-	rootfsBinPath := filepath.Join(rootfs, dumbInitRootfsPath)
-	_, err := os.Stat(rootfsBinPath)
-
-	if err == nil {
-		return nil
-	}
+	setHealthCheck(spec, healthCheckChild, "")
 
-	if !os.IsNotExist(err) {
-		return err
-	}
-
-	//mkdir /usr/bin
-	err = os.MkdirAll(filepath.Dir(rootfsBinPath), 0x0755)
-	if err != nil {
-		return err
-	}
-
-	fin, err := os.Open(binPath)
-	if err != nil {
-		return err
-	}
-
-	defer fin.Close()
-
-	fout, err := os.OpenFile(rootfsBinPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0x0755)
-	if err != nil {
-		return err
-	}
-
-	defer fout.Close()
-
-	_, err = io.Copy(fout, fin)
-	if err != nil {
-		return err
+	//keep the spec user if not configured
+	if config.User != "" {
+		return setProcessUser(opt.RootfsDir, config.User, spec)
 	}
 
 	return nil
@@ -0,0 +1,235 @@
+package richcontainer
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"syscall"
+
+	"github.com/cyphar/filepath-securejoin"
+	"github.com/opencontainers/runtime-spec/specs-go"
+
+	"github.com/opencontainers/runc/prehook"
+)
+
+//container env is persisted into the rootfs so that login shells, pam and
+//systemd services started by the launcher see the same env as the container
+
+const (
+	persistentEnvShFile = "/etc/profile.d/pouchenv.sh"
+	persistentEnvShDir  = "/etc/profile.d"
+	etcEnvironmentFile  = "/etc/environment"
+	//EnvironmentFile of the generated systemd units
+	systemdEnvFile = "/etc/richcontainer/environment"
+
+	//comma separated env names not to persist, a trailing * matches a prefix
+	annotationEnvExclude = annotationPrefix + "env-exclude"
+
+	//the image /etc/environment is merged into the persisted env up to this size
+	maxEtcEnvironmentSize = 64 << 10
+)
+
+var (
+	envNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+	//env maintained by the shell itself, never persisted
+	defaultEnvExclude = []string{"PWD", "OLDPWD", "SHLVL", "_"}
+)
+
+type envVar struct {
+	key   string
+	value string
+}
+
+//persistentEnv returns the container env to persist in order, a key set
+//several times keeps its last value; excluded entries are logged
+func persistentEnv(opt *prehook.HookOptions, spec *specs.Spec, config *Config) []envVar {
+	exclude := append(append([]string{}, defaultEnvExclude...), config.EnvExclude...)
+
+	vars := []envVar{}
+	index := map[string]int{}
+
+	for _, env := range spec.Process.Env {
+		kvs := strings.SplitN(env, "=", 2)
+		if len(kvs) != 2 {
+			log.Infof("container %s, env %q is not persisted: missing '='", opt.ID, env)
+			continue
+		}
+
+		key, value := kvs[0], kvs[1]
+
+		if !envNameRegexp.MatchString(key) {
+			log.Infof("container %s, env %q is not persisted: invalid name", opt.ID, key)
+			continue
+		}
+
+		if matchEnvName(exclude, key) {
+			log.Infof("container %s, env %s is not persisted: excluded by policy", opt.ID, key)
+			continue
+		}
+
+		if i, ok := index[key]; ok {
+			vars[i].value = value
+			continue
+		}
+
+		index[key] = len(vars)
+		vars = append(vars, envVar{key: key, value: value})
+	}
+
+	return vars
+}
+
+func matchEnvName(patterns []string, key string) bool {
+	for _, p := range patterns {
+		if strings.HasSuffix(p, "*") {
+			if strings.HasPrefix(key, strings.TrimSuffix(p, "*")) {
+				return true
+			}
+			continue
+		}
+
+		if p == key {
+			return true
+		}
+	}
+
+	return false
+}
+
+//shellEnv is sourced by sh, single quotes keep every byte of the value
+func shellEnv(vars []envVar) []byte {
+	buf := &bytes.Buffer{}
+
+	for _, v := range vars {
+		fmt.Fprintf(buf, "export %s=%s\n", v.key, shellQuote(v.value))
+	}
+
+	return buf.Bytes()
+}
+
+//systemdEnv is read by systemd EnvironmentFile=, in double quotes backslash
+//escapes \ " ` and $ and newlines are kept
+func systemdEnv(vars []envVar) []byte {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "`", "\\`", `$`, `\$`)
+	buf := &bytes.Buffer{}
+
+	for _, v := range vars {
+		fmt.Fprintf(buf, "%s=\"%s\"\n", v.key, r.Replace(v.value))
+	}
+
+	return buf.Bytes()
+}
+
+//etcEnvironment merges vars into the content of /etc/environment read by
+//pam_env, which has no escaping: values it cannot represent are skipped
+func etcEnvironment(opt *prehook.HookOptions, old []byte, vars []envVar) []byte {
+	keys := map[string]bool{}
+	lines := []string{}
+
+	for _, v := range vars {
+		if strings.ContainsAny(v.value, "\"\n") {
+			log.Infof("container %s, env %s is not persisted to %s: value can not be represented", opt.ID, v.key, etcEnvironmentFile)
+			continue
+		}
+
+		keys[v.key] = true
+		lines = append(lines, fmt.Sprintf("%s=\"%s\"", v.key, v.value))
+	}
+
+	//keep the image entries not overridden by the container
+	buf := &bytes.Buffer{}
+	scanner := bufio.NewScanner(bytes.NewReader(old))
+	for scanner.Scan() {
+		line := scanner.Text()
+		key := strings.TrimSpace(strings.SplitN(line, "=", 2)[0])
+		if keys[strings.TrimPrefix(key, "export ")] {
+			continue
+		}
+		buf.WriteString(line + "\n")
+	}
+
+	for _, line := range lines {
+		buf.WriteString(line + "\n")
+	}
+
+	return buf.Bytes()
+}
+
+//readRootfsFile reads the regular file path of rootfs, at most limit bytes.
+//The symlinks of the image are resolved in rootfs so that they cannot make
+//runc read a host file, and a fifo or device is refused instead of blocking
+func readRootfsFile(rootfs string, path string, limit int64) ([]byte, error) {
+	p, err := securejoin.SecureJoin(rootfs, path)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(p, os.O_RDONLY|syscall.O_NOFOLLOW|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	if !fi.Mode().IsRegular() {
+		return nil, fmt.Errorf("%s in rootfs is not a regular file", path)
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(f, limit+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("%s in rootfs is larger than %d bytes", path, limit)
+	}
+
+	return data, nil
+}
+
+func commonHook(opt *prehook.HookOptions, spec *specs.Spec, config *Config) error {
+	//persistent env to /etc/profile.d/pouchenv.sh, /etc/environment and the
+	//systemd EnvironmentFile
+	rootfs := opt.RootfsDir
+	j := journalFor(opt)
+	vars := persistentEnv(opt, spec, config)
+
+	//mkdir $roofs/etc/profile.d/
+	err := j.mkdirAll(filepath.Join(rootfs, persistentEnvShDir), 0755)
+	if err != nil {
+		return err
+	}
+
+	err = j.writeFile(filepath.Join(rootfs, persistentEnvShFile), shellEnv(vars), 0644)
+	if err != nil {
+		return err
+	}
+
+	err = j.mkdirAll(filepath.Join(rootfs, filepath.Dir(systemdEnvFile)), 0755)
+	if err != nil {
+		return err
+	}
+
+	err = j.writeFile(filepath.Join(rootfs, systemdEnvFile), systemdEnv(vars), 0644)
+	if err != nil {
+		return err
+	}
+
+	old, err := readRootfsFile(rootfs, etcEnvironmentFile, maxEtcEnvironmentSize)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return j.writeFile(filepath.Join(rootfs, etcEnvironmentFile), etcEnvironment(opt, old, vars), 0644)
+}
@@ -0,0 +1,164 @@
+package richcontainer
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"syscall"
+	"testing"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+
+	"github.com/opencontainers/runc/prehook"
+)
+
+var trickyEnv = []string{
+	"PLAIN=value",
+	"EQUALS=a=b=c",
+	`QUOTES=it's "quoted"`,
+	"DOLLAR=$HOME and `date`",
+	"NEWLINE=line1\nline2",
+	"EMPTY=",
+}
+
+func TestPersistentEnvPolicy(t *testing.T) {
+	opt := &prehook.HookOptions{ID: "env-test"}
+	spec := &specs.Spec{Process: &specs.Process{Env: []string{
+		"A=1", "NOEQUALS", "bad.name=x", "PWD=/", "SECRET_TOKEN=x", "A=2",
+	}}}
+	config := &Config{EnvExclude: []string{"SECRET_*"}}
+
+	vars := persistentEnv(opt, spec, config)
+	if !reflect.DeepEqual(vars, []envVar{{key: "A", value: "2"}}) {
+		t.Fatalf("unexpected persisted env %v", vars)
+	}
+}
+
+func TestShellEnvRoundTrip(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not found")
+	}
+
+	opt := &prehook.HookOptions{ID: "env-test"}
+	vars := persistentEnv(opt, &specs.Spec{Process: &specs.Process{Env: trickyEnv}}, &Config{})
+	if len(vars) != len(trickyEnv) {
+		t.Fatalf("expected all env to be persisted, got %v", vars)
+	}
+
+	f, err := ioutil.TempFile("", "pouchenv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.Write(shellEnv(vars))
+	f.Close()
+
+	for _, v := range vars {
+		out, err := exec.Command("sh", "-c", `. "$0" && printf %s "$`+v.key+`"`, f.Name()).Output()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(out) != v.value {
+			t.Fatalf("env %s: expected %q, got %q", v.key, v.value, out)
+		}
+	}
+}
+
+func TestSystemdEnv(t *testing.T) {
+	vars := []envVar{{key: "A", value: `say "hi" $USER \o/`}, {key: "B", value: "x\ny"}}
+	expected := "A=\"say \\\"hi\\\" \\$USER \\\\o/\"\nB=\"x\ny\"\n"
+	if out := string(systemdEnv(vars)); out != expected {
+		t.Fatalf("expected %q, got %q", expected, out)
+	}
+}
+
+func TestEtcEnvironmentMerge(t *testing.T) {
+	opt := &prehook.HookOptions{ID: "env-test"}
+	old := []byte("PATH=\"/usr/bin\"\nLANG=C\n")
+	vars := []envVar{{key: "PATH", value: "/bin"}, {key: "MULTI", value: "a\nb"}, {key: "X", value: "1"}}
+
+	expected := "LANG=C\nPATH=\"/bin\"\nX=\"1\"\n"
+	if out := string(etcEnvironment(opt, old, vars)); out != expected {
+		t.Fatalf("expected %q, got %q", expected, out)
+	}
+}
+
+func TestCommonHookFileModes(t *testing.T) {
+	rootfs := newTestRootfs(t)
+	defer os.RemoveAll(rootfs)
+
+	opt := &prehook.HookOptions{RootfsDir: rootfs, ID: "env-mode-test"}
+	defer releaseJournal(opt.ID)
+	spec := &specs.Spec{Process: &specs.Process{Env: []string{"A=1"}}}
+
+	if err := commonHook(opt, spec, &Config{}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{persistentEnvShFile, etcEnvironmentFile, systemdEnvFile} {
+		fi, err := os.Stat(filepath.Join(rootfs, path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fi.Mode() != 0644 {
+			t.Fatalf("expected %s mode 0644, got %v", path, fi.Mode())
+		}
+	}
+}
+
+func TestReadRootfsFile(t *testing.T) {
+	rootfs := newTestRootfs(t)
+	defer os.RemoveAll(rootfs)
+
+	host, err := ioutil.TempDir("", "host")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(host)
+	secret := filepath.Join(host, "shadow")
+	if err := ioutil.WriteFile(secret, []byte("SECRET=1\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	//an absolute symlink of the image points into rootfs, not to the host
+	if err := os.MkdirAll(filepath.Join(rootfs, "etc"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(secret, filepath.Join(rootfs, etcEnvironmentFile)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readRootfsFile(rootfs, etcEnvironmentFile, maxEtcEnvironmentSize); !os.IsNotExist(err) {
+		t.Fatalf("expected the host file not to be read, got %v", err)
+	}
+
+	opt := &prehook.HookOptions{RootfsDir: rootfs, ID: "env-symlink-test", StagingDir: filepath.Join(host, "staging")}
+	defer releaseJournal(opt.ID)
+	spec := &specs.Spec{Process: &specs.Process{Env: []string{"A=1"}}}
+	if err := commonHook(opt, spec, &Config{}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(opt.StagingDir, "richcontainer", "rootfs", etcEnvironmentFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "A=\"1\"\n" {
+		t.Fatalf("unexpected staged %s %q", etcEnvironmentFile, data)
+	}
+
+	fifo := filepath.Join(rootfs, "fifo")
+	if err := syscall.Mkfifo(fifo, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readRootfsFile(rootfs, "/fifo", 16); err == nil {
+		t.Fatal("expected a fifo to be refused")
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(rootfs, "big"), make([]byte, 17), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readRootfsFile(rootfs, "/big", 16); err == nil {
+		t.Fatal("expected a file over the limit to be refused")
+	}
+}
@@ -0,0 +1,354 @@
+package richcontainer
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	systemdDbus "github.com/coreos/go-systemd/dbus"
+	"github.com/godbus/dbus"
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"golang.org/x/sys/unix"
+
+	"github.com/opencontainers/runc/libcontainer/utils"
+)
+
+//the launchers record in an annotation how runc checks the main service of
+//the container, the value is one of
+//  systemd:<main unit>  the unit is checked through systemd private bus
+//  pidfile:<path>       the process of the pid file in container is checked
+//  child                the child of the container init is checked
+
+const (
+	healthCheckSystemd = "systemd"
+	healthCheckPidFile = "pidfile"
+	healthCheckChild   = "child"
+
+	systemdPrivateSocket = "/run/systemd/private"
+	systemdCallTimeout   = 2 * time.Second
+
+	//a pid file holds a pid and a newline
+	maxPidFileSize = 32
+)
+
+//status of the main service of a rich container
+const (
+	HealthStarting = "starting"
+	HealthReady    = "ready"
+	//the main service is up but other units failed
+	HealthDegraded = "degraded"
+	HealthFailed   = "failed"
+	HealthExited   = "exited"
+	HealthUnknown  = "unknown"
+)
+
+//Health is the state of the main service of a rich container
+type Health struct {
+	Status      string `json:"status"`
+	MainService string `json:"mainService,omitempty"`
+	//failed systemd units
+	FailedUnits []string `json:"failedUnits,omitempty"`
+	Message     string   `json:"message,omitempty"`
+}
+
+func setHealthCheck(spec *specs.Spec, check string, arg string) {
+	if spec.Annotations == nil {
+		spec.Annotations = map[string]string{}
+	}
+
+	if arg != "" {
+		check += ":" + arg
+	}
+
+	spec.Annotations[annotationHealthCheck] = check
+}
+
+//CheckHealth checks the main service of a running rich container, pid is
+//the host pid of the container init and pids lists the host pids of the
+//container processes; nil is returned if the container is not a rich
+//container checked by runc
+func CheckHealth(annotations map[string]string, pid int, pids func() ([]int, error)) *Health {
+	check, ok := annotations[annotationHealthCheck]
+	if !ok {
+		return nil
+	}
+
+	kv := strings.SplitN(check, ":", 2)
+	arg := ""
+	if len(kv) == 2 {
+		arg = kv[1]
+	}
+
+	var (
+		health *Health
+		err    error
+	)
+
+	switch kv[0] {
+	case healthCheckSystemd:
+		health, err = checkSystemd(pid, arg)
+	case healthCheckPidFile:
+		health, err = checkPidFile(pid, pids, arg)
+	case healthCheckChild:
+		health, err = checkChild(pid)
+	default:
+		err = fmt.Errorf("unknown health check %q", check)
+	}
+
+	if err != nil {
+		return &Health{Status: HealthUnknown, MainService: arg, Message: err.Error()}
+	}
+
+	return health
+}
+
+//checkSystemd asks the systemd of the container through its private socket,
+//every call fails once systemdCallTimeout has passed so that a stuck systemd
+//does not block runc
+func checkSystemd(pid int, unit string) (*Health, error) {
+	return checkSystemdSocket(pid, systemdPrivateSocket, unit)
+}
+
+func checkSystemdSocket(pid int, path string, unit string) (*Health, error) {
+	socket, err := openContainerSocket(pid, path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &Health{Status: HealthStarting, MainService: unit}, nil
+		}
+		return nil, err
+	}
+	defer socket.Close()
+
+	deadline := time.Now().Add(systemdCallTimeout)
+	conn, err := systemdDbus.NewConnection(func() (*dbus.Conn, error) {
+		//the socket is reached through its fd, its path is controlled by
+		//the container
+		dialer := net.Dialer{Deadline: deadline}
+		netConn, err := dialer.Dial("unix", fmt.Sprintf("/proc/self/fd/%d", socket.Fd()))
+		if err != nil {
+			return nil, err
+		}
+		if err := netConn.SetDeadline(deadline); err != nil {
+			netConn.Close()
+			return nil, err
+		}
+
+		conn, err := dbus.NewConn(netConn)
+		if err != nil {
+			netConn.Close()
+			return nil, err
+		}
+
+		//no Hello on systemd private bus
+		if err := conn.Auth([]dbus.Auth{dbus.AuthExternal(strconv.Itoa(os.Getuid()))}); err != nil {
+			conn.Close()
+			return nil, err
+		}
+
+		return conn, nil
+	})
+	if err != nil {
+		return nil, timeoutError(err)
+	}
+	defer conn.Close()
+
+	health, err := querySystemd(conn, unit)
+	if err != nil {
+		return nil, timeoutError(err)
+	}
+
+	return health, nil
+}
+
+//timeoutError reports the calls that failed on the deadline of the connection
+func timeoutError(err error) error {
+	if e, ok := err.(net.Error); ok && e.Timeout() {
+		return fmt.Errorf("systemd of container did not answer in %s", systemdCallTimeout)
+	}
+	return err
+}
+
+//openContainerSocket opens the socket path in the root of process pid with
+//O_PATH, no symlink in path is followed
+func openContainerSocket(pid int, path string) (*os.File, error) {
+	dir, err := utils.OpenDirNoFollow(filepath.Join("/proc", strconv.Itoa(pid), "root"), filepath.Dir(path), false, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer dir.Close()
+
+	fd, err := unix.Openat(int(dir.Fd()), filepath.Base(path), unix.O_PATH|unix.O_NOFOLLOW|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, &os.PathError{Op: "openat", Path: path, Err: err}
+	}
+	socket := os.NewFile(uintptr(fd), path)
+
+	var stat unix.Stat_t
+	if err := unix.Fstat(fd, &stat); err != nil {
+		socket.Close()
+		return nil, err
+	}
+	if stat.Mode&unix.S_IFMT != unix.S_IFSOCK {
+		socket.Close()
+		return nil, fmt.Errorf("%s of container is not a socket", path)
+	}
+
+	return socket, nil
+}
+
+func querySystemd(conn *systemdDbus.Conn, unit string) (*Health, error) {
+	health := &Health{MainService: unit}
+
+	failed, err := conn.ListUnitsFiltered([]string{"failed"})
+	if err != nil {
+		return nil, err
+	}
+	for _, u := range failed {
+		health.FailedUnits = append(health.FailedUnits, u.Name)
+	}
+
+	prop, err := conn.GetUnitProperty(unit, "ActiveState")
+	if err != nil {
+		return nil, err
+	}
+	state, _ := prop.Value.Value().(string)
+
+	switch state {
+	case "active", "reloading":
+		health.Status = HealthReady
+		if len(health.FailedUnits) > 0 {
+			health.Status = HealthDegraded
+		}
+	case "failed":
+		health.Status = HealthFailed
+	case "inactive", "activating":
+		health.Status = HealthStarting
+	default:
+		health.Status = HealthUnknown
+		health.Message = fmt.Sprintf("unit %s is %s", unit, state)
+	}
+
+	return health, nil
+}
+
+//checkPidFile looks for the process of the pid file among the container processes
+func checkPidFile(pid int, pids func() ([]int, error), pidFile string) (*Health, error) {
+	//the pid file is opened in the container root, without following a
+	//final symlink or blocking on a fifo, and only a pid is read
+	data, err := readRootfsFile(filepath.Join("/proc", strconv.Itoa(pid), "root"), pidFile, maxPidFileSize)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &Health{Status: HealthStarting, MainService: pidFile}, nil
+		}
+		return nil, err
+	}
+
+	//the content is not reported, the file is written by the container
+	servicePid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid pid file %s", pidFile)
+	}
+
+	hostPids, err := pids()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, p := range hostPids {
+		nsPid, err := namespacePid(p)
+		if err != nil {
+			continue
+		}
+
+		if nsPid == servicePid {
+			return processHealth(p, pidFile)
+		}
+	}
+
+	return &Health{Status: HealthExited, MainService: pidFile}, nil
+}
+
+//checkChild checks the first child of the container init
+func checkChild(pid int) (*Health, error) {
+	data, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/task/%d/children", pid, pid))
+	if err != nil {
+		return nil, err
+	}
+
+	children := strings.Fields(string(data))
+	if len(children) == 0 {
+		return &Health{Status: HealthExited}, nil
+	}
+
+	child, err := strconv.Atoi(children[0])
+	if err != nil {
+		return nil, err
+	}
+
+	return processHealth(child, "")
+}
+
+func processHealth(pid int, service string) (*Health, error) {
+	state, err := processState(pid)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &Health{Status: HealthExited, MainService: service}, nil
+		}
+		return nil, err
+	}
+
+	if state == "Z" || state == "X" {
+		return &Health{Status: HealthExited, MainService: service}, nil
+	}
+
+	return &Health{Status: HealthReady, MainService: service}, nil
+}
+
+//processState returns the state field of /proc/pid/stat
+func processState(pid int) (string, error) {
+	data, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return "", err
+	}
+
+	//comm may contain spaces, the state follows its closing parenthesis
+	i := strings.LastIndex(string(data), ")")
+	if i < 0 {
+		return "", fmt.Errorf("invalid stat of process %d", pid)
+	}
+
+	fields := strings.Fields(string(data[i+1:]))
+	if len(fields) == 0 {
+		return "", fmt.Errorf("invalid stat of process %d", pid)
+	}
+
+	return fields[0], nil
+}
+
+//namespacePid returns the pid of host process pid in its pid namespace
+func namespacePid(pid int) (int, error) {
+	data, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/status", pid))
+	if err != nil {
+		return 0, err
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		if !strings.HasPrefix(line, "NSpid:") {
+			continue
+		}
+
+		fields := strings.Fields(strings.TrimPrefix(line, "NSpid:"))
+		if len(fields) == 0 {
+			break
+		}
+
+		return strconv.Atoi(fields[len(fields)-1])
+	}
+
+	return 0, fmt.Errorf("no NSpid in status of process %d", pid)
+}
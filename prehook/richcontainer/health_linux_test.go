@@ -0,0 +1,139 @@
+package richcontainer
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestCheckHealthPidFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "richcontainer-health")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	//the test process is both the container init and the main service
+	pid := os.Getpid()
+	pids := func() ([]int, error) {
+		return []int{pid}, nil
+	}
+	pidFile := filepath.Join(dir, "service.pid")
+	annotations := map[string]string{annotationHealthCheck: healthCheckPidFile + ":" + pidFile}
+
+	if h := CheckHealth(map[string]string{}, pid, pids); h != nil {
+		t.Fatalf("expected no health without annotation, got %+v", h)
+	}
+
+	if h := CheckHealth(annotations, pid, pids); h.Status != HealthStarting {
+		t.Fatalf("expected %s without pid file, got %+v", HealthStarting, h)
+	}
+
+	if err := ioutil.WriteFile(pidFile, []byte(fmt.Sprintf("%d\n", pid)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if h := CheckHealth(annotations, pid, pids); h.Status != HealthReady || h.MainService != pidFile {
+		t.Fatalf("expected %s, got %+v", HealthReady, h)
+	}
+
+	if err := ioutil.WriteFile(pidFile, []byte("-1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if h := CheckHealth(annotations, pid, pids); h.Status != HealthExited {
+		t.Fatalf("expected %s, got %+v", HealthExited, h)
+	}
+
+	//a pid file that is not a small regular file is not read
+	if err := ioutil.WriteFile(pidFile, []byte(strings.Repeat("1", maxPidFileSize+1)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if h := CheckHealth(annotations, pid, pids); h.Status != HealthUnknown || h.Message == "" {
+		t.Fatalf("expected %s for an oversized pid file, got %+v", HealthUnknown, h)
+	}
+
+	if err := os.Remove(pidFile); err != nil {
+		t.Fatal(err)
+	}
+	if err := syscall.Mkfifo(pidFile, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if h := CheckHealth(annotations, pid, pids); h.Status != HealthUnknown || h.Message == "" {
+		t.Fatalf("expected %s for a fifo pid file, got %+v", HealthUnknown, h)
+	}
+
+	annotations[annotationHealthCheck] = "unknown"
+	if h := CheckHealth(annotations, pid, pids); h.Status != HealthUnknown || h.Message == "" {
+		t.Fatalf("expected %s with message, got %+v", HealthUnknown, h)
+	}
+}
+
+func TestCheckSystemdTimeout(t *testing.T) {
+	dir, err := ioutil.TempDir("", "richcontainer-health")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	//a systemd that never answers
+	socket := filepath.Join(dir, "private")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	start := time.Now()
+	_, err = checkSystemdSocket(os.Getpid(), socket, "main.service")
+	if err == nil || !strings.Contains(err.Error(), "did not answer") {
+		t.Fatalf("expected a timeout error, got %v", err)
+	}
+	if time.Since(start) > 2*systemdCallTimeout {
+		t.Fatalf("check took %s", time.Since(start))
+	}
+}
+
+func TestCheckSystemdSymlinkedSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "richcontainer-health")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := os.Mkdir(filepath.Join(dir, "real"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	l, err := net.Listen("unix", filepath.Join(dir, "real", "private"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if err := os.Symlink("real", filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, socket := range []string{filepath.Join(dir, "link", "private"), filepath.Join(dir, "real", "link")} {
+		if socket == filepath.Join(dir, "real", "link") {
+			if err := os.Symlink("private", socket); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := checkSystemdSocket(os.Getpid(), socket, "main.service"); err == nil {
+			t.Fatalf("expected an error for the socket %s reached through a symlink", socket)
+		}
+	}
+}
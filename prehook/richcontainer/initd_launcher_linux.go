@@ -1,11 +1,11 @@
 package richcontainer
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
 
@@ -18,7 +18,8 @@ const (
 	initdLauncherName = "sbin-init"
 	initBinPath       = "/sbin/init"
 
-	defaultInitScriptPath = "/etc/rc.d/init.d/richContainer"
+	initScriptDir         = "/etc/rc.d/init.d"
+	rcDir                 = "/etc/rc.d"
 	defaultInitScriptName = "richContainer"
 )
 
@@ -33,7 +34,11 @@ func (l *initdLauncher) Name() string {
 	return initdLauncherName
 }
 
-func (l *initdLauncher) Launch(opt *prehook.HookOptions, spec *specs.Spec) error {
+func (l *initdLauncher) SupportServices() bool {
+	return true
+}
+
+func (l *initdLauncher) Launch(opt *prehook.HookOptions, spec *specs.Spec, config *Config) error {
 	rootfs := opt.RootfsDir
 
 	//check has /sbin/init
@@ -43,26 +48,62 @@ func (l *initdLauncher) Launch(opt *prehook.HookOptions, spec *specs.Spec) error
 		return err
 	}
 
-	//cmd := spec.Process.Args
-	//config := &initScriptConfig{
-	//	startCmd: strings.Join(cmd, " "),
-	//}
-	//
-	//err = l.writeScript(filepath.Join(rootfs, defaultInitScriptPath), config)
-	//if err != nil{
-	//	return err
-	//}
-	//
-	//err = l.setRcLevel(filepath.Join(rootfs, "/etc/rc.d"))
-	//if err != nil {
-	//	return err
-	//}
-	//
-	//spec.Process.Args = []string {initBinPath}
-
-	//call systemd launch
-	systedLauncher := &systemdLauncher{}
-	err = systedLauncher.Launch(opt, spec)
+	//call systemd launch if /sbin/init is systemd
+	_, err = os.Stat(filepath.Join(rootfs, systemdBinRootfsPath))
+	if err == nil {
+		systedLauncher := &systemdLauncher{}
+		err = systedLauncher.Launch(opt, spec, config)
+		if err != nil {
+			return err
+		}
+
+		spec.Process.Args = []string{initBinPath}
+
+		return nil
+	}
+
+	if !os.IsNotExist(err) {
+		return err
+	}
+
+	//sysv init
+	if len(spec.Process.Args) == 0 {
+		return errors.New("no cmd set in process of container runtime spec")
+	}
+
+	services, err := containerServices(config, spec)
+	if err != nil {
+		return err
+	}
+
+	j := journalFor(opt)
+	scriptNames := []string{}
+
+	for _, service := range services {
+		if service.Restart != "" && service.Restart != RestartNo {
+			log.Warnf("container %s, restart policy %s of service %s is not supported by sysv init", opt.ID, service.Restart, service.Name)
+		}
+
+		scriptConfig := &initScriptConfig{
+			service: service,
+		}
+		if service.Main {
+			scriptConfig.initScript = config.InitScript
+		}
+
+		name := initScriptName(service.Name)
+		if service.Main {
+			setHealthCheck(spec, healthCheckPidFile, initScriptPidFile(name))
+		}
+		err = l.writeScript(j, filepath.Join(rootfs, initScriptDir, name), scriptConfig)
+		if err != nil {
+			return err
+		}
+
+		scriptNames = append(scriptNames, name)
+	}
+
+	err = l.setRcLevel(j, filepath.Join(rootfs, rcDir), scriptNames)
 	if err != nil {
 		return err
 	}
@@ -72,30 +113,69 @@ func (l *initdLauncher) Launch(opt *prehook.HookOptions, spec *specs.Spec) error
 	return nil
 }
 
+//initScriptName returns the init script name of a rich container service
+func initScriptName(service string) string {
+	if service == mainServiceName {
+		return defaultInitScriptName
+	}
+
+	return fmt.Sprintf("%s-%s", defaultInitScriptName, service)
+}
+
 type initScriptConfig struct {
-	startCmd string
+	service *Service
+	//script run before the service starts
+	initScript string
 }
 
-const scriptDescription = `
-#!/bin/sh
+//pid file of the init script of service name
+func initScriptPidFile(name string) string {
+	return fmt.Sprintf("/var/run/%s.pid", name)
+}
+
+const scriptDescription = `#!/bin/sh
 #****************************************************************#
-# ScriptName: richContainer.sh
+# ScriptName: $name
 # Author: Pouch
 # Create Date: 2018-1-29
 # Modify Author:
 # Modify Date: 2018-1-29
 # Function: Rich Container Init Script
 #***************************************************************#
+### BEGIN INIT INFO
+# Provides:          $name
+# Required-Start:$deps
+# Required-Stop:$deps
+# Default-Start:     2 3 4 5
+# Default-Stop:      0 1 6
+# Short-Description: rich container service $service
+### END INIT INFO
+
+PIDFILE=/var/run/$name.pid
 `
 
 const scriptStartCmd = `
 start () {
-	$start
+$start
+	echo $! > "$PIDFILE"
 }
 `
 const scriptStopCmd = `
 stop () {
-	echo "not set stop cmd"
+	[ -f "$PIDFILE" ] || return 0
+	kill $(cat "$PIDFILE")
+	rm -f "$PIDFILE"
+}
+`
+
+const scriptStatusCmd = `
+status () {
+	if [ -f "$PIDFILE" ] && kill -0 $(cat "$PIDFILE") 2>/dev/null; then
+		echo "running"
+		return 0
+	fi
+	echo "stopped"
+	return 3
 }
 `
 
@@ -108,7 +188,7 @@ case "$1" in
 		stop
         ;;
   status)
-        echo "not set"
+		status
         ;;
   restart|reload)
         stop
@@ -123,35 +203,80 @@ esac
 exit $?
 `
 
-func (l *initdLauncher) writeScript(filePath string, config *initScriptConfig) error {
+//startCmd returns the body of the start function, the service is run in
+//background so that init goes on
+func (c *initScriptConfig) startCmd() string {
+	lines := []string{}
+
+	//container env persisted by the rich container hook
+	lines = append(lines, fmt.Sprintf("[ -f %s ] && . %s", persistentEnvShFile, persistentEnvShFile))
+
+	if c.service.Cwd != "" {
+		lines = append(lines, fmt.Sprintf("cd %s || return 1", shellQuote(c.service.Cwd)))
+	}
+
+	for _, env := range c.service.Env {
+		lines = append(lines, fmt.Sprintf("export %s", shellQuote(env)))
+	}
+
+	if c.initScript != "" {
+		lines = append(lines, fmt.Sprintf("%s || return 1", shellQuote(c.initScript)))
+	}
+
+	words := []string{}
+	for _, arg := range c.service.Args {
+		words = append(words, shellQuote(arg))
+	}
+	cmd := strings.Join(words, " ")
+
+	if c.service.User != "" {
+		cmd = fmt.Sprintf("su -s /bin/sh %s -c %s", shellQuote(c.service.User), shellQuote("exec "+cmd))
+	}
+
+	lines = append(lines, fmt.Sprintf("%s > /dev/null 2>&1 &", cmd))
+
+	return "\t" + strings.Join(lines, "\n\t")
+}
+
+func (l *initdLauncher) writeScript(j *rootfsJournal, filePath string, config *initScriptConfig) error {
 	dir := filepath.Dir(filePath)
 
-	err := os.MkdirAll(dir, 0x755)
+	err := j.mkdirAll(dir, 0755)
 	if err != nil {
 		return err
 	}
 
-	f, err := os.OpenFile(filePath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0x755)
-	if err != nil {
-		return err
+	deps := ""
+	for _, dep := range config.service.DependsOn {
+		deps += " " + initScriptName(dep)
+	}
+	if deps != "" {
+		//align with the other header values
+		deps = "   " + deps
 	}
 
-	defer f.Close()
+	f := &bytes.Buffer{}
 
 	//write script
-	f.WriteString(scriptDescription)
-
-	startCmd := strings.Replace(scriptStartCmd, "$start", config.startCmd, -1)
+	header := strings.NewReplacer(
+		"$name", filepath.Base(filePath),
+		"$deps", deps,
+		"$service", config.service.Name,
+	).Replace(scriptDescription)
+	f.WriteString(header)
+
+	startCmd := strings.Replace(scriptStartCmd, "$start", config.startCmd(), -1)
 	f.WriteString(startCmd)
 
 	f.WriteString(scriptStopCmd)
+	f.WriteString(scriptStatusCmd)
 	f.WriteString(scriptC)
 
-	return nil
+	return j.writeFile(filePath, f.Bytes(), 0755)
 }
 
-//set runlevel 2-5 auto start
-func (l *initdLauncher) setRcLevel(rcDir string) error {
+//set runlevel 2-5 auto start, scripts are started in the given order
+func (l *initdLauncher) setRcLevel(j *rootfsJournal, rcDir string, scriptNames []string) error {
 	var (
 		startIndex int = 60
 		endIndex   int = 99
@@ -160,13 +285,6 @@ func (l *initdLauncher) setRcLevel(rcDir string) error {
 		rcEnd   int = 5
 	)
 
-	currentDir, err := os.Getwd()
-	if err != nil {
-		return err
-	}
-
-	defer os.Chdir(currentDir)
-
 	for i := rcStart; i <= rcEnd; i++ {
 		dir := filepath.Join(rcDir, fmt.Sprintf("rc%d.d", i))
 		fInfos, err := ioutil.ReadDir(dir)
@@ -182,27 +300,28 @@ func (l *initdLauncher) setRcLevel(rcDir string) error {
 			}
 		}
 
-		activeIndex, err := l.getActiveIndex(names, startIndex, endIndex)
-		if err != nil {
-			return err
-		}
+		index := startIndex
 
-		if activeIndex < 0 {
-			continue
-		}
+		for _, scriptName := range scriptNames {
+			activeIndex, err := l.getActiveIndex(names, scriptName, index, endIndex)
+			if err != nil {
+				return err
+			}
 
-		//create link to /etc/rc.d/init.d/richContainer
-		err = os.Chdir(dir)
-		if err != nil {
-			return err
-		}
+			if activeIndex < 0 {
+				continue
+			}
 
-		//create link
-		err = exec.Command("ln", "-s", fmt.Sprintf("../init.d/%s", defaultInitScriptName),
-			fmt.Sprintf("S%d%s", activeIndex, defaultInitScriptName)).Run()
+			//create link to /etc/rc.d/init.d/<script>
+			link := fmt.Sprintf("S%d%s", activeIndex, scriptName)
+			err = j.symlink(fmt.Sprintf("../init.d/%s", scriptName), filepath.Join(dir, link))
+			if err != nil {
+				return err
+			}
 
-		if err != nil {
-			return err
+			names = append(names, link)
+			//later scripts start after this one
+			index = activeIndex + 1
 		}
 	}
 
@@ -211,9 +330,9 @@ func (l *initdLauncher) setRcLevel(rcDir string) error {
 
 //the function is to find active index in boot init, if return -1, means need not to set
 //it has some bugs if index is in (0,9) and names has (1,9)x prefix, but the start index is more than 50
-func (l *initdLauncher) getActiveIndex(names []string, startIndex int, endIndex int) (int, error) {
+func (l *initdLauncher) getActiveIndex(names []string, scriptName string, startIndex int, endIndex int) (int, error) {
 	for _, name := range names {
-		if strings.HasSuffix(name, defaultInitScriptName) && strings.HasPrefix(name, "S") {
+		if strings.HasPrefix(name, "S") && strings.TrimLeft(name[1:], "0123456789") == scriptName {
 			return -1, nil
 		}
 	}
@@ -0,0 +1,562 @@
+package richcontainer
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/cyphar/filepath-securejoin"
+	"github.com/opencontainers/runtime-spec/specs-go"
+
+	"github.com/opencontainers/runc/prehook"
+)
+
+//rootfsJournal records the rootfs changes made by the rich container hook so
+//that they can be rolled back if a later prehook fails, in dry run mode it
+//only records the intended writes to the hook options.
+//
+//If the hook options have a staging dir, the rootfs is not written: the
+//changes go to a shadow tree of the rootfs in the staging dir and mount
+//adds the mounts exposing them in the container.
+//
+//The paths are resolved in rootfs, a symlink of the image cannot make the
+//hook write to the host
+type rootfsJournal struct {
+	opt     *prehook.HookOptions
+	entries []*journalEntry
+	//container paths written to the shadow tree
+	staged []stagedPath
+	//staging dir has been created by the journal
+	prepared bool
+}
+
+type stagedPath struct {
+	path string
+	//file, directory or symlink as in prehook.RootfsWrite
+	typ string
+}
+
+type journalEntry struct {
+	path string
+	//path did not exist before the change, remove it on rollback
+	created bool
+	mode    os.FileMode
+	data    []byte
+	link    string
+}
+
+var (
+	journals     = map[string]*rootfsJournal{}
+	journalMutex = &sync.Mutex{}
+)
+
+//journalFor returns the journal of the container, creating it if needed
+func journalFor(opt *prehook.HookOptions) *rootfsJournal {
+	journalMutex.Lock()
+	defer journalMutex.Unlock()
+
+	j, ok := journals[opt.ID]
+	if !ok {
+		j = &rootfsJournal{opt: opt}
+		journals[opt.ID] = j
+	}
+
+	return j
+}
+
+//releaseJournal drops the journal of container id and returns it, nil if not found
+func releaseJournal(id string) *rootfsJournal {
+	journalMutex.Lock()
+	defer journalMutex.Unlock()
+
+	j := journals[id]
+	delete(journals, id)
+
+	return j
+}
+
+//track saves the state of path before it is changed, must be called before
+//creating, overwriting or removing path
+func (j *rootfsJournal) track(path string) error {
+	fi, err := os.Lstat(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return err
+		}
+
+		j.entries = append(j.entries, &journalEntry{path: path, created: true})
+		return nil
+	}
+
+	entry := &journalEntry{path: path, mode: fi.Mode()}
+
+	switch {
+	case fi.Mode()&os.ModeSymlink != 0:
+		if entry.link, err = os.Readlink(path); err != nil {
+			return err
+		}
+	case fi.Mode().IsRegular():
+		if entry.data, err = ioutil.ReadFile(path); err != nil {
+			return err
+		}
+	default:
+		//directories and special files are left as they are
+		return nil
+	}
+
+	j.entries = append(j.entries, entry)
+	return nil
+}
+
+//resolve resolves the symlinks of the parents of the rootfs path in rootfs,
+//the last component is kept as it is replaced
+func (j *rootfsJournal) resolve(path string) (string, error) {
+	rel := j.containerPath(path)
+
+	dir, err := securejoin.SecureJoin(j.opt.RootfsDir, filepath.Dir(rel))
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, filepath.Base(rel)), nil
+}
+
+//mkdirAll is os.MkdirAll recording the directories it creates
+func (j *rootfsJournal) mkdirAll(path string, perm os.FileMode) error {
+	path, err := securejoin.SecureJoin(j.opt.RootfsDir, j.containerPath(path))
+	if err != nil {
+		return err
+	}
+
+	missing := []string{}
+
+	for p := filepath.Clean(path); ; p = filepath.Dir(p) {
+		_, err := os.Lstat(p)
+		if err == nil {
+			break
+		}
+
+		if !os.IsNotExist(err) {
+			return err
+		}
+
+		missing = append(missing, p)
+
+		if p == filepath.Dir(p) {
+			break
+		}
+	}
+
+	if len(missing) > 0 && j.staging() {
+		j.stage(missing[0], "directory")
+	}
+
+	for i := len(missing) - 1; i >= 0; i-- {
+		if j.opt.DryRun {
+			j.opt.RecordWrite(prehook.RootfsWrite{Path: missing[i], Type: "directory", Mode: os.ModeDir | perm})
+			continue
+		}
+
+		if err := j.track(missing[i]); err != nil {
+			return err
+		}
+	}
+
+	if j.opt.DryRun {
+		return nil
+	}
+
+	if j.staging() {
+		if len(missing) == 0 {
+			return nil
+		}
+		return j.mkShadowDirs(path, perm)
+	}
+
+	return os.MkdirAll(path, perm)
+}
+
+//writeFile is ioutil.WriteFile recording the previous content of path
+func (j *rootfsJournal) writeFile(path string, data []byte, perm os.FileMode) error {
+	path, err := j.resolve(path)
+	if err != nil {
+		return err
+	}
+
+	if j.opt.DryRun {
+		j.opt.RecordWrite(prehook.RootfsWrite{Path: path, Type: "file", Mode: perm})
+		j.stage(path, "file")
+		return nil
+	}
+
+	if j.staging() {
+		shadowPath, err := j.shadowFor(path)
+		if err != nil {
+			return err
+		}
+		j.stage(path, "file")
+		path = shadowPath
+	} else {
+		if err := j.track(path); err != nil {
+			return err
+		}
+
+		//a symlink is replaced, not followed
+		if fi, err := os.Lstat(path); err == nil && fi.Mode()&os.ModeSymlink != 0 {
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := ioutil.WriteFile(path, data, perm); err != nil {
+		return err
+	}
+
+	//WriteFile honours umask, set the exact mode
+	return os.Chmod(path, perm)
+}
+
+//copyFile copies the host file src to path
+func (j *rootfsJournal) copyFile(src string, path string, perm os.FileMode) error {
+	if j.opt.DryRun {
+		return j.writeFile(path, nil, perm)
+	}
+
+	data, err := ioutil.ReadFile(src)
+	if err != nil {
+		return err
+	}
+
+	return j.writeFile(path, data, perm)
+}
+
+//symlink replaces newname with a symlink to oldname
+func (j *rootfsJournal) symlink(oldname string, newname string) error {
+	newname, err := j.resolve(newname)
+	if err != nil {
+		return err
+	}
+
+	if j.opt.DryRun {
+		j.opt.RecordWrite(prehook.RootfsWrite{Path: newname, Type: "symlink", Mode: os.ModeSymlink | 0777, Target: oldname})
+		j.stage(newname, "symlink")
+		return nil
+	}
+
+	if j.staging() {
+		shadowPath, err := j.shadowFor(newname)
+		if err != nil {
+			return err
+		}
+		j.stage(newname, "symlink")
+		newname = shadowPath
+	} else if err := j.track(newname); err != nil {
+		return err
+	}
+
+	if err := os.Remove(newname); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return os.Symlink(oldname, newname)
+}
+
+//rollback restores the tracked paths in reverse order, it goes on after a
+//failure and returns the first error
+func (j *rootfsJournal) rollback() error {
+	if j.staging() {
+		j.staged = nil
+		if !j.prepared {
+			return nil
+		}
+		j.prepared = false
+		return os.RemoveAll(j.stagingDir())
+	}
+
+	var firstErr error
+
+	for i := len(j.entries) - 1; i >= 0; i-- {
+		if err := j.entries[i].restore(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	j.entries = nil
+
+	return firstErr
+}
+
+func (e *journalEntry) restore() error {
+	if err := os.RemoveAll(e.path); err != nil {
+		return err
+	}
+
+	if e.created {
+		return nil
+	}
+
+	if e.mode&os.ModeSymlink != 0 {
+		return os.Symlink(e.link, e.path)
+	}
+
+	if err := ioutil.WriteFile(e.path, e.data, e.mode.Perm()); err != nil {
+		return err
+	}
+
+	//WriteFile honours umask, restore the exact mode
+	return os.Chmod(e.path, e.mode)
+}
+
+func (j *rootfsJournal) staging() bool {
+	return j.opt.StagingDir != ""
+}
+
+//stagingDir is the part of the container staging dir owned by the journal
+func (j *rootfsJournal) stagingDir() string {
+	return filepath.Join(j.opt.StagingDir, "richcontainer")
+}
+
+func (j *rootfsJournal) shadowRoot() string {
+	return filepath.Join(j.stagingDir(), "rootfs")
+}
+
+//containerPath converts the host path of a rootfs file to its path in container
+func (j *rootfsJournal) containerPath(path string) string {
+	rel, err := filepath.Rel(j.opt.RootfsDir, path)
+	if err != nil {
+		return path
+	}
+
+	return filepath.Join("/", rel)
+}
+
+func (j *rootfsJournal) stage(path string, typ string) {
+	if !j.staging() {
+		return
+	}
+
+	path = j.containerPath(path)
+	for _, s := range j.staged {
+		if s.path == path {
+			return
+		}
+	}
+
+	j.staged = append(j.staged, stagedPath{path: path, typ: typ})
+}
+
+//shadowFor returns the shadow tree path of the rootfs file path, creating its
+//parent directories
+func (j *rootfsJournal) shadowFor(path string) (string, error) {
+	if err := j.mkShadowDirs(filepath.Dir(path), 0755); err != nil {
+		return "", err
+	}
+
+	shadowPath := filepath.Join(j.shadowRoot(), j.containerPath(path))
+	if err := os.Remove(shadowPath); err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+
+	return shadowPath, nil
+}
+
+//mkShadowDirs creates the shadow tree directories of the rootfs dir path, a
+//directory existing in rootfs is created with the same mode and owner as it
+//shows when it is mounted for a symlink
+func (j *rootfsJournal) mkShadowDirs(path string, perm os.FileMode) error {
+	if !j.prepared {
+		//the files staged for a container with the same id are in use
+		if _, err := os.Lstat(j.stagingDir()); err == nil {
+			return fmt.Errorf("staging dir %s exists, container %s may exist", j.stagingDir(), j.opt.ID)
+		} else if !os.IsNotExist(err) {
+			return err
+		}
+
+		if err := os.MkdirAll(j.shadowRoot(), 0700); err != nil {
+			return err
+		}
+		j.prepared = true
+	}
+
+	p := j.shadowRoot()
+	for _, name := range strings.Split(strings.TrimPrefix(j.containerPath(path), "/"), "/") {
+		if name == "" {
+			continue
+		}
+		p = filepath.Join(p, name)
+
+		if _, err := os.Lstat(p); err == nil {
+			continue
+		} else if !os.IsNotExist(err) {
+			return err
+		}
+
+		mode := perm
+		uid, gid := -1, -1
+
+		fi, err := os.Lstat(filepath.Join(j.opt.RootfsDir, strings.TrimPrefix(p, j.shadowRoot())))
+		if err == nil && fi.IsDir() {
+			mode = fi.Mode().Perm()
+			if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+				uid, gid = int(st.Uid), int(st.Gid)
+			}
+		}
+
+		if err := os.Mkdir(p, mode); err != nil {
+			return err
+		}
+
+		//Mkdir honours umask, set the exact mode
+		if err := os.Chmod(p, mode); err != nil {
+			return err
+		}
+
+		if err := os.Lchown(p, uid, gid); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//mountTarget returns the path to bind mount on for the staged path: its
+//topmost parent missing in rootfs, created by runc as mountpoint. Otherwise a
+//file is mounted on itself, and a symlink, which cannot be bind mounted, with
+//its parent directory
+func (j *rootfsJournal) mountTarget(s stagedPath) (string, error) {
+	target := s.path
+	if s.typ == "symlink" {
+		target = filepath.Dir(s.path)
+	}
+
+	for p := filepath.Dir(s.path); p != "/"; p = filepath.Dir(p) {
+		fi, err := os.Lstat(filepath.Join(j.opt.RootfsDir, p))
+		if err != nil {
+			if os.IsNotExist(err) {
+				target = p
+				continue
+			}
+			return "", err
+		}
+
+		//the parents are resolved when staged
+		if !fi.IsDir() {
+			return "", fmt.Errorf("cannot inject %s into rootfs: %s is not a directory", s.path, p)
+		}
+	}
+
+	return target, nil
+}
+
+//copyDirEntries copies the entries of the rootfs dir missing in the shadow
+//tree, so that a directory mounted for a symlink keeps them
+func (j *rootfsJournal) copyDirEntries(dir string) error {
+	src := filepath.Join(j.opt.RootfsDir, dir)
+	dst := filepath.Join(j.shadowRoot(), dir)
+
+	entries, err := ioutil.ReadDir(src)
+	if err != nil {
+		return err
+	}
+
+	for _, fi := range entries {
+		path := filepath.Join(dst, fi.Name())
+		if _, err := os.Lstat(path); err == nil {
+			continue
+		} else if !os.IsNotExist(err) {
+			return err
+		}
+
+		switch {
+		case fi.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(filepath.Join(src, fi.Name()))
+			if err != nil {
+				return err
+			}
+			if err := os.Symlink(link, path); err != nil {
+				return err
+			}
+		case fi.Mode().IsRegular():
+			data, err := readRootfsFile(j.opt.RootfsDir, filepath.Join(dir, fi.Name()), fi.Size())
+			if err != nil {
+				return err
+			}
+			if err := ioutil.WriteFile(path, data, fi.Mode().Perm()); err != nil {
+				return err
+			}
+			if err := os.Chmod(path, fi.Mode()); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("cannot inject a symlink into %s: %s is not a file or symlink", dir, fi.Name())
+		}
+
+		if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+			if err := os.Lchown(path, int(st.Uid), int(st.Gid)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+//mount adds to spec the bind mounts of the staged paths, see mountTarget. The
+//other files of rootfs are left as they are, and so are the changes the
+//container makes to them
+func (j *rootfsJournal) mount(spec *specs.Spec) error {
+	targets := []string{}
+	links := map[string]bool{}
+
+	for _, s := range j.staged {
+		target, err := j.mountTarget(s)
+		if err != nil {
+			return err
+		}
+
+		if s.typ == "symlink" && target == filepath.Dir(s.path) {
+			links[target] = true
+		}
+		targets = append(targets, target)
+	}
+
+	//a mount covers the staged paths below it, nested mounts are dropped
+	under := func(path string, dirs []string) bool {
+		for _, dir := range dirs {
+			if path == dir || strings.HasPrefix(path, dir+"/") {
+				return true
+			}
+		}
+		return false
+	}
+
+	sort.Strings(targets)
+	mounted := []string{}
+	for _, target := range targets {
+		if under(target, mounted) {
+			continue
+		}
+		mounted = append(mounted, target)
+
+		if links[target] && !j.opt.DryRun {
+			if err := j.copyDirEntries(target); err != nil {
+				return err
+			}
+		}
+
+		spec.Mounts = append(spec.Mounts, specs.Mount{
+			Destination: target,
+			Type:        "bind",
+			Source:      filepath.Join(j.shadowRoot(), target),
+			Options:     []string{"bind"},
+		})
+	}
+
+	return nil
+}
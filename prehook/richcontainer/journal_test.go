@@ -0,0 +1,330 @@
+package richcontainer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+
+	"github.com/opencontainers/runc/prehook"
+)
+
+func TestJournalRollback(t *testing.T) {
+	rootfs, err := ioutil.TempDir("", "richcontainer-journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(rootfs)
+
+	existing := filepath.Join(rootfs, "etc", "existing")
+	if err := os.MkdirAll(filepath.Dir(existing), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(existing, []byte("original"), 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	j := &rootfsJournal{opt: &prehook.HookOptions{RootfsDir: rootfs}}
+
+	if err := j.track(existing); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(existing, []byte("changed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	created := filepath.Join(rootfs, "usr", "local", "bin")
+	if err := j.mkdirAll(created, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := j.symlink("../existing", filepath.Join(rootfs, "etc", "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := j.rollback(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(existing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "original" {
+		t.Fatalf("expected original content, got %q", data)
+	}
+	if fi, err := os.Stat(existing); err != nil || fi.Mode().Perm() != 0640 {
+		t.Fatalf("expected mode 0640 restored, got %v (%v)", fi.Mode(), err)
+	}
+	if _, err := os.Lstat(filepath.Join(rootfs, "usr")); !os.IsNotExist(err) {
+		t.Fatalf("expected created dir to be removed, got %v", err)
+	}
+	if _, err := os.Lstat(filepath.Join(rootfs, "etc", "link")); !os.IsNotExist(err) {
+		t.Fatalf("expected created symlink to be removed, got %v", err)
+	}
+}
+
+func TestJournalDryRun(t *testing.T) {
+	rootfs, err := ioutil.TempDir("", "richcontainer-journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(rootfs)
+
+	opt := &prehook.HookOptions{RootfsDir: rootfs, DryRun: true}
+	j := &rootfsJournal{opt: opt}
+
+	if err := j.mkdirAll(filepath.Join(rootfs, "etc", "profile.d"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := j.writeFile(filepath.Join(rootfs, "etc", "profile.d", "env.sh"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Lstat(filepath.Join(rootfs, "etc")); !os.IsNotExist(err) {
+		t.Fatalf("expected dry run not to write to rootfs, got %v", err)
+	}
+
+	expected := []prehook.RootfsWrite{
+		{Path: "/etc", Type: "directory", Mode: os.ModeDir | 0755},
+		{Path: "/etc/profile.d", Type: "directory", Mode: os.ModeDir | 0755},
+		{Path: "/etc/profile.d/env.sh", Type: "file", Mode: 0644},
+	}
+	if !reflect.DeepEqual(opt.Writes, expected) {
+		t.Fatalf("expected writes %v, got %v", expected, opt.Writes)
+	}
+}
+
+func TestJournalStaging(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "richcontainer-journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	rootfs := filepath.Join(tmp, "rootfs")
+	for _, dir := range []string{"etc/profile.d", "usr/bin"} {
+		if err := os.MkdirAll(filepath.Join(rootfs, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	environment := filepath.Join(rootfs, "etc", "environment")
+	if err := ioutil.WriteFile(environment, []byte("original"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	opt := &prehook.HookOptions{RootfsDir: rootfs, StagingDir: filepath.Join(tmp, "staging")}
+	j := &rootfsJournal{opt: opt}
+
+	if err := j.writeFile(environment, []byte("changed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := j.writeFile(filepath.Join(rootfs, "usr", "bin", "dumb-init"), []byte("bin"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	wants := filepath.Join(rootfs, "etc", "systemd", "system", "multi-user.target.wants")
+	if err := j.mkdirAll(wants, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := j.symlink("../richcontainer.service", filepath.Join(wants, "richcontainer.service")); err != nil {
+		t.Fatal(err)
+	}
+	if err := j.writeFile(filepath.Join(rootfs, "etc", "profile.d", "pouchenv.sh"), []byte("env"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	//rootfs is left untouched
+	if data, err := ioutil.ReadFile(environment); err != nil || string(data) != "original" {
+		t.Fatalf("expected rootfs file unchanged, got %q (%v)", data, err)
+	}
+	for _, path := range []string{"usr/bin/dumb-init", "etc/systemd", "etc/profile.d/pouchenv.sh"} {
+		if _, err := os.Lstat(filepath.Join(rootfs, path)); !os.IsNotExist(err) {
+			t.Fatalf("expected %s not to be created in rootfs, got %v", path, err)
+		}
+	}
+
+	spec := &specs.Spec{}
+	if err := j.mount(spec); err != nil {
+		t.Fatal(err)
+	}
+
+	//the staged files and the new directories are mounted one by one
+	shadow := filepath.Join(opt.StagingDir, "richcontainer", "rootfs")
+	expected := []specs.Mount{}
+	for _, path := range []string{"/etc/environment", "/etc/profile.d/pouchenv.sh", "/etc/systemd", "/usr/bin/dumb-init"} {
+		expected = append(expected, specs.Mount{
+			Destination: path,
+			Type:        "bind",
+			Source:      filepath.Join(shadow, path),
+			Options:     []string{"bind"},
+		})
+	}
+	if !reflect.DeepEqual(spec.Mounts, expected) {
+		t.Fatalf("expected mounts %v, got %v", expected, spec.Mounts)
+	}
+
+	if data, err := ioutil.ReadFile(filepath.Join(shadow, "etc", "environment")); err != nil || string(data) != "changed" {
+		t.Fatalf("expected staged file, got %q (%v)", data, err)
+	}
+	if link, err := os.Readlink(filepath.Join(shadow, "etc", "systemd", "system", "multi-user.target.wants", "richcontainer.service")); err != nil || link != "../richcontainer.service" {
+		t.Fatalf("expected staged symlink, got %q (%v)", link, err)
+	}
+
+	if err := j.rollback(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Lstat(filepath.Join(opt.StagingDir, "richcontainer")); !os.IsNotExist(err) {
+		t.Fatalf("expected staging dir to be removed, got %v", err)
+	}
+}
+
+func TestJournalStagingBind(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "richcontainer-journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	rootfs := filepath.Join(tmp, "rootfs")
+	if err := os.MkdirAll(filepath.Join(rootfs, "etc"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	environment := filepath.Join(rootfs, "etc", "environment")
+	if err := ioutil.WriteFile(environment, []byte("original"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	opt := &prehook.HookOptions{RootfsDir: rootfs, StagingDir: filepath.Join(tmp, "staging")}
+	j := &rootfsJournal{opt: opt}
+
+	if err := j.writeFile(environment, []byte("changed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	spec := &specs.Spec{}
+	if err := j.mount(spec); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []specs.Mount{{
+		Destination: "/etc/environment",
+		Type:        "bind",
+		Source:      filepath.Join(opt.StagingDir, "richcontainer", "rootfs", "etc", "environment"),
+		Options:     []string{"bind"},
+	}}
+	if !reflect.DeepEqual(spec.Mounts, expected) {
+		t.Fatalf("expected mounts %v, got %v", expected, spec.Mounts)
+	}
+
+	//files staged for a container with the same id are not overwritten
+	other := &rootfsJournal{opt: opt}
+	if err := other.writeFile(environment, []byte("other"), 0644); err == nil {
+		t.Fatal("expected error on existing staging dir")
+	}
+	if err := other.rollback(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Lstat(expected[0].Source); err != nil {
+		t.Fatalf("expected staged file to be kept, got %v", err)
+	}
+}
+
+func TestJournalStagingSymlinks(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "richcontainer-journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	//a merged-usr image, with an existing wants directory
+	rootfs := filepath.Join(tmp, "rootfs")
+	wants := filepath.Join(rootfs, "etc", "systemd", "system", "multi-user.target.wants")
+	for _, dir := range []string{"usr/bin", wants[len(rootfs):]} {
+		if err := os.MkdirAll(filepath.Join(rootfs, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("usr/bin", filepath.Join(rootfs, "bin")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("/lib/systemd/system/cron.service", filepath.Join(wants, "cron.service")); err != nil {
+		t.Fatal(err)
+	}
+
+	opt := &prehook.HookOptions{RootfsDir: rootfs, StagingDir: filepath.Join(tmp, "staging")}
+	j := &rootfsJournal{opt: opt}
+
+	if err := j.writeFile(filepath.Join(rootfs, "bin", "tini"), []byte("bin"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := j.symlink("../richcontainer.service", filepath.Join(wants, "richcontainer.service")); err != nil {
+		t.Fatal(err)
+	}
+
+	spec := &specs.Spec{}
+	if err := j.mount(spec); err != nil {
+		t.Fatal(err)
+	}
+
+	shadow := filepath.Join(opt.StagingDir, "richcontainer", "rootfs")
+	expected := []specs.Mount{}
+	for _, path := range []string{"/etc/systemd/system/multi-user.target.wants", "/usr/bin/tini"} {
+		expected = append(expected, specs.Mount{
+			Destination: path,
+			Type:        "bind",
+			Source:      filepath.Join(shadow, path),
+			Options:     []string{"bind"},
+		})
+	}
+	if !reflect.DeepEqual(spec.Mounts, expected) {
+		t.Fatalf("expected mounts %v, got %v", expected, spec.Mounts)
+	}
+
+	//the directory mounted for the symlink keeps the entries of the image
+	for name, target := range map[string]string{
+		"cron.service":          "/lib/systemd/system/cron.service",
+		"richcontainer.service": "../richcontainer.service",
+	} {
+		link, err := os.Readlink(filepath.Join(shadow, "etc", "systemd", "system", "multi-user.target.wants", name))
+		if err != nil || link != target {
+			t.Fatalf("expected %s to link to %s, got %q (%v)", name, target, link, err)
+		}
+	}
+}
+
+func TestJournalSymlinkEscape(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "richcontainer-journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	host := filepath.Join(tmp, "host")
+	rootfs := filepath.Join(tmp, "rootfs")
+	for _, dir := range []string{host, rootfs} {
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	//the /etc of the image points to a host directory
+	if err := os.Symlink(host, filepath.Join(rootfs, "etc")); err != nil {
+		t.Fatal(err)
+	}
+
+	j := &rootfsJournal{opt: &prehook.HookOptions{RootfsDir: rootfs}}
+	if err := j.mkdirAll(filepath.Join(rootfs, "etc", "profile.d"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := j.writeFile(filepath.Join(rootfs, "etc", "profile.d", "env.sh"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Lstat(filepath.Join(host, "profile.d")); !os.IsNotExist(err) {
+		t.Fatalf("expected the host directory not to be written, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(rootfs, host, "profile.d", "env.sh")); err != nil {
+		t.Fatalf("expected the file to be written in rootfs: %v", err)
+	}
+}
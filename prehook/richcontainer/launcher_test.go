@@ -0,0 +1,82 @@
+package richcontainer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+
+	"github.com/opencontainers/runc/prehook"
+)
+
+func newTestRootfs(t *testing.T, files ...string) string {
+	rootfs, err := ioutil.TempDir("", "richcontainer-rootfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, f := range files {
+		path := filepath.Join(rootfs, f)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, nil, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return rootfs
+}
+
+func TestTiniLauncherUsesImageTini(t *testing.T) {
+	rootfs := newTestRootfs(t, "/sbin/tini")
+	defer os.RemoveAll(rootfs)
+
+	opt := &prehook.HookOptions{RootfsDir: rootfs, ID: "tini-test"}
+	defer releaseJournal(opt.ID)
+	spec := &specs.Spec{Process: &specs.Process{Args: []string{"nginx", "-g", "daemon off;"}}}
+
+	if err := (&tiniLauncher{}).Launch(opt, spec, &Config{Enabled: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"/sbin/tini", "-s", "-g", "--", "nginx", "-g", "daemon off;"}
+	if !reflect.DeepEqual(spec.Process.Args, expected) {
+		t.Fatalf("expected args %v, got %v", expected, spec.Process.Args)
+	}
+}
+
+func TestS6LauncherWritesService(t *testing.T) {
+	rootfs := newTestRootfs(t, s6InitPath, s6WithContenvPath)
+	defer os.RemoveAll(rootfs)
+
+	opt := &prehook.HookOptions{RootfsDir: rootfs, ID: "s6-test"}
+	defer releaseJournal(opt.ID)
+	spec := &specs.Spec{Process: &specs.Process{Args: []string{"echo", "it's"}, Cwd: "/srv"}}
+	config := &Config{Enabled: true, User: "app", InitScript: "/opt/init.sh"}
+
+	if err := (&s6Launcher{}).Launch(opt, spec, config); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(spec.Process.Args, []string{s6InitPath}) {
+		t.Fatalf("expected args to be %s, got %v", s6InitPath, spec.Process.Args)
+	}
+
+	for path, expected := range map[string]string{
+		"/etc/services.d/richcontainer/run":    "#!/usr/bin/with-contenv sh\ncd '/srv' || exit 1\nexec s6-setuidgid 'app' 'echo' 'it'\\''s'\n",
+		"/etc/services.d/richcontainer/finish": "#!/bin/sh\ns6-svscanctl -t /var/run/s6/services\n",
+		"/etc/cont-init.d/00-richcontainer":    "#!/bin/sh\nexec '/opt/init.sh'\n",
+	} {
+		data, err := ioutil.ReadFile(filepath.Join(rootfs, path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != expected {
+			t.Fatalf("expected %s to be %q, got %q", path, expected, data)
+		}
+	}
+}
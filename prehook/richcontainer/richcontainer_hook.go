@@ -13,11 +13,8 @@ import (
 )
 
 const (
-	richModeEnv         = "rich_mode=true"
-	richModeLaunchEnv   = "rich_mode_launch_manner"
-	rich_mode_script    = "initscript"
-	persistentEnvShFile = "/etc/profile.d/pouchenv.sh"
-	persistentEnvShDir  = "/etc/profile.d"
+	//rich container hook runs after the default priority hooks
+	richContainerHookPriority = 100
 )
 
 var (
@@ -26,29 +23,75 @@ var (
 
 func init() {
 	prehook.RegisterPreHook(&prehook.HookRegistration{
-		Type: "richContainer",
-		RunFunc: func(opt *prehook.HookOptions, spec *specs.Spec) error {
-			if !isRichMode(spec) {
+		Type:     "richContainer",
+		Priority: richContainerHookPriority,
+		//no Match, the health check annotation is removed from every container
+		RunFunc: runHook,
+		Revert: func(opt *prehook.HookOptions, spec *specs.Spec) error {
+			j := releaseJournal(opt.ID)
+			if j == nil {
 				return nil
 			}
 
-			launcher, err := getRichModeLauncher(spec)
-			if err != nil {
-				return err
-			}
-
-			if err = commonHook(opt, spec); err != nil {
-				return err
-			}
-
-			return launcher.Launch(opt, spec)
+			return j.rollback()
 		},
 	})
 }
 
+//runHook parses the rich container config of spec and launches it
+func runHook(opt *prehook.HookOptions, spec *specs.Spec) error {
+	config, err := ParseConfig(spec)
+
+	//set by the launcher only
+	delete(spec.Annotations, annotationHealthCheck)
+
+	if err != nil {
+		return err
+	}
+
+	//the env of a container that is not rich is its own, initscript and
+	//the like may be plain workload variables
+	if !config.Enabled {
+		return nil
+	}
+
+	//the control settings must not leak into the rich container workload
+	stripControlEnv(spec)
+
+	launcher, err := getRichModeLauncher(config)
+	if err != nil {
+		return err
+	}
+
+	if err = config.loadServicesFile(opt.BundleDir); err != nil {
+		return err
+	}
+
+	if len(config.Services) > 0 {
+		if l, ok := launcher.(MultiServiceLauncher); !ok || !l.SupportServices() {
+			return fmt.Errorf("rich container launcher %s does not support services", launcher.Name())
+		}
+	}
+
+	if err = checkUsers(opt.RootfsDir, config, spec); err != nil {
+		return err
+	}
+
+	if err = commonHook(opt, spec, config); err != nil {
+		return err
+	}
+
+	if err = launcher.Launch(opt, spec, config); err != nil {
+		return err
+	}
+
+	//expose the files staged by the launcher
+	return journalFor(opt).mount(spec)
+}
+
 type RichContainerLauncher interface {
 	Name() string
-	Launch(opt *prehook.HookOptions, spec *specs.Spec) error
+	Launch(opt *prehook.HookOptions, spec *specs.Spec, config *Config) error
 }
 
 type richLauncherManager struct {
@@ -93,74 +136,56 @@ func GetDefaultLauncher() RichContainerLauncher {
 	return nil
 }
 
-func isRichMode(spec *specs.Spec) bool {
-	envs := spec.Process.Env
-	for _, env := range envs {
-		if strings.TrimSpace(env) == richModeEnv {
-			return true
-		}
-	}
-
-	return false
-}
-
-func getRichModeLauncher(spec *specs.Spec) (RichContainerLauncher, error) {
-	var launcherName string = ""
+func getRichModeLauncher(config *Config) (RichContainerLauncher, error) {
 	var launcher RichContainerLauncher = nil
 
-	envs := spec.Process.Env
-
-	for _, env := range envs {
-		kvs := strings.Split(env, "=")
-		if len(kvs) == 2 {
-			if kvs[0] == richModeLaunchEnv {
-				launcherName = kvs[1]
-				break
-			}
-		}
-	}
-
-	if launcherName == "" {
+	if config.Launcher == "" {
 		launcher = GetDefaultLauncher()
 	} else {
-		launcher = GetLauncher(launcherName)
+		launcher = GetLauncher(config.Launcher)
 	}
 
 	if launcher == nil {
-		return nil, fmt.Errorf("not found rich container launcher %s", launcherName)
+		return nil, fmt.Errorf("not found rich container launcher %s", config.Launcher)
 	}
 
 	return launcher, nil
 }
 
-func commonHook(opt *prehook.HookOptions, spec *specs.Spec) error {
-	//persistent env to /etc/profile.d/pouchenv.sh
-	rootfs := opt.RootfsDir
-	envMap := map[string]string{}
+//wrapWithInitScript runs script in a shell before exec-ing args
+func wrapWithInitScript(script string, args []string) []string {
+	newArgs := []string{"/bin/sh", "-c", fmt.Sprintf("%s && exec \"$@\"", shellQuote(script)), "sh"}
+	return append(newArgs, args...)
+}
 
-	for _, env := range spec.Process.Env {
-		kvs := strings.Split(env, "=")
-		if len(kvs) == 2 {
-			envMap[kvs[0]] = kvs[1]
-		}
-	}
+//shellQuote quotes s as a single word for sh
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
 
-	//mkdir $roofs/etc/profile.d/
-	err := os.MkdirAll(filepath.Join(rootfs, persistentEnvShDir), 0x755)
+//injectHostBinary copies the host binary to rootfsPath in rootfs if not there
+func injectHostBinary(j *rootfsJournal, binPath string, rootfs string, rootfsPath string) error {
+	abPath, err := filepath.Abs(binPath)
 	if err != nil {
 		return err
 	}
 
-	f, err := os.OpenFile(filepath.Join(rootfs, persistentEnvShFile), os.O_TRUNC|os.O_WRONLY|os.O_CREATE, 0x755)
-	if err != nil {
-		return err
+	rootfsBinPath := filepath.Join(rootfs, rootfsPath)
+	_, err = os.Stat(rootfsBinPath)
+
+	if err == nil {
+		return nil
 	}
 
-	defer f.Close()
+	if !os.IsNotExist(err) {
+		return err
+	}
 
-	for k, v := range envMap {
-		f.WriteString(fmt.Sprintf("export %s=\"%s\"\n", k, v))
+	//mkdir /usr/bin
+	err = j.mkdirAll(filepath.Dir(rootfsBinPath), 0755)
+	if err != nil {
+		return err
 	}
 
-	return nil
+	return j.copyFile(abPath, rootfsBinPath, 0755)
 }
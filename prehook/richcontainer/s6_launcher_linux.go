@@ -0,0 +1,217 @@
+package richcontainer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+
+	"github.com/opencontainers/runc/prehook"
+)
+
+//use s6-overlay shipped in image as init process, the container args are run
+//as an s6 service and the container stops when it exits
+
+const (
+	s6LauncherName = "s6-overlay"
+
+	s6InitPath        = "/init"
+	s6WithContenvPath = "/usr/bin/with-contenv"
+	s6ServicesDir     = "/etc/services.d"
+	s6ContInitDir     = "/etc/cont-init.d"
+	s6ScanDir         = "/var/run/s6/services"
+
+	s6InitScriptName       = "00-richcontainer"
+	s6DefaultShebang       = "#!/bin/sh"
+	s6ContenvShebangFormat = "#!%s sh"
+)
+
+func init() {
+	RegisterLauncher(&s6Launcher{})
+}
+
+type s6Launcher struct {
+}
+
+func (l *s6Launcher) Name() string {
+	return s6LauncherName
+}
+
+func (l *s6Launcher) SupportServices() bool {
+	return true
+}
+
+func (l *s6Launcher) Launch(opt *prehook.HookOptions, spec *specs.Spec, config *Config) error {
+	rootfs := opt.RootfsDir
+
+	//check has s6-overlay
+	_, err := os.Stat(filepath.Join(rootfs, s6InitPath))
+	if err != nil {
+		log.Errorf("stat s6-overlay %s error:%s", s6InitPath, err.Error())
+		return err
+	}
+
+	if len(spec.Process.Args) == 0 {
+		return errors.New("no cmd set in process of container runtime spec")
+	}
+
+	shebang, err := l.shebang(rootfs)
+	if err != nil {
+		return err
+	}
+
+	services, err := containerServices(config, spec)
+	if err != nil {
+		return err
+	}
+
+	j := journalFor(opt)
+
+	for _, service := range services {
+		s6Service := &s6Service{
+			Name:      service.Name,
+			Args:      service.Args,
+			Env:       service.Env,
+			Cwd:       service.Cwd,
+			User:      service.User,
+			DependsOn: service.DependsOn,
+			Restart:   service.Restart,
+			Shebang:   shebang,
+			//the main service brings the container down when it exits
+			StopContainer: service.Main,
+		}
+
+		if err = l.writeService(j, rootfs, s6Service); err != nil {
+			return err
+		}
+	}
+
+	if config.InitScript != "" {
+		err = l.writeContInit(j, rootfs, s6InitScriptName, config.InitScript)
+		if err != nil {
+			return err
+		}
+	}
+
+	spec.Process.Args = []string{s6InitPath}
+
+	return nil
+}
+
+//shebang of generated scripts, run with container env if with-contenv exists
+func (l *s6Launcher) shebang(rootfs string) (string, error) {
+	_, err := os.Stat(filepath.Join(rootfs, s6WithContenvPath))
+	if err == nil {
+		return fmt.Sprintf(s6ContenvShebangFormat, s6WithContenvPath), nil
+	}
+
+	if !os.IsNotExist(err) {
+		return "", err
+	}
+
+	return s6DefaultShebang, nil
+}
+
+//s6Service is an s6 service directory generated in rootfs
+type s6Service struct {
+	Name      string
+	Args      []string
+	Env       []string
+	Cwd       string
+	User      string
+	DependsOn []string
+	Restart   string
+	Shebang   string
+	//stop the container when the service exits
+	StopContainer bool
+}
+
+func (s *s6Service) runScript() []byte {
+	buf := &bytes.Buffer{}
+
+	fmt.Fprintln(buf, s.Shebang)
+
+	//s6 starts services in parallel, wait for dependencies to be up
+	for _, dep := range s.DependsOn {
+		fmt.Fprintf(buf, "s6-svwait -u %s\n", shellQuote(filepath.Join(s6ScanDir, dep)))
+	}
+
+	if s.Cwd != "" {
+		fmt.Fprintf(buf, "cd %s || exit 1\n", shellQuote(s.Cwd))
+	}
+
+	for _, env := range s.Env {
+		fmt.Fprintf(buf, "export %s\n", shellQuote(env))
+	}
+
+	words := []string{"exec"}
+	if s.User != "" {
+		words = append(words, "s6-setuidgid", shellQuote(s.User))
+	}
+	for _, arg := range s.Args {
+		words = append(words, shellQuote(arg))
+	}
+	fmt.Fprintln(buf, strings.Join(words, " "))
+
+	return buf.Bytes()
+}
+
+//finishScript runs when the service exits with its exit code as $1, s6
+//restarts the service unless it is marked down
+func (s *s6Service) finishScript() []byte {
+	buf := &bytes.Buffer{}
+
+	fmt.Fprintln(buf, s6DefaultShebang)
+
+	switch {
+	case s.StopContainer:
+		fmt.Fprintf(buf, "s6-svscanctl -t %s\n", s6ScanDir)
+	case s.Restart == RestartAlways:
+		return nil
+	case s.Restart == RestartOnFailure:
+		fmt.Fprintln(buf, `[ "$1" -eq 0 ] && s6-svc -d .`)
+		fmt.Fprintln(buf, "exit 0")
+	default:
+		fmt.Fprintln(buf, "s6-svc -d .")
+	}
+
+	return buf.Bytes()
+}
+
+func (l *s6Launcher) writeService(j *rootfsJournal, rootfs string, service *s6Service) error {
+	dir := filepath.Join(rootfs, s6ServicesDir, service.Name)
+
+	err := j.mkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+
+	err = j.writeFile(filepath.Join(dir, "run"), service.runScript(), 0755)
+	if err != nil {
+		return err
+	}
+
+	if finish := service.finishScript(); finish != nil {
+		return j.writeFile(filepath.Join(dir, "finish"), finish, 0755)
+	}
+
+	return nil
+}
+
+//writeContInit runs script at container start before services
+func (l *s6Launcher) writeContInit(j *rootfsJournal, rootfs string, name string, script string) error {
+	dir := filepath.Join(rootfs, s6ContInitDir)
+
+	err := j.mkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+
+	data := fmt.Sprintf("%s\nexec %s\n", s6DefaultShebang, shellQuote(script))
+
+	return j.writeFile(filepath.Join(dir, name), []byte(data), 0755)
+}
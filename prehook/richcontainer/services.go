@@ -0,0 +1,210 @@
+package richcontainer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+//services run by the launcher are described by a json list in an annotation
+//or in a file of the bundle
+
+const (
+	annotationServices     = annotationPrefix + "services"
+	annotationServicesFile = annotationPrefix + "services-file"
+
+	//name of the service made of the container args if no service is main
+	mainServiceName = "richcontainer"
+
+	RestartNo        = "no"
+	RestartAlways    = "always"
+	RestartOnFailure = "on-failure"
+)
+
+var (
+	serviceNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+)
+
+//Service is a service run in rich container
+type Service struct {
+	Name string   `json:"name"`
+	Args []string `json:"args"`
+	Env  []string `json:"env,omitempty"`
+	Cwd  string   `json:"cwd,omitempty"`
+	//user of the service, rich container user if not set
+	User string `json:"user,omitempty"`
+	//services started before this one, this one fails if they fail
+	DependsOn []string `json:"dependsOn,omitempty"`
+	//no, always or on-failure, no if not set
+	Restart string `json:"restart,omitempty"`
+	//the main service replaces the container args, at most one is main
+	Main bool `json:"main,omitempty"`
+}
+
+//MultiServiceLauncher is a launcher able to run Config.Services
+type MultiServiceLauncher interface {
+	RichContainerLauncher
+	SupportServices() bool
+}
+
+func decodeServices(data []byte, source string) ([]*Service, error) {
+	services := []*Service{}
+	if err := json.Unmarshal(data, &services); err != nil {
+		return nil, fmt.Errorf("parse rich container services from %s error: %v", source, err)
+	}
+
+	return services, nil
+}
+
+//loadServicesFile reads Config.ServicesFile, relative path is relative to bundle
+func (c *Config) loadServicesFile(bundleDir string) error {
+	if c.ServicesFile == "" {
+		return nil
+	}
+
+	path := c.ServicesFile
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(bundleDir, path)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	services, err := decodeServices(data, path)
+	if err != nil {
+		return err
+	}
+
+	c.Services = services
+
+	return validateServices(c.Services)
+}
+
+func validateServices(services []*Service) error {
+	names := map[string]bool{}
+	main := ""
+
+	for _, s := range services {
+		if !serviceNameRegexp.MatchString(s.Name) {
+			return fmt.Errorf("invalid rich container service name %q", s.Name)
+		}
+
+		if names[s.Name] {
+			return fmt.Errorf("duplicate rich container service %s", s.Name)
+		}
+		names[s.Name] = true
+
+		if len(s.Args) == 0 {
+			return fmt.Errorf("rich container service %s: args not set", s.Name)
+		}
+
+		switch s.Restart {
+		case "", RestartNo, RestartAlways, RestartOnFailure:
+		default:
+			return fmt.Errorf("rich container service %s: invalid restart policy %q", s.Name, s.Restart)
+		}
+
+		if s.Main {
+			if main != "" {
+				return fmt.Errorf("rich container services %s and %s are both main", main, s.Name)
+			}
+			main = s.Name
+		}
+	}
+
+	for _, s := range services {
+		for _, dep := range s.DependsOn {
+			if !names[dep] {
+				return fmt.Errorf("rich container service %s depends on unknown service %s", s.Name, dep)
+			}
+		}
+	}
+
+	_, err := sortServices(services)
+	return err
+}
+
+//sortServices orders services so that each one comes after its dependencies,
+//keeping the declared order otherwise
+func sortServices(services []*Service) ([]*Service, error) {
+	byName := map[string]*Service{}
+	for _, s := range services {
+		byName[s.Name] = s
+	}
+
+	const (
+		visiting = 1
+		done     = 2
+	)
+	state := map[string]int{}
+	sorted := []*Service{}
+
+	var visit func(s *Service) error
+	visit = func(s *Service) error {
+		switch state[s.Name] {
+		case done:
+			return nil
+		case visiting:
+			return fmt.Errorf("rich container service %s has a dependency cycle", s.Name)
+		}
+
+		state[s.Name] = visiting
+		for _, dep := range s.DependsOn {
+			if err := visit(byName[dep]); err != nil {
+				return err
+			}
+		}
+		state[s.Name] = done
+
+		sorted = append(sorted, s)
+		return nil
+	}
+
+	for _, s := range services {
+		if err := visit(s); err != nil {
+			return nil, err
+		}
+	}
+
+	return sorted, nil
+}
+
+//containerServices returns the services to run in dependency order, the
+//container args make the main service if none of Config.Services is main
+func containerServices(config *Config, spec *specs.Spec) ([]*Service, error) {
+	services := []*Service{}
+	hasMain := false
+
+	for _, s := range config.Services {
+		service := *s
+		if service.User == "" {
+			service.User = config.User
+		}
+		hasMain = hasMain || service.Main
+		services = append(services, &service)
+	}
+
+	if !hasMain {
+		for _, s := range services {
+			if s.Name == mainServiceName {
+				return nil, fmt.Errorf("rich container service name %s is reserved if no service is main", mainServiceName)
+			}
+		}
+
+		services = append(services, &Service{
+			Name: mainServiceName,
+			Args: spec.Process.Args,
+			Cwd:  spec.Process.Cwd,
+			User: config.User,
+			Main: true,
+		})
+	}
+
+	return sortServices(services)
+}
@@ -0,0 +1,126 @@
+package richcontainer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+
+	"github.com/opencontainers/runc/prehook"
+)
+
+func serviceNames(services []*Service) []string {
+	names := []string{}
+	for _, s := range services {
+		names = append(names, s.Name)
+	}
+	return names
+}
+
+func TestValidateServices(t *testing.T) {
+	for _, services := range [][]*Service{
+		{{Name: "a", Args: []string{"a"}}, {Name: "a", Args: []string{"a"}}},
+		{{Name: "bad name", Args: []string{"a"}}},
+		{{Name: "a"}},
+		{{Name: "a", Args: []string{"a"}, Restart: "sometimes"}},
+		{{Name: "a", Args: []string{"a"}, DependsOn: []string{"missing"}}},
+		{{Name: "a", Args: []string{"a"}, DependsOn: []string{"b"}}, {Name: "b", Args: []string{"b"}, DependsOn: []string{"a"}}},
+		{{Name: "a", Args: []string{"a"}, Main: true}, {Name: "b", Args: []string{"b"}, Main: true}},
+	} {
+		if err := validateServices(services); err == nil {
+			t.Fatalf("expected error validating %v", serviceNames(services))
+		}
+	}
+}
+
+func TestContainerServices(t *testing.T) {
+	config := &Config{
+		User: "app",
+		Services: []*Service{
+			{Name: "agent", Args: []string{"agent"}, DependsOn: []string{"sshd"}},
+			{Name: "sshd", Args: []string{"/usr/sbin/sshd", "-D"}, User: "root"},
+		},
+	}
+	spec := &specs.Spec{Process: &specs.Process{Args: []string{"app"}, Cwd: "/srv"}}
+
+	services, err := containerServices(config, spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if names := serviceNames(services); !reflect.DeepEqual(names, []string{"sshd", "agent", mainServiceName}) {
+		t.Fatalf("unexpected service order %v", names)
+	}
+	if services[0].User != "root" || services[1].User != "app" {
+		t.Fatalf("expected rich container user as default service user, got %q and %q", services[0].User, services[1].User)
+	}
+	main := services[2]
+	if !main.Main || !reflect.DeepEqual(main.Args, []string{"app"}) || main.Cwd != "/srv" {
+		t.Fatalf("unexpected main service %+v", main)
+	}
+}
+
+func TestSystemdLauncherServices(t *testing.T) {
+	rootfs := newTestRootfs(t, systemdBinRootfsPath, "/usr/bin/app", "/usr/sbin/sshd")
+	defer os.RemoveAll(rootfs)
+
+	opt := &prehook.HookOptions{RootfsDir: rootfs, ID: "systemd-test"}
+	defer releaseJournal(opt.ID)
+	spec := &specs.Spec{Process: &specs.Process{
+		Args: []string{"app", "--greeting", "hello world"},
+		Env:  []string{"PATH=/usr/bin:/usr/sbin"},
+	}}
+	config := &Config{
+		Enabled: true,
+		Services: []*Service{
+			{Name: "sshd", Args: []string{"sshd", "-D"}, Restart: RestartAlways, Env: []string{"LANG=C"}},
+		},
+	}
+
+	if err := (&systemdLauncher{}).Launch(opt, spec, config); err != nil {
+		t.Fatal(err)
+	}
+
+	main, err := ioutil.ReadFile(filepath.Join(rootfs, systemdServiceFilePath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(main), "ExecStart=/usr/bin/app --greeting \"hello world\"\n") {
+		t.Fatalf("unexpected main unit:\n%s", main)
+	}
+
+	sshd, err := ioutil.ReadFile(filepath.Join(rootfs, systemdUnitDir, "richcontainer-sshd.service"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"ExecStart=/usr/sbin/sshd -D\n", "Restart=always\n", "Environment=LANG=C\n"} {
+		if !strings.Contains(string(sshd), line) {
+			t.Fatalf("expected %q in sshd unit:\n%s", line, sshd)
+		}
+	}
+
+	for _, name := range []string{"richcontainer.service", "richcontainer-sshd.service"} {
+		if _, err := os.Lstat(filepath.Join(rootfs, systemdWantsDir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSystemdQuote(t *testing.T) {
+	for in, expected := range map[string]string{
+		"plain":      "plain",
+		"two words":  `"two words"`,
+		`say "hi"`:   `"say \"hi\""`,
+		"100%":       "100%%",
+		"":           `""`,
+		"line\nfeed": `"line\nfeed"`,
+	} {
+		if out := systemdQuote(in); out != expected {
+			t.Fatalf("systemdQuote(%q): expected %s, got %s", in, expected, out)
+		}
+	}
+}
@@ -1,11 +1,11 @@
 package richcontainer
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
 
@@ -20,6 +20,8 @@ const (
 	systemdBinRootfsPath      = "/usr/lib/systemd/systemd"
 	systemdDefaultDescription = "rich container run mode"
 	systemdServiceFilePath    = "/etc/systemd/system/richcontainer.service"
+	systemdUnitDir            = "/etc/systemd/system"
+	systemdWantsDir           = "/etc/systemd/system/multi-user.target.wants"
 )
 
 func init() {
@@ -33,8 +35,12 @@ func (l *systemdLauncher) Name() string {
 	return systemdLauncherName
 }
 
+func (l *systemdLauncher) SupportServices() bool {
+	return true
+}
+
 //todo:
-func (l *systemdLauncher) Launch(opt *prehook.HookOptions, spec *specs.Spec) error {
+func (l *systemdLauncher) Launch(opt *prehook.HookOptions, spec *specs.Spec, config *Config) error {
 	rootfs := opt.RootfsDir
 
 	//check has systemd
@@ -43,12 +49,15 @@ func (l *systemdLauncher) Launch(opt *prehook.HookOptions, spec *specs.Spec) err
 		return err
 	}
 
-	cmd := spec.Process.Args
-
-	if len(cmd) == 0 {
+	if len(spec.Process.Args) == 0 {
 		return errors.New("no cmd set in process of container runtime spec")
 	}
 
+	services, err := containerServices(config, spec)
+	if err != nil {
+		return err
+	}
+
 	//find PATH in env
 	sysPaths := []string{}
 
@@ -60,64 +69,139 @@ func (l *systemdLauncher) Launch(opt *prehook.HookOptions, spec *specs.Spec) err
 		}
 	}
 
-	path := cmd[0]
-	abPath, err := utils.FindAbPathInRootfs(path, rootfs, sysPaths)
+	j := journalFor(opt)
+
+	//link services to multi-user dir
+	wantsDir := filepath.Join(rootfs, systemdWantsDir)
+	err = j.mkdirAll(wantsDir, 0755)
 	if err != nil {
 		return err
 	}
 
+	for _, service := range services {
+		unitConfig, err := l.unitConfig(rootfs, sysPaths, service, config)
+		if err != nil {
+			return err
+		}
+
+		name := systemdUnitName(service.Name)
+		if service.Main {
+			setHealthCheck(spec, healthCheckSystemd, name)
+		}
+
+		err = l.writeServiceFile(j, unitConfig, filepath.Join(rootfs, systemdUnitDir, name))
+		if err != nil {
+			return err
+		}
+
+		err = j.symlink("../"+name, filepath.Join(wantsDir, name))
+		if err != nil {
+			return err
+		}
+	}
+
+	newCmd := []string{systemdBinRootfsPath}
+	spec.Process.Args = newCmd
+
+	return nil
+}
+
+func (l *systemdLauncher) unitConfig(rootfs string, sysPaths []string, service *Service, config *Config) (*systemdConfig, error) {
+	cmd := append([]string{}, service.Args...)
+
+	abPath, err := utils.FindAbPathInRootfs(cmd[0], rootfs, sysPaths)
+	if err != nil {
+		return nil, err
+	}
+
 	cmd[0] = abPath
 
-	config := &systemdConfig{
+	execStart := []string{}
+	for _, arg := range cmd {
+		execStart = append(execStart, systemdQuote(strings.Replace(arg, "$", "$$", -1)))
+	}
+
+	description := fmt.Sprintf("rich container service %s", service.Name)
+	if service.Name == mainServiceName {
+		description = systemdDefaultDescription
+	}
+
+	deps := []string{}
+	for _, dep := range service.DependsOn {
+		deps = append(deps, systemdUnitName(dep))
+	}
+
+	env := []string{}
+	for _, e := range service.Env {
+		env = append(env, systemdQuote(e))
+	}
+
+	execStartPre := ""
+	if service.Main && config.InitScript != "" {
+		execStartPre = systemdQuote(config.InitScript)
+	}
+
+	return &systemdConfig{
 		unit: &systemdUnitConfig{
-			Description: systemdDefaultDescription,
+			Description: description,
+			After:       deps,
+			Requires:    deps,
 		},
 		service: &systemdServiceConfig{
-			Type:      "simple",
-			ExecStart: strings.Join(cmd, " "),
+			Type:             "simple",
+			ExecStartPre:     execStartPre,
+			ExecStart:        strings.Join(execStart, " "),
+			User:             service.User,
+			WorkingDirectory: service.Cwd,
+			EnvironmentFile:  "-" + systemdEnvFile,
+			Environment:      env,
+			Restart:          service.Restart,
 		},
 		install: &systemdInstallConfig{
 			WantedBy: "multi-user.target",
 		},
-	}
-
-	err = l.writeServiceFile(config, filepath.Join(rootfs, systemdServiceFilePath))
-	if err != nil {
-		return err
-	}
+	}, nil
+}
 
-	//link service to multi-user dir
-	currentDir, err := os.Getwd()
-	if err != nil {
-		return err
+//systemdUnitName returns the unit name of a rich container service
+func systemdUnitName(service string) string {
+	if service == mainServiceName {
+		return mainServiceName + ".service"
 	}
 
-	defer os.Chdir(currentDir)
+	return fmt.Sprintf("%s-%s.service", mainServiceName, service)
+}
 
-	err = os.Chdir(filepath.Join(rootfs, "/etc/systemd/system/multi-user.target.wants"))
-	if err != nil {
-		return err
-	}
+//systemdQuote quotes s as a single word of a unit file setting if needed,
+//specifiers are escaped
+func systemdQuote(s string) string {
+	s = strings.Replace(s, "%", "%%", -1)
 
-	err = l.linkService("../richcontainer.service", "richcontainer.service")
-	if err != nil {
-		return err
+	if s != "" && !strings.ContainsAny(s, " \t\n\"'\\;") {
+		return s
 	}
 
-	newCmd := []string{systemdBinRootfsPath}
-	spec.Process.Args = newCmd
-
-	return nil
+	r := strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\n", "\\n", "\t", "\\t")
+	return "\"" + r.Replace(s) + "\""
 }
 
 type systemdUnitConfig struct {
 	Description string
+	After       []string
+	Requires    []string
 }
 
 type systemdServiceConfig struct {
 	//type :simple
-	Type      string
-	ExecStart string
+	Type             string
+	ExecStartPre     string
+	ExecStart        string
+	User             string
+	WorkingDirectory string
+	//optional if prefixed by -
+	EnvironmentFile string
+	Environment     []string
+	Restart         string
 }
 
 type systemdInstallConfig struct {
@@ -154,25 +238,28 @@ func (l *systemdLauncher) isSetRichContainerService(rootfs string) (bool, error)
 	return false, nil
 }
 
-func (l *systemdLauncher) writeServiceFile(config *systemdConfig, filePath string) error {
+func (l *systemdLauncher) writeServiceFile(j *rootfsJournal, config *systemdConfig, filePath string) error {
 	dir := filepath.Dir(filePath)
 
-	err := os.MkdirAll(dir, 0x755)
-	if err != nil {
-		return err
-	}
-
-	f, err := os.OpenFile(filePath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0x755)
+	err := j.mkdirAll(dir, 0755)
 	if err != nil {
 		return err
 	}
 
-	defer f.Close()
+	f := &bytes.Buffer{}
 
 	//write config
 	if config.unit != nil {
 		f.WriteString("[Unit]\n")
-		f.WriteString(fmt.Sprintf("Description=%s\n", systemdDefaultDescription))
+		f.WriteString(fmt.Sprintf("Description=%s\n", config.unit.Description))
+
+		if len(config.unit.After) > 0 {
+			f.WriteString(fmt.Sprintf("After=%s\n", strings.Join(config.unit.After, " ")))
+		}
+
+		if len(config.unit.Requires) > 0 {
+			f.WriteString(fmt.Sprintf("Requires=%s\n", strings.Join(config.unit.Requires, " ")))
+		}
 		f.WriteString("\n")
 	}
 
@@ -183,10 +270,34 @@ func (l *systemdLauncher) writeServiceFile(config *systemdConfig, filePath strin
 			f.WriteString(fmt.Sprintf("Type=%s\n", config.service.Type))
 		}
 
+		if config.service.User != "" {
+			f.WriteString(fmt.Sprintf("User=%s\n", config.service.User))
+		}
+
+		if config.service.EnvironmentFile != "" {
+			f.WriteString(fmt.Sprintf("EnvironmentFile=%s\n", config.service.EnvironmentFile))
+		}
+
+		if config.service.WorkingDirectory != "" {
+			f.WriteString(fmt.Sprintf("WorkingDirectory=%s\n", config.service.WorkingDirectory))
+		}
+
+		for _, env := range config.service.Environment {
+			f.WriteString(fmt.Sprintf("Environment=%s\n", env))
+		}
+
+		if config.service.ExecStartPre != "" {
+			f.WriteString(fmt.Sprintf("ExecStartPre=%s\n", config.service.ExecStartPre))
+		}
+
 		if config.service.ExecStart != "" {
 			f.WriteString(fmt.Sprintf("ExecStart=%s\n", config.service.ExecStart))
 		}
 
+		if config.service.Restart != "" {
+			f.WriteString(fmt.Sprintf("Restart=%s\n", config.service.Restart))
+		}
+
 		f.WriteString("\n")
 	}
 
@@ -199,22 +310,5 @@ func (l *systemdLauncher) writeServiceFile(config *systemdConfig, filePath strin
 		f.WriteString("\n")
 	}
 
-	return nil
-}
-
-func (l *systemdLauncher) linkService(serviceFilePath string, target string) error {
-	_, err := os.Stat(target)
-	if err == nil {
-		//if exists; remove it
-		e := os.Remove(target)
-		if e != nil {
-			return e
-		}
-	}
-
-	if err != nil && !os.IsNotExist(err) {
-		return err
-	}
-
-	return exec.Command("ln", "-s", serviceFilePath, target).Run()
+	return j.writeFile(filePath, f.Bytes(), 0644)
 }
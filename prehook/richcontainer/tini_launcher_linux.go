@@ -0,0 +1,97 @@
+package richcontainer
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+
+	"github.com/opencontainers/runc/prehook"
+)
+
+//use tini as init process, it reaps zombies and forwards signals to the
+//process group of the container process
+
+const (
+	tiniLauncherName = "tini"
+	tiniAppName      = "tini"
+
+	tiniRootfsPath = "/usr/bin/tini"
+)
+
+var (
+	//tini shipped in image is preferred to the host one
+	tiniImagePaths = []string{"/sbin/tini", "/usr/bin/tini", "/usr/local/bin/tini"}
+)
+
+func init() {
+	RegisterLauncher(&tiniLauncher{})
+}
+
+type tiniLauncher struct {
+}
+
+func (l *tiniLauncher) Name() string {
+	return tiniLauncherName
+}
+
+func (l *tiniLauncher) Launch(opt *prehook.HookOptions, spec *specs.Spec, config *Config) error {
+	log.Infof("container %s, rich container mode in tini mode", opt.ID)
+
+	args := spec.Process.Args
+	if len(args) == 0 {
+		return errors.New("not set args")
+	}
+
+	tiniPath, err := l.findInRootfs(opt.RootfsDir)
+	if err != nil {
+		return err
+	}
+
+	if tiniPath == "" {
+		//find tini path in node
+		path, err := exec.LookPath(tiniAppName)
+		if err != nil {
+			return err
+		}
+
+		err = injectHostBinary(journalFor(opt), path, opt.RootfsDir, tiniRootfsPath)
+		if err != nil {
+			return err
+		}
+
+		tiniPath = tiniRootfsPath
+	}
+
+	if config.InitScript != "" {
+		args = wrapWithInitScript(config.InitScript, args)
+	}
+
+	//-s: register as subreaper if not pid 1, -g: forward signals to the process group
+	newArgs := []string{tiniPath, "-s", "-g", "--"}
+	spec.Process.Args = append(newArgs, args...)
+	setHealthCheck(spec, healthCheckChild, "")
+
+	if config.User != "" {
+		return setProcessUser(opt.RootfsDir, config.User, spec)
+	}
+
+	return nil
+}
+
+func (l *tiniLauncher) findInRootfs(rootfs string) (string, error) {
+	for _, path := range tiniImagePaths {
+		_, err := os.Stat(filepath.Join(rootfs, path))
+		if err == nil {
+			return path, nil
+		}
+
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+	}
+
+	return "", nil
+}
@@ -0,0 +1,90 @@
+package richcontainer
+
+import (
+	"fmt"
+
+	"github.com/cyphar/filepath-securejoin"
+	"github.com/opencontainers/runtime-spec/specs-go"
+
+	"github.com/opencontainers/runc/libcontainer/user"
+)
+
+//users are looked up in the container rootfs before create so that a missing
+//user fails the create instead of the container init
+
+const (
+	passwdRootfsPath = "/etc/passwd"
+	groupRootfsPath  = "/etc/group"
+)
+
+//lookupUser resolves userSpec (user, uid, user:group or uid:gid) by the
+//passwd and group files of rootfs, unset fields default to the spec user
+func lookupUser(rootfs string, userSpec string, spec *specs.Spec) (*user.ExecUser, error) {
+	passwdPath, err := securejoin.SecureJoin(rootfs, passwdRootfsPath)
+	if err != nil {
+		return nil, err
+	}
+
+	groupPath, err := securejoin.SecureJoin(rootfs, groupRootfsPath)
+	if err != nil {
+		return nil, err
+	}
+
+	defaults := &user.ExecUser{Home: "/"}
+	if spec.Process != nil {
+		defaults.Uid = int(spec.Process.User.UID)
+		defaults.Gid = int(spec.Process.User.GID)
+	}
+
+	execUser, err := user.GetExecUserPath(userSpec, defaults, passwdPath, groupPath)
+	if err != nil {
+		return nil, fmt.Errorf("rich container user %s not found in container: %v", userSpec, err)
+	}
+
+	return execUser, nil
+}
+
+//setProcessUser makes the container process run as userSpec
+func setProcessUser(rootfs string, userSpec string, spec *specs.Spec) error {
+	execUser, err := lookupUser(rootfs, userSpec, spec)
+	if err != nil {
+		return err
+	}
+
+	additionalGids := []uint32{}
+	for _, gid := range execUser.Sgids {
+		additionalGids = append(additionalGids, uint32(gid))
+	}
+
+	spec.Process.User = specs.User{
+		UID:            uint32(execUser.Uid),
+		GID:            uint32(execUser.Gid),
+		AdditionalGids: additionalGids,
+		Username:       userSpec,
+	}
+
+	return nil
+}
+
+//checkUsers checks that the users of the rich container and of its services
+//exist in the container
+func checkUsers(rootfs string, config *Config, spec *specs.Spec) error {
+	users := []string{}
+	if config.User != "" {
+		users = append(users, config.User)
+	}
+
+	for _, s := range config.Services {
+		if s.User != "" {
+			users = append(users, s.User)
+		}
+	}
+
+	for _, u := range users {
+		if _, err := lookupUser(rootfs, u, spec); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,47 @@
+package richcontainer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+func TestSetProcessUser(t *testing.T) {
+	rootfs := newTestRootfs(t)
+	defer os.RemoveAll(rootfs)
+
+	if err := os.MkdirAll(filepath.Join(rootfs, "etc"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	passwd := "root:x:0:0:root:/root:/bin/sh\napp:x:1000:1000:app:/home/app:/bin/sh\n"
+	if err := ioutil.WriteFile(filepath.Join(rootfs, "etc", "passwd"), []byte(passwd), 0644); err != nil {
+		t.Fatal(err)
+	}
+	group := "root:x:0:\napp:x:1000:\nwheel:x:10:app\n"
+	if err := ioutil.WriteFile(filepath.Join(rootfs, "etc", "group"), []byte(group), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	spec := &specs.Spec{Process: &specs.Process{}}
+	if err := setProcessUser(rootfs, "app", spec); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := specs.User{UID: 1000, GID: 1000, AdditionalGids: []uint32{10}, Username: "app"}
+	if !reflect.DeepEqual(spec.Process.User, expected) {
+		t.Fatalf("expected user %+v, got %+v", expected, spec.Process.User)
+	}
+
+	if err := setProcessUser(rootfs, "admin", spec); err == nil {
+		t.Fatal("expected error for user missing in container")
+	}
+
+	config := &Config{Services: []*Service{{Name: "sshd", Args: []string{"sshd"}, User: "sshd"}}}
+	if err := checkUsers(rootfs, config, spec); err == nil {
+		t.Fatal("expected error for service user missing in container")
+	}
+}
@@ -38,6 +38,13 @@ func shouldUseRootlessCgroupManager(context *cli.Context) (bool, error) {
 	return true, nil
 }
 
+// shouldUseSystemdUser returns whether the systemd cgroup driver should use the
+// systemd user instance of the current user rather than the system instance,
+// which only manages cgroups for root.
+func shouldUseSystemdUser() bool {
+	return os.Geteuid() != 0 || system.RunningInUserNS()
+}
+
 func shouldHonorXDGRuntimeDir() bool {
 	if os.Getenv("XDG_RUNTIME_DIR") == "" {
 		return false
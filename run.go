@@ -6,6 +6,7 @@ import (
 	"os"
 
 	"github.com/opencontainers/runc/prehook"
+	"github.com/opencontainers/runc/prehook/external"
 	"github.com/urfave/cli"
 )
 
@@ -76,6 +77,10 @@ command(s) that get executed on start, edit the args parameter of the spec. See
 		}
 
 		//pre hook
+		if err := external.Load(context.GlobalString("prehook-dir")); err != nil {
+			return err
+		}
+
 		opt, err := prehook.CreateHookOptions(context, spec)
 		if err != nil {
 			return err
@@ -90,6 +95,10 @@ command(s) that get executed on start, edit the args parameter of the spec. See
 		}
 
 		status, err := startContainer(context, spec, CT_ACT_RUN, nil)
+		if err != nil || !context.Bool("detach") {
+			//the container has been destroyed
+			removeStagingDir(context, err)
+		}
 		if err == nil {
 			// exit with the container's exit status so any external supervisor is
 			// notified of the exit with the correct exit status.
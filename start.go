@@ -31,7 +31,15 @@ your host.`,
 		}
 		switch status {
 		case libcontainer.Created:
-			return container.Exec()
+			if err := container.Exec(); err != nil {
+				return err
+			}
+			data := &lifecycle{}
+			if state, err := container.State(); err == nil {
+				data.Pid = state.InitProcessPid
+			}
+			recordContainerEvent(context, container, lifecycleStarted, data)
+			return nil
 		case libcontainer.Stopped:
 			return errors.New("cannot start a container that has stopped")
 		case libcontainer.Running:
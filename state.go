@@ -49,6 +49,7 @@ instance of a container.`,
 			Rootfs:         state.BaseState.Config.Rootfs,
 			Created:        state.BaseState.Created,
 			Annotations:    annotations,
+			RichContainer:  richContainerHealth(container, containerStatus, pid, annotations),
 		}
 		data, err := json.MarshalIndent(cs, "", "  ")
 		if err != nil {
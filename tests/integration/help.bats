@@ -49,6 +49,10 @@ load helpers
   [ "$status" -eq 0 ]
   [[ ${lines[1]} =~ runc\ pause+ ]]
 
+  runc prehook -h
+  [ "$status" -eq 0 ]
+  [[ ${lines[1]} =~ runc\ prehook+ ]]
+
   runc restore -h
   [ "$status" -eq 0 ]
   [[ ${lines[1]} =~ runc\ restore+ ]]
@@ -6,11 +6,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 
 	"github.com/docker/go-units"
 	"github.com/opencontainers/runc/libcontainer/configs"
+	"github.com/opencontainers/runc/libcontainer/devices"
 	"github.com/opencontainers/runc/libcontainer/intelrdt"
 	"github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/urfave/cli"
@@ -38,7 +40,9 @@ The accepted format is as follow (unchanged values can be omitted):
     "reservation": 0,
     "swap": 0,
     "kernel": 0,
-    "kernelTCP": 0
+    "kernelTCP": 0,
+    "swappiness": 0,
+    "disableOOMKiller": false
   },
   "cpu": {
     "shares": 0,
@@ -71,11 +75,27 @@ The accepted format is as follow (unchanged values can be omitted):
       "minor",
       "rate"
     }]
-  }
+  },
+  "hugepageLimits": [{
+    "pageSize": "",
+    "limit": 0
+  }],
+  "network": {
+    "classID": 0,
+    "priorities": [{
+      "name": "",
+      "priority": 0
+    }]
+  },
+  "rlimits": [{
+    "type": "",
+    "soft": 0,
+    "hard": 0
+  }]
 }
 
 Note: if data is to be read from a file or the standard input, all
-other options are ignored.
+other options but --device-add and --device-remove are ignored.
 `,
 		},
 
@@ -147,10 +167,42 @@ other options are ignored.
 			Name:  "memory-swap",
 			Usage: "Total memory usage (memory + swap); set '-1' to enable unlimited swap",
 		},
+		cli.StringFlag{
+			Name:  "memory-swappiness",
+			Usage: "Tune the memory swappiness (0 to 100)",
+		},
+		cli.StringFlag{
+			Name:  "oom-kill-disable",
+			Usage: "Disable (true) or enable (false) the OOM killer",
+		},
 		cli.IntFlag{
 			Name:  "pids-limit",
 			Usage: "Maximum number of pids allowed in the container",
 		},
+		cli.StringSliceFlag{
+			Name:  "hugetlb-limit",
+			Usage: "Limit the usage of a hugepage size, such as \"2MB 1G\"",
+		},
+		cli.StringFlag{
+			Name:  "net-cls-classid",
+			Usage: "Class identifier of the network packets of the container",
+		},
+		cli.StringSliceFlag{
+			Name:  "net-prio-ifpriomap",
+			Usage: "Priority of the network traffic of the container on an interface, such as \"eth0 5\"",
+		},
+		cli.StringSliceFlag{
+			Name:  "rlimit",
+			Usage: "Set a resource limit of the processes of the container, such as \"RLIMIT_NOFILE=1024:4096\" (type=soft[:hard])",
+		},
+		cli.StringSliceFlag{
+			Name:  "device-add",
+			Usage: "Add a host device to the container, such as \"/dev/sdc:/dev/xvdc:rwm\" (host path[:container path[:permissions]])",
+		},
+		cli.StringSliceFlag{
+			Name:  "device-remove",
+			Usage: "Remove a device from the container, by its path in the container",
+		},
 		cli.StringFlag{
 			Name:  "l3-cache-schema",
 			Usage: "The string of Intel RDT/CAT L3 cache schema",
@@ -169,7 +221,7 @@ other options are ignored.
 			return err
 		}
 
-		r := specs.LinuxResources{
+		r := updateResources{LinuxResources: specs.LinuxResources{
 			Memory: &specs.LinuxMemory{
 				Limit:       i64Ptr(0),
 				Reservation: i64Ptr(0),
@@ -192,7 +244,8 @@ other options are ignored.
 			Pids: &specs.LinuxPids{
 				Limit: 0,
 			},
-		}
+			Network: &specs.LinuxNetwork{},
+		}}
 
 		config := container.Config()
 
@@ -299,7 +352,48 @@ other options are ignored.
 					*pair.dest = v
 				}
 			}
+			if val := context.String("memory-swappiness"); val != "" {
+				v, err := strconv.ParseUint(val, 10, 64)
+				if err != nil {
+					return fmt.Errorf("invalid value for memory-swappiness: %s", err)
+				}
+				r.Memory.Swappiness = &v
+			}
+			if val := context.String("oom-kill-disable"); val != "" {
+				v, err := strconv.ParseBool(val)
+				if err != nil {
+					return fmt.Errorf("invalid value for oom-kill-disable: %s", err)
+				}
+				r.Memory.DisableOOMKiller = &v
+			}
 			r.Pids.Limit = int64(context.Int("pids-limit"))
+
+			if val := context.StringSlice("hugetlb-limit"); len(val) > 0 {
+				r.HugepageLimits, err = stringSliceToHugepageLimits(val)
+				if err != nil {
+					return fmt.Errorf("invalid value for hugetlb-limit: %s", err)
+				}
+			}
+			if val := context.String("net-cls-classid"); val != "" {
+				v, err := strconv.ParseUint(val, 0, 32)
+				if err != nil {
+					return fmt.Errorf("invalid value for net-cls-classid: %s", err)
+				}
+				classID := uint32(v)
+				r.Network.ClassID = &classID
+			}
+			if val := context.StringSlice("net-prio-ifpriomap"); len(val) > 0 {
+				r.Network.Priorities, err = stringSliceToIfPriorities(val)
+				if err != nil {
+					return fmt.Errorf("invalid value for net-prio-ifpriomap: %s", err)
+				}
+			}
+			if val := context.StringSlice("rlimit"); len(val) > 0 {
+				r.Rlimits, err = stringSliceToRlimits(val)
+				if err != nil {
+					return fmt.Errorf("invalid value for rlimit: %s", err)
+				}
+			}
 		}
 
 		// Update the value
@@ -317,6 +411,25 @@ other options are ignored.
 		config.Cgroups.Resources.MemoryReservation = *r.Memory.Reservation
 		config.Cgroups.Resources.MemorySwap = *r.Memory.Swap
 		config.Cgroups.Resources.PidsLimit = r.Pids.Limit
+		if r.Memory.Swappiness != nil {
+			if *r.Memory.Swappiness > 100 {
+				return fmt.Errorf("invalid memory swappiness %d: the valid range is 0-100", *r.Memory.Swappiness)
+			}
+			config.Cgroups.Resources.MemorySwappiness = r.Memory.Swappiness
+		}
+		if r.Memory.DisableOOMKiller != nil {
+			config.Cgroups.Resources.OomKillDisable = *r.Memory.DisableOOMKiller
+		}
+		if r.Network != nil {
+			if r.Network.ClassID != nil {
+				config.Cgroups.Resources.NetClsClassid = *r.Network.ClassID
+			}
+			config.Cgroups.Resources.NetPrioIfpriomap = mergeIfPriorities(config.Cgroups.Resources.NetPrioIfpriomap, r.Network.Priorities)
+		}
+		config.Cgroups.Resources.HugetlbLimit = mergeHugepageLimits(config.Cgroups.Resources.HugetlbLimit, r.HugepageLimits)
+		if config.Rlimits, err = mergeRlimits(config.Rlimits, r.Rlimits); err != nil {
+			return err
+		}
 
 		for _, pair := range []struct {
 			dest *[]*configs.ThrottleDevice
@@ -332,6 +445,11 @@ other options are ignored.
 			}
 		}
 
+		// Update devices
+		if err := updateDevices(&config, context.StringSlice("device-add"), context.StringSlice("device-remove")); err != nil {
+			return err
+		}
+
 		// Update Intel RDT
 		l3CacheSchema := context.String("l3-cache-schema")
 		memBwSchema := context.String("mem-bw-schema")
@@ -371,6 +489,138 @@ other options are ignored.
 	},
 }
 
+// updateResources are the resources accepted by runc update, the rlimits of
+// the processes of the container are updated along its cgroup resources.
+type updateResources struct {
+	specs.LinuxResources
+	Rlimits []specs.POSIXRlimit `json:"rlimits,omitempty"`
+}
+
+// mergeHugepageLimits returns the limits with the ones of update replacing
+// the ones of the same page size. A new slice is returned as limits is
+// shared with the container.
+func mergeHugepageLimits(limits []*configs.HugepageLimit, update []specs.LinuxHugepageLimit) []*configs.HugepageLimit {
+	if len(update) == 0 {
+		return limits
+	}
+	merged := append([]*configs.HugepageLimit(nil), limits...)
+next:
+	for _, u := range update {
+		l := &configs.HugepageLimit{Pagesize: u.Pagesize, Limit: u.Limit}
+		for i, m := range merged {
+			if m.Pagesize == u.Pagesize {
+				merged[i] = l
+				continue next
+			}
+		}
+		merged = append(merged, l)
+	}
+	return merged
+}
+
+// mergeIfPriorities returns the priorities with the ones of update replacing
+// the ones of the same interface.
+func mergeIfPriorities(prios []*configs.IfPrioMap, update []specs.LinuxInterfacePriority) []*configs.IfPrioMap {
+	if len(update) == 0 {
+		return prios
+	}
+	merged := append([]*configs.IfPrioMap(nil), prios...)
+next:
+	for _, u := range update {
+		p := &configs.IfPrioMap{Interface: u.Name, Priority: int64(u.Priority)}
+		for i, m := range merged {
+			if m.Interface == u.Name {
+				merged[i] = p
+				continue next
+			}
+		}
+		merged = append(merged, p)
+	}
+	return merged
+}
+
+// mergeRlimits returns the rlimits with the ones of update replacing the ones
+// of the same type.
+func mergeRlimits(rlimits []configs.Rlimit, update []specs.POSIXRlimit) ([]configs.Rlimit, error) {
+	if len(update) == 0 {
+		return rlimits, nil
+	}
+	merged := append([]configs.Rlimit(nil), rlimits...)
+next:
+	for _, u := range update {
+		rl, err := createLibContainerRlimit(u)
+		if err != nil {
+			return nil, err
+		}
+		if rl.Soft > rl.Hard {
+			return nil, fmt.Errorf("invalid rlimit %s: the soft limit %d is greater than the hard limit %d", u.Type, rl.Soft, rl.Hard)
+		}
+		for i, m := range merged {
+			if m.Type == rl.Type {
+				merged[i] = rl
+				continue next
+			}
+		}
+		merged = append(merged, rl)
+	}
+	return merged, nil
+}
+
+func stringSliceToHugepageLimits(ss []string) ([]specs.LinuxHugepageLimit, error) {
+	limits := make([]specs.LinuxHugepageLimit, 0, len(ss))
+	for _, v := range ss {
+		parts := strings.Fields(v)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("failed to parse hugetlb limit %s: the expected format is 'pagesize limit'", v)
+		}
+		limit, err := units.RAMInBytes(parts[1])
+		if err != nil {
+			return nil, err
+		}
+		limits = append(limits, specs.LinuxHugepageLimit{Pagesize: parts[0], Limit: uint64(limit)})
+	}
+	return limits, nil
+}
+
+func stringSliceToIfPriorities(ss []string) ([]specs.LinuxInterfacePriority, error) {
+	prios := make([]specs.LinuxInterfacePriority, 0, len(ss))
+	for _, v := range ss {
+		parts := strings.Fields(v)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("failed to parse interface priority %s: the expected format is 'interface priority'", v)
+		}
+		prio, err := strconv.ParseUint(parts[1], 10, 32)
+		if err != nil {
+			return nil, err
+		}
+		prios = append(prios, specs.LinuxInterfacePriority{Name: parts[0], Priority: uint32(prio)})
+	}
+	return prios, nil
+}
+
+func stringSliceToRlimits(ss []string) ([]specs.POSIXRlimit, error) {
+	rlimits := make([]specs.POSIXRlimit, 0, len(ss))
+	for _, v := range ss {
+		parts := strings.SplitN(v, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("failed to parse rlimit %s: the expected format is 'type=soft[:hard]'", v)
+		}
+		limits := strings.SplitN(parts[1], ":", 2)
+		soft, err := strconv.ParseUint(limits[0], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		hard := soft
+		if len(limits) == 2 {
+			if hard, err = strconv.ParseUint(limits[1], 10, 64); err != nil {
+				return nil, err
+			}
+		}
+		rlimits = append(rlimits, specs.POSIXRlimit{Type: parts[0], Soft: soft, Hard: hard})
+	}
+	return rlimits, nil
+}
+
 func stringSliceToThrottleDevice(ss []string) ([]specs.LinuxThrottleDevice, error) {
 	tds := make([]specs.LinuxThrottleDevice, 0, len(ss))
 	for _, v := range ss {
@@ -407,3 +657,100 @@ func stringSliceToThrottleDevice(ss []string) ([]specs.LinuxThrottleDevice, erro
 	}
 	return tds, nil
 }
+
+// updateDevices adds the devices of add to config and removes the ones of
+// remove from it. The device cgroup rules of the devices are updated along:
+// the device of an added node is allowed, the one of a removed node denied.
+// A device keeps a single rule of its own however often it is added and
+// removed. New slices are built as config shares them with the container.
+func updateDevices(config *configs.Config, add, remove []string) error {
+	if len(add) == 0 && len(remove) == 0 {
+		return nil
+	}
+	var (
+		devs  = append([]*configs.Device(nil), config.Devices...)
+		rules = append([]*configs.Device(nil), config.Cgroups.Resources.Devices...)
+	)
+	for _, path := range remove {
+		i := indexDevice(devs, path)
+		if i < 0 {
+			return fmt.Errorf("invalid value for device-remove: no device %s in the container", path)
+		}
+		d := devs[i]
+		devs = append(devs[:i], devs[i+1:]...)
+		rules = setDeviceRule(rules, d, "rwm", false)
+	}
+	for _, v := range add {
+		d, err := parseDevice(v)
+		if err != nil {
+			return fmt.Errorf("invalid value for device-add: %s", err)
+		}
+		if indexDevice(devs, d.Path) >= 0 {
+			return fmt.Errorf("invalid value for device-add: device %s already exists in the container", d.Path)
+		}
+		devs = append(devs, d)
+		rules = setDeviceRule(rules, d, d.Permissions, true)
+	}
+	config.Devices = devs
+	config.Cgroups.Resources.Devices = rules
+	return nil
+}
+
+// setDeviceRule replaces the rules of the device d by a single one, appended
+// last so that it takes precedence over the rules of wildcards, which are kept.
+func setDeviceRule(rules []*configs.Device, d *configs.Device, permissions string, allow bool) []*configs.Device {
+	kept := rules[:0]
+	for _, r := range rules {
+		if !(r.Type == d.Type && r.Major == d.Major && r.Minor == d.Minor) {
+			kept = append(kept, r)
+		}
+	}
+	return append(kept, &configs.Device{
+		Type:        d.Type,
+		Major:       d.Major,
+		Minor:       d.Minor,
+		Permissions: permissions,
+		Allow:       allow,
+	})
+}
+
+func indexDevice(devs []*configs.Device, path string) int {
+	for i, d := range devs {
+		if d.Path == path {
+			return i
+		}
+	}
+	return -1
+}
+
+// parseDevice parses a device given as host path[:container path[:permissions]].
+func parseDevice(v string) (*configs.Device, error) {
+	parts := strings.Split(v, ":")
+	if len(parts) > 3 || parts[0] == "" {
+		return nil, fmt.Errorf("failed to parse device %s: the expected format is 'host path[:container path[:permissions]]'", v)
+	}
+	var (
+		src         = parts[0]
+		dst         = src
+		permissions = "rwm"
+	)
+	if len(parts) > 1 && parts[1] != "" {
+		dst = parts[1]
+	}
+	if len(parts) > 2 {
+		permissions = parts[2]
+		if permissions == "" || strings.Trim(permissions, "rwm") != "" {
+			return nil, fmt.Errorf("failed to parse device %s: invalid permissions %q", v, permissions)
+		}
+	}
+	if !filepath.IsAbs(dst) {
+		return nil, fmt.Errorf("failed to parse device %s: the container path must be absolute", v)
+	}
+	d, err := devices.DeviceFromPath(src, permissions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse device %s: %v", v, err)
+	}
+	d.Path = filepath.Clean(dst)
+	d.FileMode &= os.ModePerm
+	return d, nil
+}
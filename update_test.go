@@ -0,0 +1,50 @@
+// +build linux
+
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/opencontainers/runc/libcontainer/configs"
+)
+
+func TestUpdateDevicesKeepsOneRulePerDevice(t *testing.T) {
+	denyAll := &configs.Device{Type: 'a', Major: configs.Wildcard, Minor: configs.Wildcard, Permissions: "rwm", Allow: false}
+	specRule := &configs.Device{Type: 'c', Major: 1, Minor: 3, Permissions: "rwm", Allow: true}
+	config := &configs.Config{
+		Cgroups: &configs.Cgroup{
+			Resources: &configs.Resources{
+				Devices: []*configs.Device{denyAll, specRule},
+			},
+		},
+	}
+	rule := func(permissions string, allow bool) *configs.Device {
+		return &configs.Device{Type: 'c', Major: 1, Minor: 3, Permissions: permissions, Allow: allow}
+	}
+
+	for i, step := range []struct {
+		add, remove []string
+		expected    *configs.Device
+	}{
+		{add: []string{"/dev/null:/dev/mynull:rw"}, expected: rule("rw", true)},
+		{remove: []string{"/dev/mynull"}, expected: rule("rwm", false)},
+		{add: []string{"/dev/null:/dev/mynull"}, expected: rule("rwm", true)},
+		{remove: []string{"/dev/mynull"}, expected: rule("rwm", false)},
+	} {
+		if err := updateDevices(config, step.add, step.remove); err != nil {
+			t.Fatalf("step %d: %v", i, err)
+		}
+		expected := []*configs.Device{denyAll, step.expected}
+		if !reflect.DeepEqual(config.Cgroups.Resources.Devices, expected) {
+			t.Fatalf("step %d: expected rules %+v, got %+v", i, expected, config.Cgroups.Resources.Devices)
+		}
+	}
+
+	if len(config.Devices) != 0 {
+		t.Fatalf("expected no device left, got %+v", config.Devices)
+	}
+	if *specRule != *rule("rwm", true) {
+		t.Fatalf("the rule of the original config was changed: %+v", specRule)
+	}
+}
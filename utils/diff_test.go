@@ -0,0 +1,30 @@
+package utils
+
+import "testing"
+
+func TestUnifiedDiff(t *testing.T) {
+	if d := UnifiedDiff("a", "b", "x\ny\n", "x\ny\n"); d != "" {
+		t.Fatalf("expected no diff for equal input, got %q", d)
+	}
+
+	a := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n"
+	b := "1\n2\n3\n4\nfive\n6\n7\n8\n9\n10\n11\n"
+	expected := `--- a
++++ b
+@@ -2,9 +2,10 @@
+ 2
+ 3
+ 4
+-5
++five
+ 6
+ 7
+ 8
+ 9
+ 10
++11
+`
+	if d := UnifiedDiff("a", "b", a, b); d != expected {
+		t.Fatalf("expected diff:\n%s\ngot:\n%s", expected, d)
+	}
+}
@@ -16,6 +16,7 @@ import (
 	"github.com/opencontainers/runc/libcontainer/intelrdt"
 	"github.com/opencontainers/runc/libcontainer/specconv"
 	"github.com/opencontainers/runc/libcontainer/utils"
+	"github.com/opencontainers/runc/prehook/richcontainer"
 	"github.com/opencontainers/runtime-spec/specs-go"
 
 	"github.com/coreos/go-systemd/activation"
@@ -46,7 +47,12 @@ func loadFactory(context *cli.Context) (libcontainer.Factory, error) {
 		cgroupManager = libcontainer.RootlessCgroupfs
 	}
 	if context.GlobalBool("systemd-cgroup") {
-		if systemd.UseSystemd() {
+		if shouldUseSystemdUser() {
+			if !systemd.UseSystemdUser() {
+				return nil, fmt.Errorf("systemd cgroup flag passed for a rootless container, but the systemd user instance is not available for managing cgroups")
+			}
+			cgroupManager = libcontainer.RootlessSystemdCgroups
+		} else if systemd.UseSystemd() {
 			cgroupManager = libcontainer.SystemdCgroups
 		} else {
 			return nil, fmt.Errorf("systemd cgroup flag passed, but systemd support for managing cgroups is not available")
@@ -54,7 +60,7 @@ func loadFactory(context *cli.Context) (libcontainer.Factory, error) {
 	}
 
 	intelRdtManager := libcontainer.IntelRdtFs
-	if !intelrdt.IsCatEnabled() && !intelrdt.IsMbaEnabled() {
+	if !intelrdt.IsEnabled() {
 		intelRdtManager = nil
 	}
 
@@ -143,6 +149,15 @@ func newProcess(p specs.Process, init bool) (*libcontainer.Process, error) {
 	return lp, nil
 }
 
+// richContainerHealth returns the state of the main service of a running
+// rich container, nil if the container is not a rich container.
+func richContainerHealth(container libcontainer.Container, status libcontainer.Status, pid int, annotations map[string]string) *richcontainer.Health {
+	if status != libcontainer.Running {
+		return nil
+	}
+	return richcontainer.CheckHealth(annotations, pid, container.Processes)
+}
+
 func destroy(container libcontainer.Container) {
 	if err := container.Destroy(); err != nil {
 		logrus.Error(err)
@@ -238,6 +253,7 @@ func createContainer(context *cli.Context, id string, spec *specs.Spec) (libcont
 		Spec:             spec,
 		RootlessEUID:     os.Geteuid() != 0,
 		RootlessCgroups:  rootlessCg,
+		SystemdUser:      shouldUseSystemdUser(),
 	})
 	if err != nil {
 		return nil, err
@@ -263,6 +279,11 @@ type runner struct {
 	action          CtAct
 	notifySocket    *notifySocket
 	criuOpts        *libcontainer.CriuOpts
+	lifecycleLog    string
+
+	// sub-cgroup of the process, see libcontainer.Process
+	subCgroup          string
+	subCgroupResources *configs.Resources
 }
 
 func (r *runner) run(config *specs.Process) (int, error) {
@@ -275,6 +296,8 @@ func (r *runner) run(config *specs.Process) (int, error) {
 		r.destroy()
 		return -1, err
 	}
+	process.SubCgroup = r.subCgroup
+	process.SubCgroupResources = r.subCgroupResources
 	if len(r.listenFDs) > 0 {
 		process.Env = append(process.Env, fmt.Sprintf("LISTEN_FDS=%d", len(r.listenFDs)), "LISTEN_PID=1")
 		process.ExtraFiles = append(process.ExtraFiles, r.listenFDs...)
@@ -343,6 +366,7 @@ func (r *runner) run(config *specs.Process) (int, error) {
 			return -1, err
 		}
 	}
+	r.recordStarted(process)
 	status, err := handler.forward(process, tty, detach)
 	if err != nil {
 		r.terminate(process)
@@ -350,10 +374,41 @@ func (r *runner) run(config *specs.Process) (int, error) {
 	if detach {
 		return 0, nil
 	}
+	r.recordExited(process, status, err)
 	r.destroy()
 	return status, err
 }
 
+func (r *runner) recordStarted(process *libcontainer.Process) {
+	pid, err := process.Pid()
+	if err != nil {
+		return
+	}
+	id := r.container.ID()
+	switch {
+	case !r.init:
+		recordLifecycleEvent(r.lifecycleLog, id, lifecycleExecStarted, &lifecycle{Pid: pid})
+	case r.action == CT_ACT_CREATE:
+		recordLifecycleEvent(r.lifecycleLog, id, lifecycleCreated, &lifecycle{Pid: pid})
+	case r.action == CT_ACT_RUN:
+		recordLifecycleEvent(r.lifecycleLog, id, lifecycleCreated, &lifecycle{Pid: pid})
+		recordLifecycleEvent(r.lifecycleLog, id, lifecycleStarted, &lifecycle{Pid: pid})
+	}
+}
+
+func (r *runner) recordExited(process *libcontainer.Process, status int, err error) {
+	pid, _ := process.Pid()
+	data := &lifecycle{Pid: pid}
+	if err == nil {
+		data.ExitCode = &status
+	}
+	typ := lifecycleExited
+	if !r.init {
+		typ = lifecycleExecExited
+	}
+	recordLifecycleEvent(r.lifecycleLog, r.container.ID(), typ, data)
+}
+
 func (r *runner) destroy() {
 	if r.shouldDestroy {
 		destroy(r.container)
@@ -439,6 +494,7 @@ func startContainer(context *cli.Context, spec *specs.Spec, action CtAct, criuOp
 		action:          action,
 		criuOpts:        criuOpts,
 		init:            true,
+		lifecycleLog:    lifecycleLogPath(context, id),
 	}
 	return r.run(spec.Process)
 }